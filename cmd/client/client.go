@@ -11,10 +11,71 @@ import (
 	"strings"
 )
 
+// Strips the telnet IAC sequences sent by the server, the client refuses
+// every option by staying silent so the server falls back to defaults
+type iac_filter struct {
+	src   io.Reader
+	state int
+}
+
+const (
+	iac_data = iota
+	iac_cmd
+	iac_opt
+	iac_sb
+	iac_sb_iac
+)
+
+func (f *iac_filter) Read(b []byte) (int, error) {
+	for {
+		n, err := f.src.Read(b)
+		out := 0
+		for _, c := range b[:n] {
+			switch f.state {
+			case iac_data:
+				if c == 255 {
+					f.state = iac_cmd
+					continue
+				}
+				b[out] = c
+				out++
+			case iac_cmd:
+				switch {
+				case c == 255:
+					b[out] = c
+					out++
+					f.state = iac_data
+				case c >= 251 && c <= 254:
+					f.state = iac_opt
+				case c == 250:
+					f.state = iac_sb
+				default:
+					f.state = iac_data
+				}
+			case iac_opt:
+				f.state = iac_data
+			case iac_sb:
+				if c == 255 {
+					f.state = iac_sb_iac
+				}
+			case iac_sb_iac:
+				if c == 240 {
+					f.state = iac_data
+				} else {
+					f.state = iac_sb
+				}
+			}
+		}
+		if out > 0 || err != nil {
+			return out, err
+		}
+	}
+}
+
 // Handles TC connection and perform synchorinization:
 // TCP -> Stdout and Stdin -> TCP
 func tcp_con_handle(con net.Conn) {
-	chan_to_stdout := stream_copy(con, os.Stdout)
+	chan_to_stdout := stream_copy(&iac_filter{src: con}, os.Stdout)
 	chan_to_remote := stream_copy(os.Stdin, con)
 	select {
 	case <-chan_to_stdout:
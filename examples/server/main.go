@@ -13,6 +13,7 @@ import (
 
 const telnetPort = 6666
 const sshPort = 5559
+const webSocketAddr = "localhost:8080"
 
 var users = map[string]string{
 	"root":  "root",
@@ -33,6 +34,7 @@ const (
 	SSHPassword
 	SSHPublicKey
 	Mqtt
+	WebSocket
 )
 
 //change this const to start another console
@@ -57,6 +59,8 @@ func main() {
 		startSSHPublicKeyConsole()
 	case Mqtt:
 		startMqttConsole()
+	case WebSocket:
+		startWebSocketConsole()
 	}
 
 }
@@ -72,16 +76,27 @@ func startStdOutputConsole() {
 	c.EnableLogin("root")
 	c.SetTimeout(timeoutSec * time.Second)
 	c.Start()
-	select {}
+	// a script read from stdin sends its outcome once all its lines have run,
+	// on a terminal nothing is sent and exit ends the program
+	if err := <-c.ScriptResult(); err != nil {
+		os.Exit(1)
+	}
 }
 
 func startTelnetConsole() {
 	fmt.Printf("opening Telnet console on localhost %d", telnetPort)
 	fmt.Println()
-	ct := console.NewTelnetConsole(telnetPort, 2)
+	ct := console.NewTelnetConsoleWithOptions(
+		console.WithOptionTelnetHost("localhost"),
+		console.WithOptionTelnetPort(telnetPort),
+		console.WithOptionTelnetMaxClients(2),
+		console.WithOptionTelnetKeepAlive(30*time.Second),
+		console.WithOptionTelnetTimeout(timeoutSec*time.Second),
+	)
 	ct.AddCallbackOnNewConsole(onNewConsole)
-	ct.SetTimeout(timeoutSec * time.Second)
-	select {}
+	if err := ct.Start(); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func startSSHPasswordConsole() {
@@ -122,3 +137,16 @@ func startMqttConsole() {
 	go mqttConsole.Start()
 	select {}
 }
+
+func startWebSocketConsole() {
+	fmt.Printf("opening WebSocket console on http://%s", webSocketAddr)
+	fmt.Println()
+	wc := console.NewWebSocketConsole(
+		console.WithOptionWebSocketBasicAuth(users),
+		console.WithOptionWebSocketMaxConnections(3),
+		console.WithOptionWebSocketTimeout(timeoutSec*time.Second),
+	)
+	if err := wc.Start(webSocketAddr); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -7,17 +7,18 @@ toolchain go1.23.1
 require (
 	github.com/eclipse/paho.mqtt.golang v1.5.0
 	github.com/freedreamer82/mqtt-shell v0.0.0-20250225221018-9f14d3a999fa
+	github.com/gorilla/websocket v1.5.3
 	github.com/lithammer/shortuuid/v3 v3.0.7
 	github.com/sirupsen/logrus v1.9.3
 	golang.org/x/crypto v0.35.0
+	golang.org/x/sys v0.30.0
 	golang.org/x/term v0.29.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/chzyer/readline v1.5.1 // indirect
 	github.com/google/uuid v1.6.0 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
 	golang.org/x/net v0.35.0 // indirect
 	golang.org/x/sync v0.11.0 // indirect
-	golang.org/x/sys v0.30.0 // indirect
 )
@@ -1,6 +1,8 @@
 package console
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/lithammer/shortuuid/v3"
@@ -8,12 +10,16 @@ import (
 	terminal "golang.org/x/term"
 	"io"
 	"strings"
+	"sync"
 	"time"
 )
 
 const prompt = "> "
 const eol = "\r\n"
 
+const defaultTermWidth = 80
+const defaultTermHeight = 24
+
 const defaultWelcome = "============================================================" + eol +
 	"           ______________________________________           " + eol +
 	"  ________|                                      |_______  " + eol +
@@ -46,6 +52,16 @@ const (
 	Root
 )
 
+func (u User) String() string {
+	switch u {
+	case Guest:
+		return "Guest"
+	case Root:
+		return "Root"
+	}
+	return fmt.Sprintf("User(%d)", int(u))
+}
+
 type Flusher interface {
 	Flush() error
 }
@@ -65,11 +81,58 @@ type Console struct {
 	mask             Bitmask
 	commands         []*ConsoleCommand
 	userLevel        User
+	username         string
 	iorw             ConsoleI
+	out              *syncWriter
 	onclose          OnCloseTaskCallback
 	timeout          time.Duration
 	lastActivitytime time.Time
 	uuid             string
+	stopOnce         sync.Once
+	done             chan struct{}
+	ctx              context.Context
+	cancel           context.CancelFunc
+	mu               sync.Mutex
+	draining         bool
+	cmdCtx           context.Context
+	cmdDone          chan struct{}
+	width            int
+	height           int
+	termType         string
+	aliases          map[string]string
+	aliasesOwner     string
+	aliasStore       AliasStore
+	captures         []*bytes.Buffer
+	buffers          map[string]string
+	redirectLevel    User
+	redirectDirs     []string
+	format           OutputFormat
+	commandFormat    OutputFormat
+	theme            Theme
+	colorMode        colorMode
+	promptEnabled    bool
+	promptTemplate   string
+	promptContext    string
+	lastStatus       int
+	contexts         []*CommandContext
+	exitCmd          *ConsoleCommand
+	endCmd           *ConsoleCommand
+	cmdCancel        context.CancelFunc
+	pagerEnabled     bool
+	nonInteractive   bool
+	pager            *pager
+	running          bool
+	input            *inputReader
+	pendingRead      chan lineResult
+	abortedRead      chan lineResult
+	inputTimeout     time.Duration
+	progress         *Progress
+	progressInterval time.Duration
+	notifyMuted      bool
+	notifyHook       func(msg string) error
+	notifyExcluded   map[string]bool
+	sessionManager   *SessionManager
+	sessionID        int
 }
 
 type ConsoleOption func(console *Console)
@@ -80,26 +143,103 @@ func WithOptionCustomUUID(uuid string) ConsoleOption {
 	}
 }
 
+// WithOptionSourceLevel sets the user level required by the source command,
+// Root by default.
+func WithOptionSourceLevel(level User) ConsoleOption {
+	return func(console *Console) {
+		console.SetSourceLevel(level)
+	}
+}
+
+func (c *Console) SetSourceLevel(level User) {
+	for _, cmd := range c.commands {
+		if cmd.GetCommand() == "source" && cmd.builtin {
+			cmd.SetUserLevel(level)
+		}
+	}
+}
+
+// WithOptionContext makes the console context a child of ctx, the console
+// commands are cancelled when ctx is done.
+func WithOptionContext(ctx context.Context) ConsoleOption {
+	return func(console *Console) {
+		console.ctx = ctx
+	}
+}
+
 func NewConsole(iorw ConsoleI, opts ...ConsoleOption) *Console {
 
-	c := Console{term: terminal.NewTerminal(iorw, prompt), eol: eol, mask: 0,
-		welcome: defaultWelcome, userLevel: Root, iorw: iorw, onclose: nil}
+	out := &syncWriter{w: iorw.Writer, f: iorw.Flusher}
+	in := &inputReader{r: iorw}
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{in, out}
+
+	c := Console{term: terminal.NewTerminal(rw, prompt), eol: eol, mask: 0,
+		welcome: defaultWelcome, userLevel: Root, iorw: iorw, input: in, out: out, onclose: nil}
 
 	cmdhelp := NewConsoleCommand("help", c.printhelp, "show help")
 	cmdWamI := NewConsoleCommand("whoAmI", c.cmdWamI, "user level")
+	cmdSource := NewConsoleCommand("source", c.cmdSource, "run the commands of a script file")
+	cmdAlias := NewConsoleCommand("alias", c.cmdAlias, "alias [name [command; command $1 ...]], define or list the aliases")
+	cmdUnalias := NewConsoleCommand("unalias", c.cmdUnalias, "unalias name|-a, remove an alias or all of them")
 	c.commands = append(c.commands, cmdhelp)
 	c.commands = append(c.commands, cmdWamI)
+	c.commands = append(c.commands, cmdSource)
+	c.commands = append(c.commands, cmdAlias)
+	c.commands = append(c.commands, cmdUnalias)
+	c.commands = append(c.commands, NewConsoleCommand("buffers", c.cmdBuffers, "buffers [show @name|clear [@name]], the named buffers of the session"))
+	c.commands = append(c.commands, NewConsoleCommand("diff", c.cmdDiff, "diff @before @after, compare two named buffers"))
+	c.commands = append(c.commands, NewConsoleCommand("format", c.cmdFormat, "format [table|json|yaml|csv], the output format of the results"))
+	c.commands = append(c.commands, NewConsoleCommand("color", c.cmdColor, "color [on|off], the colors of the session"))
+	c.commands = append(c.commands, NewConsoleCommand("notifications", c.cmdNotifications,
+		"notifications [on|off|subscribe topic...|unsubscribe topic...], the notifications of the session"))
+	cmdWho := NewConsoleCommand("who", c.cmdWho, "list the sessions")
+	cmdWho.SetStructuredOutput(true)
+	c.commands = append(c.commands, cmdWho)
+	c.commands = append(c.commands, NewConsoleCommand("wall", c.cmdWall, "wall message, send a message to all the sessions"))
+	c.commands = append(c.commands, NewConsoleCommand("write", c.cmdWrite, "write session message, send a message to a session"))
+	for _, cmd := range c.commands {
+		cmd.builtin = true
+		// the commands acting only on the session are open to everybody,
+		// source, who, wall and write stay Root
+		switch cmd.GetCommand() {
+		case "alias", "unalias", "buffers", "diff", "format", "color", "notifications":
+			cmd.SetUserLevel(Guest)
+		}
+	}
+	c.exitCmd = NewConsoleCommand("exit", c.cmdExit, "leave the current context")
+	c.exitCmd.SetUserLevel(Guest)
+	c.endCmd = NewConsoleCommand("end", c.cmdEnd, "leave all the contexts")
+	c.endCmd.SetUserLevel(Guest)
+	c.term.AutoCompleteCallback = c.complete
 	c.quit = make(chan bool, 2)
 	c.uuid = shortuuid.New()
 	c.timeout = 0
 	c.lastActivitytime = time.Now()
+	c.done = make(chan struct{})
+	c.width, c.height = defaultTermWidth, defaultTermHeight
+	c.ctx = context.Background()
+	c.theme = DefaultTheme
+	c.sessionManager = DefaultSessionManager
+	c.promptEnabled = true
+	c.promptTemplate = prompt
 
 	for _, opt := range opts {
 		opt(&c)
 	}
+	c.updatePrompt()
+
+	c.ctx, c.cancel = context.WithCancel(c.ctx)
 
 	c.AddCallbackOnClose(c.dummyCb)
-	log.Printf("Open Console %s", c.uuid)
+	if c.nonInteractive {
+		// the machine transports open a console per request or connection
+		log.Debugf("Open Console %s", c.uuid)
+	} else {
+		log.Printf("Open Console %s", c.uuid)
+	}
 	return &c
 }
 
@@ -157,65 +297,304 @@ func (c *Console) RemoveConsoleCommand(cmd *ConsoleCommand) bool {
 	return false
 }
 
+// SetSize reports the size of the remote terminal, as negotiated by the
+// transport.
+func (c *Console) SetSize(width, height int) error {
+	c.mu.Lock()
+	c.width, c.height = width, height
+	c.mu.Unlock()
+
+	return c.term.SetSize(width, height)
+}
+
+func (c *Console) GetSize() (width, height int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.width, c.height
+}
+
+// SetTerminalType records the terminal type of the client, "dumb" turns the
+// colors off unless they have been forced.
+func (c *Console) SetTerminalType(termType string) {
+	c.mu.Lock()
+
+	c.termType = termType
+	c.mu.Unlock()
+
+	c.updatePrompt()
+}
+
+func (c *Console) GetTerminalType() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.termType
+}
+
 func (c *Console) setEol(eol string) {
 	c.eol = eol
 }
 
 func (c *Console) enablePrompt(status bool) {
-	if status {
-		c.term.SetPrompt(prompt)
-	} else {
-		c.term.SetPrompt("")
-	}
+	c.mu.Lock()
+	c.promptEnabled = status
+	c.mu.Unlock()
+
+	c.updatePrompt()
 }
 
 func (c *Console) EnableLogin(password string) {
 
+	c.mu.Lock()
 	c.mask.ToggleFlag(LOGIN_ENABLED)
-	c.enablePrompt(false)
+	c.mu.Unlock()
+	if !c.IsUserLogged() {
+		c.enablePrompt(false)
+	}
 	c.password = password
 
 }
 
+// Authenticate sets the identity of a user already authenticated by the
+// transport, the password login is skipped.
+func (c *Console) Authenticate(username string, level User) {
+	c.mu.Lock()
+	c.username = username
+	c.userLevel = level
+	c.mask.AddFlag(USER_LOGGED)
+	c.mu.Unlock()
+
+	c.enablePrompt(true)
+}
+
+// The identity of the session is read under the lock, the other sessions
+// look at it (who, wall, write).
+
+func (c *Console) GetUsername() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.username
+}
+
+func (c *Console) GetUserLevel() User {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.userLevel
+}
+
+func (c *Console) SetUserLevel(level User) {
+	c.mu.Lock()
+	c.userLevel = level
+	c.mu.Unlock()
+
+	c.updatePrompt()
+}
+
 func (c *Console) DisableLogin() {
+	c.mu.Lock()
 	c.mask.ClearFlag(LOGIN_ENABLED)
+	c.mu.Unlock()
+
 	c.enablePrompt(true)
 
 }
 
 func (c *Console) IsLoginEnabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	return c.mask.HasFlag(LOGIN_ENABLED)
 }
 
 func (c *Console) IsUserLogged() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	return c.mask.HasFlag(USER_LOGGED)
 }
 
+// touch records the activity of the user, for the timeout and who.
+func (c *Console) touch() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastActivitytime = time.Now()
+}
+
+func (c *Console) lastActivity() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lastActivitytime
+}
+
 func (c *Console) handleLogin(cmd string) bool {
 
 	if cmd == c.password {
-		c.mask.ToggleFlag(USER_LOGGED)
+		c.mu.Lock()
+		c.mask.AddFlag(USER_LOGGED)
+		c.mu.Unlock()
 		c.enablePrompt(true)
-		c.Print("Authenticated")
+		c.PrintSuccess("Authenticated")
 		return true
 	}
 	return false
 }
 
-func (c *Console) handleCommand(cmd string) bool {
+func (c *Console) beginCommand() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	subs := strings.Split(cmd, " ")
-	command2exec := subs[0]
+	if c.draining {
+		return false
+	}
+	c.cmdCtx, c.cmdCancel = context.WithCancel(c.ctx)
+	c.cmdDone = make(chan struct{})
+	return true
+}
+
+func (c *Console) endCommand() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cmdCancel()
+	close(c.cmdDone)
+	c.cmdDone = nil
+	c.cmdCtx = nil
+	c.cmdCancel = nil
+}
+
+// abortCommand cancels the context of the running command.
+func (c *Console) abortCommand() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cmdCancel != nil {
+		c.cmdCancel()
+	}
+}
+
+// Context returns the context of the command being executed, it is cancelled
+// when the console is stopped.
+func (c *Console) Context() context.Context {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cmdCtx != nil {
+		return c.cmdCtx
+	}
+	return c.ctx
+}
+
+// WaitIdle blocks until the running command, if any, returns or ctx is done.
+func (c *Console) WaitIdle(ctx context.Context) error {
+	c.mu.Lock()
+	done := c.cmdDone
+	c.mu.Unlock()
+
+	if done == nil {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown refuses new commands, prints notice, waits for the running command
+// until ctx expires and then stops the console.
+func (c *Console) Shutdown(ctx context.Context, notice string) error {
+	c.mu.Lock()
+	c.draining = true
+	c.mu.Unlock()
+
+	if notice != "" {
+		c.Print(notice)
+	}
+	err := c.WaitIdle(ctx)
+	c.Stop()
+	return err
+}
+
+// Done returns a channel closed when the console task has exited.
+func (c *Console) Done() <-chan struct{} {
+	return c.done
+}
+
+// Exec runs a command line on the console, the output is printed on the
+// console and the command error is returned.
+func (c *Console) Exec(line string) CommandError {
+
+	if !c.beginCommand() {
+		return CMD_REFUSED
+	}
+	defer c.endCommand()
+
+	return c.execLine(line)
+}
+
+// execLine runs a command line, it is called with the command already begun.
+func (c *Console) execLine(line string) CommandError {
+	return c.execPipeline(line, nil)
+}
+
+// ExecArgs runs a command with already split arguments, as Exec.
+func (c *Console) ExecArgs(command string, args []string) CommandError {
+
+	if !c.beginCommand() {
+		return CMD_REFUSED
+	}
+	defer c.endCommand()
+
+	return c.dispatch(command, args)
+}
+
+func (c *Console) dispatch(command2exec string, args []string) CommandError {
+
+	c.touch()
+
+	level := c.GetUserLevel()
 	err := CMD_NOT_FOUND
-	for _, i := range c.commands {
-		if i.GetCommand() == command2exec && c.userLevel >= i.GetUserLevel() {
-			err = i.handler(c, i, subs[1:])
+	for _, i := range c.activeCommands() {
+		if i.GetCommand() == command2exec && level >= i.GetUserLevel() {
+			err = c.runCommand(i, args)
 		}
 	}
 
+	return err
+}
+
+// GetCommands returns the commands of the active context available at the
+// user level.
+func (c *Console) GetCommands() []*ConsoleCommand {
+	level := c.GetUserLevel()
+	var cmds []*ConsoleCommand
+	for _, i := range c.activeCommands() {
+		if level >= i.GetUserLevel() {
+			cmds = append(cmds, i)
+		}
+	}
+	return cmds
+}
+
+func (c *Console) handleCommand(cmd string) bool {
+
+	// the echo of the line goes out before a long command starts
+	c.flush()
+	c.startPager()
+	err := c.Exec(cmd)
+	c.stopPager()
+	c.finishProgress()
 	if err != N0_ERR {
-		c.Print(err)
+		c.PrintError(err)
 	}
+	c.setLastStatus(err)
+	c.updatePrompt()
 	return true
 }
 
@@ -224,18 +603,19 @@ func (c *Console) SetWelcomeMessage(welcome string) {
 }
 
 func (c *Console) cmdWamI(console *Console, command *ConsoleCommand, args []string) CommandError {
-	c.Printf("User Level = %s"+eol, c.userLevel)
+	c.Printf("User Level = %s"+eol, c.GetUserLevel())
 	return N0_ERR
 }
 
 func (c *Console) printhelp(console *Console, command *ConsoleCommand, args []string) CommandError {
 
-	c.Print("######   LIST OF CONSOLE'S CMD  #######")
-	for _, i := range c.commands {
-		if c.userLevel >= i.GetUserLevel() {
-			c.Printf("---------------------------------------" + eol)
-			c.Printf("+ %s "+eol+" # %s #"+eol, i.GetCommand(), i.GetHelp())
-		}
+	c.PrintHeading("######   LIST OF CONSOLE'S CMD  #######")
+	if path := c.GetContextPath(); len(path) > 0 {
+		c.PrintHeading("context: " + strings.Join(path, " > "))
+	}
+	for _, i := range c.GetCommands() {
+		c.Printf("---------------------------------------" + eol)
+		c.Printf("+ %s "+eol+" # %s #"+eol, i.GetCommand(), i.GetHelp())
 	}
 
 	return N0_ERR
@@ -248,18 +628,30 @@ func (c *Console) Start() bool {
 }
 
 func (c *Console) Stop() {
-	c.quit <- true
-	//send and eol to force Readline to quit
-	c.iorw.Writer.Write([]byte(c.eol))
-	c.flush()
-	if c.iorw.Close != nil {
-		c.iorw.Close()
-	}
+	c.stop(true)
+}
+
+// stop cancels the console context, closes the transport and exits the
+// contexts, wakeReader sends an eol to force a pending Readline to quit.
+func (c *Console) stop(wakeReader bool) {
+	c.stopOnce.Do(func() {
+		c.cancel()
+		c.quit <- true
+		if wakeReader {
+			c.out.Write([]byte(c.eol))
+		}
+		c.flush()
+		if c.iorw.ReadCloser != nil {
+			c.iorw.Close()
+		}
+		// the exit hooks release what the contexts hold for the session
+		c.ExitAllContexts()
+	})
 }
 
 func (c *Console) checkTimeout() error {
 
-	if c.timeout != 0 && time.Now().Sub(c.lastActivitytime) >= c.timeout {
+	if c.timeout != 0 && time.Now().Sub(c.lastActivity()) >= c.timeout {
 		defer func() {
 			c.Print("Timeout Expired")
 			c.Stop()
@@ -284,14 +676,25 @@ func (c *Console) checkTimeoutTask() {
 				log.Debugf("Closing go routine checing timeout for uuid %s", c.uuid)
 				return
 			}
+		case <-c.ctx.Done():
+			timer.Stop()
+			return
 		}
 	}
 }
 
 func (c *Console) task() error {
 
+	defer close(c.done)
 	defer c.onclose()
 
+	c.mu.Lock()
+	c.running = true
+	c.mu.Unlock()
+
+	c.joinSessionManager()
+	defer c.leaveSessionManager()
+
 	c.Print(c.welcome)
 
 	go c.checkTimeoutTask()
@@ -304,7 +707,7 @@ func (c *Console) task() error {
 		default:
 			if c.IsLoginEnabled() && !c.IsUserLogged() {
 				c.PrintWithoutLn("Password?")
-				pwd, e := c.term.ReadPassword("")
+				pwd, e := c.readInput(context.Background(), func() (string, error) { return c.term.ReadPassword("") })
 				if e == io.EOF {
 					return nil
 				}
@@ -315,7 +718,7 @@ func (c *Console) task() error {
 				}
 
 			}
-			line, err := c.term.ReadLine()
+			line, err := c.readInput(context.Background(), c.term.ReadLine)
 			if err == io.EOF {
 				log.Printf("Quit Console , EOF readline - %s", c.uuid)
 				return nil
@@ -324,7 +727,7 @@ func (c *Console) task() error {
 				log.Printf("Quit Console , Err: %s - %s", err.Error(), c.uuid)
 				return err
 			}
-			c.lastActivitytime = time.Now()
+			c.touch()
 
 			if line == "" {
 				c.flush()
@@ -351,28 +754,51 @@ func isValid(v interface{}) bool {
 	return true
 }
 
-func (c *Console) flush() {
-	if isValid(c.iorw.Flusher) {
-		c.iorw.Flush()
+// syncWriter serializes the writes and flushes on the transport, they may come
+// from the console task and from any goroutine printing on the console.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+	f  Flusher
+}
+
+func (s *syncWriter) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.w.Write(b)
+}
+
+func (s *syncWriter) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if isValid(s.f) {
+		return s.f.Flush()
 	}
+	return nil
+}
+
+func (c *Console) flush() {
+	c.out.Flush()
 }
 
 func (c *Console) Print(a ...interface{}) (n int, err error) {
 	defer c.flush()
-	return fmt.Fprintln(c.term, a...)
+	return fmt.Fprintln(c.writer(), a...)
 }
 
 func (c *Console) Printf(format string, a ...interface{}) (n int, err error) {
 	defer c.flush()
-	return fmt.Fprintf(c.term, format, a...)
+	return fmt.Fprintf(c.writer(), format, a...)
 }
 
 func (c *Console) PrintWithoutLn(a ...interface{}) (n int, err error) {
 	defer c.flush()
-	return fmt.Fprint(c.term, a...)
+	return fmt.Fprint(c.writer(), a...)
 }
 
 func (c *Console) Println() (n int, err error) {
 	defer c.flush()
-	return fmt.Fprintln(c.term)
+	return fmt.Fprintln(c.writer())
 }
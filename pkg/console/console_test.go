@@ -0,0 +1,221 @@
+package console_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"github.com/freedreamer82/go-console/pkg/console/consoletest"
+)
+
+const testTimeout = 3 * time.Second
+
+// newCommand returns a command printing lines.
+func newCommand(name string, lines ...string) *console.ConsoleCommand {
+	return console.NewConsoleCommand(name, func(c *console.Console, command *console.ConsoleCommand, args []string) console.CommandError {
+		for _, line := range lines {
+			c.Print(line)
+		}
+		return console.N0_ERR
+	}, "print "+strings.Join(lines, " "))
+}
+
+// echo prints each argument on a line.
+func echo(c *console.Console, command *console.ConsoleCommand, args []string) console.CommandError {
+	for _, arg := range args {
+		c.Print(arg)
+	}
+	return console.N0_ERR
+}
+
+var echoCommand = console.NewConsoleCommand("echo", echo, "print the arguments")
+
+// testClient is the client side of a transport connection: the output of the
+// server is read in background so that expect can wait for it with a timeout.
+type testClient struct {
+	t       *testing.T
+	conn    io.ReadWriteCloser
+	filter  func(b []byte) []byte
+	mu      sync.Mutex
+	out     bytes.Buffer
+	changed chan struct{}
+	closed  bool
+	pos     int
+}
+
+func newTestClient(t *testing.T, conn io.ReadWriteCloser) *testClient {
+	t.Helper()
+
+	cl := &testClient{t: t, conn: conn, changed: make(chan struct{})}
+	t.Cleanup(func() { conn.Close() })
+	go cl.readLoop()
+	return cl
+}
+
+func dialTestClient(t *testing.T, network string, addr string) *testClient {
+	t.Helper()
+
+	conn, err := net.DialTimeout(network, addr, testTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestClient(t, conn)
+}
+
+func (cl *testClient) readLoop() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := cl.conn.Read(buf)
+		cl.mu.Lock()
+		data := buf[:n]
+		if cl.filter != nil {
+			data = cl.filter(data)
+		}
+		cl.out.Write(data)
+		if err != nil {
+			cl.closed = true
+		}
+		close(cl.changed)
+		cl.changed = make(chan struct{})
+		cl.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// wait returns the output not consumed yet once match finds something in it,
+// match returns the end of what it matched.
+func (cl *testClient) wait(what string, match func(pending string) int) string {
+	cl.t.Helper()
+
+	deadline := time.NewTimer(testTimeout)
+	defer deadline.Stop()
+
+	for {
+		cl.mu.Lock()
+		pending := consoletest.Normalize(cl.out.String())[cl.pos:]
+		changed, closed := cl.changed, cl.closed
+		if end := match(pending); end >= 0 {
+			cl.pos += end
+			cl.mu.Unlock()
+			return pending[:end]
+		}
+		cl.mu.Unlock()
+
+		if closed {
+			cl.t.Fatalf("connection closed while waiting for %s, pending output:\n%q", what, pending)
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			cl.t.Fatalf("timeout waiting for %s, pending output:\n%q", what, pending)
+		}
+	}
+}
+
+// expect waits for substr and returns the output up to the end of it.
+func (cl *testClient) expect(substr string) string {
+	cl.t.Helper()
+
+	return cl.wait(substr, func(pending string) int {
+		if idx := strings.Index(pending, substr); idx >= 0 {
+			return idx + len(substr)
+		}
+		return -1
+	})
+}
+
+// expectPrompt waits for the default prompt.
+func (cl *testClient) expectPrompt() {
+	cl.t.Helper()
+
+	cl.wait("prompt", func(pending string) int {
+		if loc := consoletest.DefaultPrompt.FindStringIndex(pending); loc != nil {
+			return loc[1]
+		}
+		return -1
+	})
+}
+
+// expectClosed waits for the server to close the connection and returns the
+// output not consumed yet.
+func (cl *testClient) expectClosed() string {
+	cl.t.Helper()
+
+	return cl.wait("close", func(pending string) int {
+		if cl.closed {
+			return len(pending)
+		}
+		return -1
+	})
+}
+
+func (cl *testClient) send(data string) {
+	cl.t.Helper()
+
+	if _, err := cl.conn.Write([]byte(data)); err != nil {
+		cl.t.Fatalf("send %q: %s", data, err)
+	}
+}
+
+// run sends a command line after the prompt and returns its output, up to the
+// next prompt.
+func (cl *testClient) run(line string) string {
+	cl.t.Helper()
+
+	cl.expectPrompt()
+	cl.send(line + "\r\n")
+	cl.expect(line + "\n")
+
+	var output string
+	cl.wait("prompt after "+line, func(pending string) int {
+		loc := consoletest.DefaultPrompt.FindStringIndex(pending)
+		if loc == nil {
+			return -1
+		}
+		output = pending[:loc[0]]
+		return loc[0]
+	})
+	return output
+}
+
+// serveInBackground runs start and checks that it returns no error once the
+// test ends.
+func serveInBackground(t *testing.T, start func() error, stop func() error) {
+	t.Helper()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- start()
+	}()
+	t.Cleanup(func() {
+		stop()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("serve: %s", err)
+			}
+		case <-time.After(testTimeout):
+			t.Error("server did not stop")
+		}
+	})
+}
+
+// waitFor polls cond until it holds or the test times out.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(testTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
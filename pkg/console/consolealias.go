@@ -0,0 +1,336 @@
+package console
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const maxAliasDepth = 16
+
+// AliasStore persists the aliases of each user.
+type AliasStore interface {
+	LoadAliases(username string) (map[string]string, error)
+	SaveAliases(username string, aliases map[string]string) error
+}
+
+// WithOptionAliasStore loads the aliases of the user when the console needs
+// them and saves them on every change. The aliases of a session without a
+// username are not saved, they would be shared by all such sessions.
+func WithOptionAliasStore(store AliasStore) ConsoleOption {
+	return func(console *Console) {
+		console.SetAliasStore(store)
+	}
+}
+
+// SetAliasStore sets the alias store as WithOptionAliasStore, the aliases are
+// loaded again from it.
+func (c *Console) SetAliasStore(store AliasStore) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.aliasStore = store
+	c.aliases = nil
+}
+
+// AddAlias defines name as a shortcut for expansion. The expansion can be a
+// macro of several commands separated by ";" and refer to the arguments with
+// $1 ... $9 and $@, without references the arguments are appended to it.
+// An alias cannot take the name of a command.
+func (c *Console) AddAlias(name string, expansion string) error {
+	if name == "" || strings.ContainsAny(name, " ;$") {
+		return fmt.Errorf("invalid alias name %q", name)
+	}
+	if c.isCommandName(name) {
+		return fmt.Errorf("%s is a command", name)
+	}
+
+	c.loadAliases()
+	c.mu.Lock()
+	c.aliases[name] = expansion
+	c.mu.Unlock()
+	return c.saveAliases()
+}
+
+func (c *Console) RemoveAlias(name string) error {
+	c.loadAliases()
+	c.mu.Lock()
+	_, ok := c.aliases[name]
+	delete(c.aliases, name)
+	c.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("alias %s not found", name)
+	}
+	return c.saveAliases()
+}
+
+// GetAliases returns a copy of the aliases of the console.
+func (c *Console) GetAliases() map[string]string {
+	c.loadAliases()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	aliases := make(map[string]string, len(c.aliases))
+	for name, expansion := range c.aliases {
+		aliases[name] = expansion
+	}
+	return aliases
+}
+
+// isCommandName tells whether name is a command of the console or of the
+// active contexts, at any user level.
+func (c *Console) isCommandName(name string) bool {
+	c.mu.Lock()
+	cmds := append([]*ConsoleCommand{c.exitCmd, c.endCmd}, c.commands...)
+	for _, context := range c.contexts {
+		cmds = append(cmds, context.commands...)
+	}
+	c.mu.Unlock()
+
+	for _, cmd := range cmds {
+		if cmd.GetCommand() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// loadAliases reads the aliases of the current user from the store, the first
+// time or when the user has changed.
+func (c *Console) loadAliases() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	user := c.username
+	if c.aliases != nil && c.aliasesOwner == user {
+		return
+	}
+
+	c.aliases = make(map[string]string)
+	c.aliasesOwner = user
+	if c.aliasStore != nil && user != "" {
+		aliases, err := c.aliasStore.LoadAliases(user)
+		if err != nil {
+			log.Warnf("Loading aliases of %s failed: %s", user, err)
+		}
+		for name, expansion := range aliases {
+			c.aliases[name] = expansion
+		}
+	}
+}
+
+func (c *Console) saveAliases() error {
+	c.mu.Lock()
+	user, store := c.username, c.aliasStore
+	c.mu.Unlock()
+
+	if store == nil || user == "" {
+		return nil
+	}
+	return store.SaveAliases(user, c.GetAliases())
+}
+
+// expandAlias returns the commands name expands to with the arguments
+// substituted, ok is false when name is not an alias.
+func (c *Console) expandAlias(name string, args []string) (commands []string, ok bool) {
+	c.mu.Lock()
+	expansion, ok := c.aliases[name]
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	referenced := false
+	var b strings.Builder
+	for i := 0; i < len(expansion); i++ {
+		ch := expansion[i]
+		if ch != '$' || i+1 == len(expansion) {
+			b.WriteByte(ch)
+			continue
+		}
+		next := expansion[i+1]
+		switch {
+		case next == '@':
+			b.WriteString(strings.Join(args, " "))
+		case next >= '1' && next <= '9':
+			if n := int(next - '0'); n <= len(args) {
+				b.WriteString(args[n-1])
+			}
+		default:
+			b.WriteByte(ch)
+			continue
+		}
+		referenced = true
+		i++
+	}
+	line := b.String()
+	if !referenced && len(args) > 0 {
+		line += " " + strings.Join(args, " ")
+	}
+
+	for _, cmd := range strings.Split(line, ";") {
+		if cmd = strings.TrimSpace(cmd); cmd != "" {
+			commands = append(commands, cmd)
+		}
+	}
+	return commands, true
+}
+
+// execExpanded runs a command line expanding the aliases, expanding lists the
+// aliases being expanded so that an alias is never expanded inside itself.
+// The commands win over the aliases, also those loaded from the store before
+// the command was added.
+func (c *Console) execExpanded(line string, expanding []string) CommandError {
+
+	subs := strings.Split(line, " ")
+	if c.isCommandName(subs[0]) {
+		return c.dispatch(subs[0], subs[1:])
+	}
+	for _, name := range expanding {
+		if name == subs[0] {
+			return c.dispatch(subs[0], subs[1:])
+		}
+	}
+
+	if len(expanding) < maxAliasDepth {
+		c.loadAliases()
+		if commands, ok := c.expandAlias(subs[0], subs[1:]); ok {
+			expanding = append(expanding, subs[0])
+			for _, cmd := range commands {
+				if err := c.execPipeline(cmd, expanding); err != N0_ERR {
+					return err
+				}
+			}
+			return N0_ERR
+		}
+	}
+
+	return c.dispatch(subs[0], subs[1:])
+}
+
+// unquote removes the quotes around the expansion of an alias.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func (c *Console) cmdAlias(console *Console, command *ConsoleCommand, args []string) CommandError {
+
+	if len(args) == 0 {
+		aliases := c.GetAliases()
+		names := make([]string, 0, len(aliases))
+		for name := range aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			c.Print(fmt.Sprintf("alias %s=%s", name, strconv.Quote(aliases[name])))
+		}
+		return N0_ERR
+	}
+
+	// both "alias ll log list" and "alias ll='log list'"
+	name, expansion := args[0], strings.Join(args[1:], " ")
+	if idx := strings.Index(name, "="); idx > 0 {
+		name, expansion = name[:idx], strings.TrimSpace(name[idx+1:]+" "+expansion)
+	} else if len(args) == 1 {
+		aliases := c.GetAliases()
+		if expansion, ok := aliases[name]; ok {
+			c.Print(fmt.Sprintf("alias %s=%s", name, strconv.Quote(expansion)))
+			return N0_ERR
+		}
+		return CommandError(fmt.Sprintf("alias %s not found", name))
+	}
+
+	expansion = unquote(expansion)
+	if expansion == "" {
+		return BAD_FORMAT
+	}
+	if err := c.AddAlias(name, expansion); err != nil {
+		return CommandError(err.Error())
+	}
+	return N0_ERR
+}
+
+func (c *Console) cmdUnalias(console *Console, command *ConsoleCommand, args []string) CommandError {
+
+	if len(args) != 1 {
+		return BAD_FORMAT
+	}
+	if args[0] == "-a" {
+		for name := range c.GetAliases() {
+			c.RemoveAlias(name)
+		}
+		return N0_ERR
+	}
+	if err := c.RemoveAlias(args[0]); err != nil {
+		return CommandError(err.Error())
+	}
+	return N0_ERR
+}
+
+// fileAliasStore keeps the aliases of each user in a json file.
+type fileAliasStore struct {
+	dir string
+}
+
+// NewFileAliasStore stores the aliases in dir, one <username>.aliases file per
+// user.
+func NewFileAliasStore(dir string) AliasStore {
+	return &fileAliasStore{dir: dir}
+}
+
+func (s *fileAliasStore) path(username string) (string, error) {
+	if username == "" || username != filepath.Base(username) || strings.HasPrefix(username, ".") {
+		return "", fmt.Errorf("invalid username %q", username)
+	}
+	return filepath.Join(s.dir, username+".aliases"), nil
+}
+
+func (s *fileAliasStore) LoadAliases(username string) (map[string]string, error) {
+	path, err := s.path(username)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	aliases := make(map[string]string)
+	err = json.Unmarshal(data, &aliases)
+	return aliases, err
+}
+
+func (s *fileAliasStore) SaveAliases(username string, aliases map[string]string) error {
+	path, err := s.path(username)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(aliases, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+
+	// write and rename, a crash never leaves a truncated file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
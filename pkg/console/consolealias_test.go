@@ -0,0 +1,141 @@
+package console_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"github.com/freedreamer82/go-console/pkg/console/consoletest"
+)
+
+func TestAlias(t *testing.T) {
+	tests := []struct {
+		name   string
+		define []string
+		line   string
+		want   string
+	}{
+		{"simple", []string{"alias hi echo hello"}, "hi", "hello\n"},
+		{"quoted", []string{"alias hi='echo hello world'"}, "hi", "hello\nworld\n"},
+		{"arguments appended", []string{"alias e echo"}, "e one two", "one\ntwo\n"},
+		{"positional arguments", []string{"alias swap='echo $2 $1'"}, "swap one two", "two\none\n"},
+		{"all arguments", []string{"alias all='echo [ $@ ]'"}, "all one two", "[\none\ntwo\n]\n"},
+		{"missing argument", []string{"alias second='echo $2'"}, "second one", ""},
+		{"macro", []string{"alias both='echo one; echo two'"}, "both", "one\ntwo\n"},
+		{"alias of alias", []string{"alias a1 echo one", "alias a2 a1"}, "a2", "one\n"},
+		{"self reference", []string{"alias e='e loud'", "alias e2 e"}, "e2 x", string(console.CMD_NOT_FOUND) + "\n"},
+		{"command name", nil, "alias echo='echo loud'", "echo is a command\n"},
+		{"builtin name", nil, "alias help echo", "help is a command\n"},
+		{"exit", nil, "alias exit echo", "exit is a command\n"},
+		{"root builtin", nil, "alias who echo", "who is a command\n"},
+		{"mutual recursion", []string{"alias ping pong", "alias pong ping"}, "ping", string(console.CMD_NOT_FOUND) + "\n"},
+		{"macro stops at error", []string{"alias m='nosuch; echo after'"}, "m", string(console.CMD_NOT_FOUND) + "\n"},
+		{"show", []string{"alias hi echo hello"}, "alias hi", "alias hi=\"echo hello\"\n"},
+		{"list", []string{"alias b echo b", "alias a echo a"}, "alias", "alias a=\"echo a\"\nalias b=\"echo b\"\n"},
+		{"unknown", nil, "alias nosuch", "alias nosuch not found\n"},
+		{"invalid name", nil, "alias a$b echo", "invalid alias name \"a$b\"\n"},
+		{"empty expansion", nil, "alias a=''", string(console.BAD_FORMAT) + "\n"},
+		{"unalias", []string{"alias hi echo hello", "unalias hi"}, "hi", string(console.CMD_NOT_FOUND) + "\n"},
+		{"unalias all", []string{"alias a echo a", "alias b echo b", "unalias -a"}, "alias", ""},
+		{"unalias unknown", nil, "unalias nosuch", "alias nosuch not found\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := consoletest.NewSession(t, func(c *console.Console) {
+				c.AddConsoleCommand(echoCommand)
+			})
+			for _, line := range tt.define {
+				if out := s.Run(line); out != "" {
+					t.Fatalf("%s: %q", line, out)
+				}
+			}
+			if got := s.Run(tt.line); got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileAliasStore(t *testing.T) {
+	dir := t.TempDir()
+	store := console.NewFileAliasStore(dir)
+
+	tests := []struct {
+		name     string
+		user     string
+		password bool
+		define   string
+		line     string
+		want     string
+	}{
+		{"no user", "", false, "alias hi echo anonymous", "hi", "anonymous\n"},
+		{"no user not saved", "", false, "", "hi", string(console.CMD_NOT_FOUND) + "\n"},
+		{"other user", "alice", false, "alias hi echo alice", "hi", "alice\n"},
+		{"other user loads", "alice", false, "", "hi", "alice\n"},
+		{"users are separated", "bob", false, "", "hi", string(console.CMD_NOT_FOUND) + "\n"},
+		{"invalid user name", "../x", false, "alias x echo x", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := consoletest.NewSession(t, func(c *console.Console) {
+				c.AddConsoleCommand(echoCommand)
+				if tt.user != "" {
+					c.Authenticate(tt.user, console.Root)
+				}
+			}, console.WithOptionAliasStore(store))
+
+			if tt.define != "" {
+				out := s.Run(tt.define)
+				if tt.line == "" {
+					if out == "" {
+						t.Errorf("%s saved for user %q", tt.define, tt.user)
+					}
+					return
+				}
+			}
+			if got := s.Run(tt.line); got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+
+	names, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(names) != 1 || filepath.Base(names[0]) != "alice.aliases" {
+		t.Fatalf("store files %v", names)
+	}
+	fi, err := os.Stat(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("%s mode %s", names[0], fi.Mode())
+	}
+}
+
+func TestAliasLoadedBeforeCommand(t *testing.T) {
+	dir := t.TempDir()
+	store := console.NewFileAliasStore(dir)
+	if err := store.SaveAliases("alice", map[string]string{"echo": "nosuch"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := consoletest.NewSession(t, func(c *console.Console) {
+		c.AddConsoleCommand(echoCommand)
+		c.Authenticate("alice", console.Root)
+	}, console.WithOptionAliasStore(store))
+	if got := s.Run("echo x"); got != "x\n" {
+		t.Errorf("echo x = %q", got)
+	}
+}
+
+func TestAliasGuestShadowing(t *testing.T) {
+	s := consoletest.NewSession(t, func(c *console.Console) {
+		c.Authenticate("", console.Guest)
+	})
+	for _, name := range []string{"source", "wall", "help", "whoAmI"} {
+		if got, want := s.Run("alias "+name+" alias"), name+" is a command\n"; got != want {
+			t.Errorf("alias %s = %q, want %q", name, got, want)
+		}
+	}
+}
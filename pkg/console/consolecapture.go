@@ -0,0 +1,49 @@
+package console
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+)
+
+// captureIO is the transport of the consoles running commands on behalf of a
+// request (http, json-rpc): the output is kept in memory and there is no input.
+type captureIO struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *captureIO) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (b *captureIO) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *captureIO) Close() error {
+	return nil
+}
+
+// Output returns what has been printed so far with plain "\n" line endings.
+func (b *captureIO) Output() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return strings.ReplaceAll(b.buf.String(), "\r", "")
+}
+
+func newCaptureConsole(opts ...ConsoleOption) (*Console, *captureIO) {
+	capture := &captureIO{}
+	consoleIO := struct {
+		io.ReadCloser
+		io.Writer
+		Flusher
+	}{capture, capture, nil}
+
+	return NewConsole(consoleIO, opts...), capture
+}
@@ -3,16 +3,20 @@ package console
 type ConsoleCommandHandler func(console *Console, command *ConsoleCommand, args []string) CommandError
 
 type ConsoleCommand struct {
-	handler   ConsoleCommandHandler
-	help      string
-	cmd       string
-	levelUser User
+	handler    ConsoleCommandHandler
+	help       string
+	cmd        string
+	levelUser  User
+	builtin    bool
+	structured bool
 }
 
 type CommandError string
 
 const CMD_NOT_FOUND CommandError = "Command Not Found!"
 const BAD_FORMAT CommandError = "Bad Format!"
+const CMD_REFUSED CommandError = "Console is shutting down!"
+const SCRIPT_FAILED CommandError = "Script Failed!"
 const N0_ERR CommandError = ""
 
 func NewConsoleCommand(cmd string, handler ConsoleCommandHandler, help string) *ConsoleCommand {
@@ -35,3 +39,13 @@ func (c *ConsoleCommand) GetUserLevel() User {
 func (c *ConsoleCommand) SetUserLevel(level User) {
 	c.levelUser = level
 }
+
+// SetStructuredOutput marks a command printing its results with PrintResult,
+// it then accepts --output to choose their format.
+func (c *ConsoleCommand) SetStructuredOutput(enabled bool) {
+	c.structured = enabled
+}
+
+func (c *ConsoleCommand) HasStructuredOutput() bool {
+	return c.structured
+}
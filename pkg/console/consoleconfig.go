@@ -0,0 +1,609 @@
+package console
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const CONFIG_CHANGED CommandError = "Running Config Changed, Discard The Candidate!"
+const CONFIG_VERSION_NOT_FOUND CommandError = "Config Version Not Found!"
+
+const defaultConfigHistory = 50
+const defaultConfirmMinutes = 10
+
+// confirmUnit is the unit of the commit confirmed delay, changed by the tests.
+var confirmUnit = time.Minute
+
+var configFileName = regexp.MustCompile(`^config\.(\d+)\.json$`)
+
+// confirmFileName is kept while a commit confirmed waits for the confirmation,
+// it holds the version to restore when the manager starts again.
+const confirmFileName = "confirm.json"
+
+// ConfigApplyFunc applies a whole configuration to the system, when it fails
+// the running configuration is left unchanged. The commits wait for it, one
+// at a time, while the sessions keep editing their candidates.
+type ConfigApplyFunc func(config map[string]string) error
+
+// ConfigVersion is a committed configuration, as saved in the history.
+type ConfigVersion struct {
+	Version int               `json:"version"`
+	Time    time.Time         `json:"time"`
+	User    string            `json:"user,omitempty"`
+	Comment string            `json:"comment,omitempty"`
+	Config  map[string]string `json:"config"`
+}
+
+// pendingConfirm is the content of the confirm file.
+type pendingConfirm struct {
+	Version  int           `json:"version"`
+	Previous ConfigVersion `json:"previous"`
+}
+
+// configCandidate is the configuration edited by a session, base is the
+// version of the running configuration it was copied from.
+type configCandidate struct {
+	base   int
+	config map[string]string
+}
+
+// ConfigManager holds the running configuration and the candidates of the
+// sessions editing it. The set commands change the candidate of the session,
+// commit applies it and saves it in the history dir.
+type ConfigManager struct {
+	mu              sync.Mutex
+	commitMu        sync.Mutex
+	dir             string
+	apply           ConfigApplyFunc
+	history         int
+	running         ConfigVersion
+	candidates      map[*Console]*configCandidate
+	confirmTimer    *time.Timer
+	confirmGen      int
+	confirmPrevious ConfigVersion
+}
+
+type ConfigManagerOption func(m *ConfigManager)
+
+// WithOptionConfigHistory sets how many committed versions are kept on disk,
+// 50 by default.
+func WithOptionConfigHistory(versions int) ConfigManagerOption {
+	return func(m *ConfigManager) {
+		m.history = versions
+	}
+}
+
+// NewConfigManager creates the manager, the running configuration is the
+// latest version found in dir. apply is called on commit and rollback. A
+// commit confirmed left unconfirmed by a crash or a reboot is rolled back
+// here, the restored version is the running one, apply is not called.
+func NewConfigManager(dir string, apply ConfigApplyFunc, opts ...ConfigManagerOption) (*ConfigManager, error) {
+	m := &ConfigManager{dir: dir, apply: apply, history: defaultConfigHistory,
+		candidates: make(map[*Console]*configCandidate)}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	versions, err := m.versions()
+	if err != nil {
+		return nil, err
+	}
+	m.running = ConfigVersion{Config: map[string]string{}}
+	if len(versions) > 0 {
+		v, err := m.load(versions[0])
+		if err != nil {
+			return nil, err
+		}
+		m.running = *v
+	}
+	if err := m.restoreUnconfirmed(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// restoreUnconfirmed rolls back the commit confirmed of the confirm file.
+func (m *ConfigManager) restoreUnconfirmed() error {
+	data, err := os.ReadFile(filepath.Join(m.dir, confirmFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var pending pendingConfirm
+	if err := json.Unmarshal(data, &pending); err != nil {
+		return err
+	}
+
+	// the unconfirmed version may not have been saved
+	if m.running.Version >= pending.Version {
+		log.Warnf("Config commit %d not confirmed before the restart, rolled back to version %d",
+			pending.Version, pending.Previous.Version)
+		m.running = ConfigVersion{Version: m.running.Version + 1, Time: time.Now(),
+			Comment: fmt.Sprintf("rollback of unconfirmed version %d", pending.Version),
+			Config:  copyConfig(pending.Previous.Config)}
+		if err := m.save(&m.running); err != nil {
+			return err
+		}
+	}
+	return m.removeConfirmFile()
+}
+
+// Running returns a copy of the running configuration.
+func (m *ConfigManager) Running() map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return copyConfig(m.running.Config)
+}
+
+func (m *ConfigManager) RunningVersion() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.running.Version
+}
+
+// NewContext creates the configuration context: set, delete, show, commit,
+// discard and rollback edit the candidate of the session, which is dropped
+// when the context is exited.
+func (m *ConfigManager) NewContext(name string, promptSuffix string) *CommandContext {
+	cc := NewCommandContext(name, promptSuffix)
+	cc.AddConsoleCommand(NewConsoleCommand("set", m.cmdSet, "set key value, change the candidate"))
+	cc.AddConsoleCommand(NewConsoleCommand("delete", m.cmdDelete, "delete key, remove a key from the candidate"))
+	show := NewConsoleCommand("show", m.cmdShow, "show [candidate|running|diff|history]")
+	show.SetStructuredOutput(true)
+	cc.AddConsoleCommand(show)
+	cc.AddConsoleCommand(NewConsoleCommand("commit", m.cmdCommit, "commit [confirmed [minutes]], apply the candidate"))
+	cc.AddConsoleCommand(NewConsoleCommand("discard", m.cmdDiscard, "drop the changes of the candidate"))
+	cc.AddConsoleCommand(NewConsoleCommand("rollback", m.cmdRollback, "rollback N, load the Nth previous version in the candidate"))
+	cc.AddCallbackOnEnter(func(console *Console, context *CommandContext) {
+		m.candidate(console)
+	})
+	cc.AddCallbackOnExit(func(console *Console, context *CommandContext) {
+		m.mu.Lock()
+		cand := m.candidates[console]
+		delete(m.candidates, console)
+		changed := cand != nil && !equalConfig(cand.config, m.running.Config)
+		m.mu.Unlock()
+
+		if changed {
+			console.PrintWarning("uncommitted changes discarded")
+		}
+	})
+	return cc
+}
+
+// candidate returns the candidate of the session, a copy of the running
+// configuration when it has none.
+func (m *ConfigManager) candidate(console *Console) *configCandidate {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cand, ok := m.candidates[console]
+	if !ok {
+		cand = &configCandidate{base: m.running.Version, config: copyConfig(m.running.Config)}
+		m.candidates[console] = cand
+	}
+	return cand
+}
+
+func (m *ConfigManager) cmdSet(console *Console, command *ConsoleCommand, args []string) CommandError {
+	if len(args) < 2 {
+		return BAD_FORMAT
+	}
+	cand := m.candidate(console)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cand.config[args[0]] = strings.Join(args[1:], " ")
+	return N0_ERR
+}
+
+func (m *ConfigManager) cmdDelete(console *Console, command *ConsoleCommand, args []string) CommandError {
+	if len(args) != 1 {
+		return BAD_FORMAT
+	}
+	cand := m.candidate(console)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := cand.config[args[0]]; !ok {
+		return CommandError(fmt.Sprintf("%s is not set", args[0]))
+	}
+	delete(cand.config, args[0])
+	return N0_ERR
+}
+
+func (m *ConfigManager) cmdShow(console *Console, command *ConsoleCommand, args []string) CommandError {
+	what := "candidate"
+	if len(args) == 1 {
+		what = args[0]
+	} else if len(args) > 1 {
+		return BAD_FORMAT
+	}
+	cand := m.candidate(console)
+
+	m.mu.Lock()
+	candidate := configLines(cand.config)
+	running := configLines(m.running.Config)
+	m.mu.Unlock()
+
+	switch what {
+	case "candidate":
+		for _, l := range candidate {
+			console.Print(l)
+		}
+	case "running":
+		for _, l := range running {
+			console.Print(l)
+		}
+	case "diff":
+		hunks := unifiedDiff(running, candidate)
+		if len(hunks) == 0 {
+			return N0_ERR
+		}
+		console.Print("--- running")
+		console.Print("+++ candidate")
+		for _, l := range hunks {
+			console.Print(l)
+		}
+	case "history":
+		versions, err := m.History()
+		if err != nil {
+			return CommandError(err.Error())
+		}
+		t := NewTable("rollback", "version", "time", "user", "comment")
+		for i, v := range versions {
+			t.AddRow(i, v.Version, v.Time.Format(time.RFC3339), v.User, v.Comment)
+		}
+		return console.PrintResult(t)
+	default:
+		return BAD_FORMAT
+	}
+	return N0_ERR
+}
+
+func (m *ConfigManager) cmdCommit(console *Console, command *ConsoleCommand, args []string) CommandError {
+	var confirmIn time.Duration
+	switch {
+	case len(args) == 0:
+	case args[0] == "confirmed" && len(args) <= 2:
+		minutes := defaultConfirmMinutes
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return BAD_FORMAT
+			}
+			minutes = n
+		}
+		confirmIn = time.Duration(minutes) * confirmUnit
+	default:
+		return BAD_FORMAT
+	}
+	cand := m.candidate(console)
+
+	msg, cmdErr := m.commit(console.GetUsername(), cand, confirmIn)
+	if cmdErr != N0_ERR {
+		return cmdErr
+	}
+	console.PrintSuccess(msg)
+	return N0_ERR
+}
+
+func (m *ConfigManager) cmdDiscard(console *Console, command *ConsoleCommand, args []string) CommandError {
+	if len(args) != 0 {
+		return BAD_FORMAT
+	}
+	cand := m.candidate(console)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cand.base = m.running.Version
+	cand.config = copyConfig(m.running.Config)
+	return N0_ERR
+}
+
+func (m *ConfigManager) cmdRollback(console *Console, command *ConsoleCommand, args []string) CommandError {
+	if len(args) != 1 {
+		return BAD_FORMAT
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return BAD_FORMAT
+	}
+	versions, err := m.versions()
+	if err != nil {
+		return CommandError(err.Error())
+	}
+	if n >= len(versions) {
+		return CONFIG_VERSION_NOT_FOUND
+	}
+	v, err := m.load(versions[n])
+	if err != nil {
+		return CommandError(err.Error())
+	}
+	cand := m.candidate(console)
+
+	m.mu.Lock()
+	cand.base = m.running.Version
+	cand.config = copyConfig(v.Config)
+	m.mu.Unlock()
+
+	console.Print(fmt.Sprintf("version %d loaded, commit to apply it", v.Version))
+	return N0_ERR
+}
+
+// commit applies the candidate. With confirmIn the previous configuration is
+// restored unless another commit confirms it before confirmIn elapses.
+func (m *ConfigManager) commit(user string, cand *configCandidate, confirmIn time.Duration) (string, CommandError) {
+	m.commitMu.Lock()
+	defer m.commitMu.Unlock()
+
+	m.mu.Lock()
+	if cand.base != m.running.Version {
+		m.mu.Unlock()
+		return "", CONFIG_CHANGED
+	}
+
+	if equalConfig(cand.config, m.running.Config) {
+		defer m.mu.Unlock()
+		switch {
+		case m.confirmTimer != nil && confirmIn == 0:
+			m.stopConfirm()
+			return "commit confirmed", N0_ERR
+		case m.confirmTimer != nil:
+			m.startConfirm(confirmIn)
+			return fmt.Sprintf("rollback in %s unless confirmed", confirmIn), N0_ERR
+		}
+		return "no changes", N0_ERR
+	}
+
+	config := copyConfig(cand.config)
+	previous := m.running
+	m.mu.Unlock()
+
+	// apply runs without the lock, it can read the running configuration and
+	// a slow one does not block the sessions, commitMu keeps the order
+	if err := m.apply(copyConfig(config)); err != nil {
+		return "", CommandError(fmt.Sprintf("commit failed: %s", err))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.running = ConfigVersion{Version: previous.Version + 1, Time: time.Now(), User: user, Config: config}
+	cand.base = m.running.Version
+
+	msg := fmt.Sprintf("version %d committed", m.running.Version)
+	if confirmIn > 0 {
+		if m.confirmTimer == nil {
+			m.confirmPrevious = previous
+		}
+		// written before the version, a restart always finds it
+		if err := m.writeConfirmFile(); err != nil {
+			log.Errorf("Config confirm file not saved: %s", err)
+		}
+		m.startConfirm(confirmIn)
+		msg += fmt.Sprintf(", rollback in %s unless confirmed", confirmIn)
+	} else if m.confirmTimer != nil {
+		m.stopConfirm()
+	}
+
+	if err := m.save(&m.running); err != nil {
+		log.Errorf("Config version %d not saved: %s", m.running.Version, err)
+		return "", CommandError(fmt.Sprintf("%s but not saved: %s", msg, err))
+	}
+	return msg, N0_ERR
+}
+
+// startConfirm (re)arms the automatic rollback, it is called with the lock
+// held.
+func (m *ConfigManager) startConfirm(after time.Duration) {
+	if m.confirmTimer != nil {
+		m.confirmTimer.Stop()
+	}
+	m.confirmGen++
+	gen := m.confirmGen
+	m.confirmTimer = time.AfterFunc(after, func() { m.confirmExpired(gen) })
+}
+
+func (m *ConfigManager) stopConfirm() {
+	m.confirmTimer.Stop()
+	m.confirmTimer = nil
+	m.confirmGen++
+	if err := m.removeConfirmFile(); err != nil {
+		log.Errorf("Config confirm file not removed: %s", err)
+	}
+}
+
+// confirmExpired restores the configuration preceding the unconfirmed commit.
+func (m *ConfigManager) confirmExpired(gen int) {
+	m.commitMu.Lock()
+	defer m.commitMu.Unlock()
+
+	m.mu.Lock()
+	if gen != m.confirmGen {
+		m.mu.Unlock()
+		return
+	}
+	m.confirmTimer = nil
+	unconfirmed := m.running.Version
+	previous := m.confirmPrevious
+	m.mu.Unlock()
+
+	// on failure the confirm file is left, the next start rolls back
+	if err := m.apply(copyConfig(previous.Config)); err != nil {
+		log.Errorf("Config rollback of unconfirmed version %d failed: %s", unconfirmed, err)
+		return
+	}
+	log.Warnf("Config commit %d not confirmed, rolled back to version %d", unconfirmed, previous.Version)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.running = ConfigVersion{Version: unconfirmed + 1, Time: time.Now(),
+		Comment: fmt.Sprintf("rollback of unconfirmed version %d", unconfirmed), Config: copyConfig(previous.Config)}
+	if err := m.save(&m.running); err != nil {
+		log.Errorf("Config version %d not saved: %s", m.running.Version, err)
+		return
+	}
+	if err := m.removeConfirmFile(); err != nil {
+		log.Errorf("Config confirm file not removed: %s", err)
+	}
+}
+
+// writeConfirmFile records the commit confirmed in progress, it is called
+// with the lock held.
+func (m *ConfigManager) writeConfirmFile() error {
+	data, err := json.MarshalIndent(pendingConfirm{Version: m.running.Version, Previous: m.confirmPrevious}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(m.dir, confirmFileName), data)
+}
+
+func (m *ConfigManager) removeConfirmFile() error {
+	err := os.Remove(filepath.Join(m.dir, confirmFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// History returns the committed versions on disk, the most recent first.
+func (m *ConfigManager) History() ([]*ConfigVersion, error) {
+	versions, err := m.versions()
+	if err != nil {
+		return nil, err
+	}
+	history := make([]*ConfigVersion, 0, len(versions))
+	for _, n := range versions {
+		v, err := m.load(n)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, v)
+	}
+	return history, nil
+}
+
+func (m *ConfigManager) path(version int) string {
+	return filepath.Join(m.dir, fmt.Sprintf("config.%06d.json", version))
+}
+
+// versions returns the version numbers on disk, the most recent first.
+func (m *ConfigManager) versions() ([]int, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return nil, err
+	}
+	var versions []int
+	for _, e := range entries {
+		if match := configFileName.FindStringSubmatch(e.Name()); match != nil {
+			n, _ := strconv.Atoi(match[1])
+			versions = append(versions, n)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	return versions, nil
+}
+
+func (m *ConfigManager) load(version int) (*ConfigVersion, error) {
+	data, err := os.ReadFile(m.path(version))
+	if err != nil {
+		return nil, err
+	}
+	var v ConfigVersion
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	if v.Config == nil {
+		v.Config = map[string]string{}
+	}
+	return &v, nil
+}
+
+// save writes the version and removes the ones beyond the history size.
+func (m *ConfigManager) save(v *ConfigVersion) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(m.path(v.Version), data); err != nil {
+		return err
+	}
+
+	versions, err := m.versions()
+	if err != nil {
+		return err
+	}
+	for i := m.history; i < len(versions) && m.history > 0; i++ {
+		if err := os.Remove(m.path(versions[i])); err != nil {
+			log.Warnf("Config version %d not removed: %s", versions[i], err)
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes and renames, a crash never leaves a truncated file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func copyConfig(config map[string]string) map[string]string {
+	c := make(map[string]string, len(config))
+	for k, v := range config {
+		c[k] = v
+	}
+	return c
+}
+
+func equalConfig(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
+
+// configLines renders the configuration as the set commands creating it.
+func configLines(config map[string]string) []string {
+	keys := make([]string, 0, len(config))
+	for k := range config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, len(keys))
+	for i, k := range keys {
+		lines[i] = fmt.Sprintf("set %s %s", k, config[k])
+	}
+	return lines
+}
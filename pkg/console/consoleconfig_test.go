@@ -0,0 +1,370 @@
+package console_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"github.com/freedreamer82/go-console/pkg/console/consoletest"
+)
+
+// testSystem records the configurations applied by the manager.
+type testSystem struct {
+	mu      sync.Mutex
+	applied []map[string]string
+	fail    error
+}
+
+func (s *testSystem) apply(config map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fail != nil {
+		return s.fail
+	}
+	s.applied = append(s.applied, config)
+	return nil
+}
+
+func (s *testSystem) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.applied)
+}
+
+// newConfigSession starts a session with a "configure" command entering the
+// context of m.
+func newConfigSession(t *testing.T, m *console.ConfigManager) *consoletest.Session {
+	config := m.NewContext("config", "(config)")
+	return consoletest.NewSession(t, func(c *console.Console) {
+		c.AddConsoleCommand(console.NewContextCommand("configure", config, "enter the configuration mode"))
+	})
+}
+
+// runLines runs the lines and returns their output, one after the other.
+func runLines(s *consoletest.Session, lines ...string) string {
+	var out string
+	for _, line := range lines {
+		out += s.Run(line)
+	}
+	return out
+}
+
+func TestConfigManager(t *testing.T) {
+	tests := []struct {
+		name        string
+		fail        error
+		lines       []string
+		want        string
+		wantRunning map[string]string
+		wantApplied int
+	}{
+		{name: "set", lines: []string{"set hostname r1", "set motd hello world", "show"},
+			want: "set hostname r1\nset motd hello world\n", wantRunning: map[string]string{}},
+		{name: "show candidate", lines: []string{"set hostname r1", "show candidate"}, want: "set hostname r1\n",
+			wantRunning: map[string]string{}},
+		{name: "set replaces", lines: []string{"set hostname r1", "set hostname r2", "show"}, want: "set hostname r2\n",
+			wantRunning: map[string]string{}},
+		{name: "set without value", lines: []string{"set hostname"}, want: string(console.BAD_FORMAT) + "\n",
+			wantRunning: map[string]string{}},
+		{name: "delete", lines: []string{"set hostname r1", "set ntp pool", "delete ntp", "show"}, want: "set hostname r1\n",
+			wantRunning: map[string]string{}},
+		{name: "delete unset key", lines: []string{"delete ntp"}, want: "ntp is not set\n", wantRunning: map[string]string{}},
+		{name: "show running", lines: []string{"set hostname r1", "show running"}, want: "", wantRunning: map[string]string{}},
+		{name: "show diff", lines: []string{"set b 2", "commit", "set a 1", "set b 3", "show diff"},
+			want:        "version 1 committed\n--- running\n+++ candidate\n@@ -1,1 +1,2 @@\n-set b 2\n+set a 1\n+set b 3\n",
+			wantRunning: map[string]string{"b": "2"}, wantApplied: 1},
+		{name: "show diff without changes", lines: []string{"show diff"}, want: "", wantRunning: map[string]string{}},
+		{name: "show bad argument", lines: []string{"show everything"}, want: string(console.BAD_FORMAT) + "\n",
+			wantRunning: map[string]string{}},
+		{name: "commit", lines: []string{"set hostname r1", "commit", "show running", "show diff"},
+			want: "version 1 committed\nset hostname r1\n", wantRunning: map[string]string{"hostname": "r1"}, wantApplied: 1},
+		{name: "commit without changes", lines: []string{"commit"}, want: "no changes\n", wantRunning: map[string]string{}},
+		{name: "commit failing", fail: errors.New("boom"), lines: []string{"set hostname r1", "commit", "show"},
+			want: "commit failed: boom\nset hostname r1\n", wantRunning: map[string]string{}},
+		{name: "commit bad argument", lines: []string{"set hostname r1", "commit now"}, want: string(console.BAD_FORMAT) + "\n",
+			wantRunning: map[string]string{}},
+		{name: "commit confirmed bad minutes", lines: []string{"set hostname r1", "commit confirmed 0"},
+			want: string(console.BAD_FORMAT) + "\n", wantRunning: map[string]string{}},
+		{name: "discard", lines: []string{"set a 1", "commit", "set a 2", "set b 3", "discard", "show"},
+			want: "version 1 committed\nset a 1\n", wantRunning: map[string]string{"a": "1"}, wantApplied: 1},
+		{name: "rollback", lines: []string{"set a 1", "commit", "set a 2", "commit", "rollback 1", "show diff", "commit"},
+			want: "version 1 committed\nversion 2 committed\nversion 1 loaded, commit to apply it\n" +
+				"--- running\n+++ candidate\n@@ -1,1 +1,1 @@\n-set a 2\n+set a 1\nversion 3 committed\n",
+			wantRunning: map[string]string{"a": "1"}, wantApplied: 3},
+		{name: "rollback 0", lines: []string{"set a 1", "commit", "set a 2", "rollback 0", "show"},
+			want:        "version 1 committed\nversion 1 loaded, commit to apply it\nset a 1\n",
+			wantRunning: map[string]string{"a": "1"}, wantApplied: 1},
+		{name: "rollback too far", lines: []string{"set a 1", "commit", "rollback 1"},
+			want:        "version 1 committed\n" + string(console.CONFIG_VERSION_NOT_FOUND) + "\n",
+			wantRunning: map[string]string{"a": "1"}, wantApplied: 1},
+		{name: "rollback bad argument", lines: []string{"rollback -1"}, want: string(console.BAD_FORMAT) + "\n",
+			wantRunning: map[string]string{}},
+		{name: "exit discards", lines: []string{"set a 1", "exit", "configure", "show"},
+			want: "uncommitted changes discarded\n", wantRunning: map[string]string{}},
+		{name: "exit after commit", lines: []string{"set a 1", "commit", "exit", "configure", "show"},
+			want: "version 1 committed\nset a 1\n", wantRunning: map[string]string{"a": "1"}, wantApplied: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			system := &testSystem{fail: tt.fail}
+			m, err := console.NewConfigManager(t.TempDir(), system.apply)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := newConfigSession(t, m)
+			s.Run("configure")
+
+			if got := runLines(s, tt.lines...); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+			if got := m.Running(); !reflect.DeepEqual(got, tt.wantRunning) {
+				t.Errorf("Running = %v, want %v", got, tt.wantRunning)
+			}
+			if got := system.count(); got != tt.wantApplied {
+				t.Errorf("applied %d times, want %d", got, tt.wantApplied)
+			}
+		})
+	}
+}
+
+func TestConfigManagerSessions(t *testing.T) {
+	system := &testSystem{}
+	m, err := console.NewConfigManager(t.TempDir(), system.apply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1 := newConfigSession(t, m)
+	s2 := newConfigSession(t, m)
+	s1.Run("configure")
+	s2.Run("configure")
+
+	// each session has its own candidate
+	s1.Run("set a 1")
+	s2.Run("set b 2")
+	if got := s2.Run("show"); got != "set b 2\n" {
+		t.Errorf("show = %q", got)
+	}
+
+	s1.Run("commit")
+	if got := s2.Run("commit"); got != string(console.CONFIG_CHANGED)+"\n" {
+		t.Errorf("commit on a stale candidate = %q", got)
+	}
+	s2.Run("discard")
+	if got := s2.Run("show"); got != "set a 1\n" {
+		t.Errorf("show after discard = %q", got)
+	}
+	s2.Run("set b 2")
+	if got := s2.Run("commit"); got != "version 2 committed\n" {
+		t.Errorf("commit = %q", got)
+	}
+	if got := m.Running(); !reflect.DeepEqual(got, map[string]string{"a": "1", "b": "2"}) {
+		t.Errorf("Running = %v", got)
+	}
+}
+
+func TestConfigManagerHistory(t *testing.T) {
+	dir := t.TempDir()
+	system := &testSystem{}
+	m, err := console.NewConfigManager(dir, system.apply, console.WithOptionConfigHistory(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newConfigSession(t, m)
+	s.Run("configure")
+	for _, v := range []string{"1", "2", "3"} {
+		s.Run("set a " + v)
+		s.Run("commit")
+	}
+
+	history, err := m.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []int
+	for _, v := range history {
+		versions = append(versions, v.Version)
+		if v.User != s.Console.GetUsername() || v.Time.IsZero() {
+			t.Errorf("version %d = %+v", v.Version, v)
+		}
+	}
+	if !reflect.DeepEqual(versions, []int{3, 2}) {
+		t.Errorf("history = %v, want [3 2]", versions)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "config.*.json"))
+	if len(files) != 2 {
+		t.Errorf("files = %v", files)
+	}
+	for _, f := range files {
+		if fi, err := os.Stat(f); err != nil || fi.Mode().Perm() != 0600 {
+			t.Errorf("%s mode = %v, %v", f, fi.Mode().Perm(), err)
+		}
+	}
+
+	table := s.Run("show history --output csv")
+	if lines := strings.Split(strings.TrimSpace(table), "\n"); len(lines) != 3 ||
+		lines[0] != "rollback,version,time,user,comment" || !strings.HasPrefix(lines[1], "0,3,") {
+		t.Errorf("show history = %q", table)
+	}
+
+	// a new manager starts from the latest version
+	m2, err := console.NewConfigManager(dir, system.apply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m2.Running(); !reflect.DeepEqual(got, map[string]string{"a": "3"}) || m2.RunningVersion() != 3 {
+		t.Errorf("Running = %v, version %d", got, m2.RunningVersion())
+	}
+}
+
+func TestCommitConfirmed(t *testing.T) {
+	defer console.SetConfirmUnit(50 * time.Millisecond)()
+
+	t.Run("rolled back", func(t *testing.T) {
+		system := &testSystem{}
+		m, err := console.NewConfigManager(t.TempDir(), system.apply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := newConfigSession(t, m)
+		s.Run("configure")
+		s.Run("set a 1")
+		s.Run("commit")
+		s.Run("set a 2")
+		if got := s.Run("commit confirmed 1"); got != "version 2 committed, rollback in 50ms unless confirmed\n" {
+			t.Errorf("commit confirmed = %q", got)
+		}
+
+		waitFor(t, "rollback", func() bool { return m.RunningVersion() == 3 })
+		if got := m.Running(); !reflect.DeepEqual(got, map[string]string{"a": "1"}) {
+			t.Errorf("Running = %v", got)
+		}
+		if got := system.count(); got != 3 {
+			t.Errorf("applied %d times, want 3", got)
+		}
+		history, _ := m.History()
+		if history[0].Comment != "rollback of unconfirmed version 2" {
+			t.Errorf("comment = %q", history[0].Comment)
+		}
+	})
+
+	t.Run("confirmed", func(t *testing.T) {
+		system := &testSystem{}
+		m, err := console.NewConfigManager(t.TempDir(), system.apply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := newConfigSession(t, m)
+		s.Run("configure")
+		s.Run("set a 1")
+		if got := s.Run("commit confirmed 4"); got != "version 1 committed, rollback in 200ms unless confirmed\n" {
+			t.Errorf("commit confirmed = %q", got)
+		}
+		if got := s.Run("commit"); got != "commit confirmed\n" {
+			t.Errorf("commit = %q", got)
+		}
+
+		time.Sleep(400 * time.Millisecond)
+		if got := m.Running(); !reflect.DeepEqual(got, map[string]string{"a": "1"}) || m.RunningVersion() != 1 {
+			t.Errorf("Running = %v, version %d", got, m.RunningVersion())
+		}
+	})
+
+	t.Run("extended", func(t *testing.T) {
+		system := &testSystem{}
+		m, err := console.NewConfigManager(t.TempDir(), system.apply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := newConfigSession(t, m)
+		s.Run("configure")
+		s.Run("set a 1")
+		s.Run("commit confirmed 2")
+		if got := s.Run("commit confirmed 10"); got != "rollback in 500ms unless confirmed\n" {
+			t.Errorf("commit confirmed = %q", got)
+		}
+		time.Sleep(200 * time.Millisecond)
+		if m.RunningVersion() != 1 {
+			t.Errorf("rolled back before the extended delay")
+		}
+		waitFor(t, "rollback", func() bool { return m.RunningVersion() == 2 })
+		if got := m.Running(); len(got) != 0 {
+			t.Errorf("Running = %v", got)
+		}
+	})
+}
+
+// TestCommitConfirmedRestart starts a new manager on the dir of a commit
+// confirmed, as after a crash or a reboot.
+func TestCommitConfirmedRestart(t *testing.T) {
+	tests := []struct {
+		name        string
+		lines       []string
+		wantVersion int
+		wantRunning map[string]string
+		wantComment string
+	}{
+		{"unconfirmed", []string{"commit confirmed"}, 3, map[string]string{"a": "1"}, "rollback of unconfirmed version 2"},
+		{"confirmed", []string{"commit confirmed", "commit"}, 2, map[string]string{"a": "2"}, ""},
+		{"confirmed by a commit", []string{"commit confirmed", "set b 1", "commit"}, 3, map[string]string{"a": "2", "b": "1"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			m, err := console.NewConfigManager(dir, (&testSystem{}).apply)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := newConfigSession(t, m)
+			runLines(s, "configure", "set a 1", "commit", "set a 2")
+			runLines(s, tt.lines...)
+
+			restarted, err := console.NewConfigManager(dir, (&testSystem{}).apply)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := restarted.Running(); restarted.RunningVersion() != tt.wantVersion || !reflect.DeepEqual(got, tt.wantRunning) {
+				t.Errorf("Running = %v, version %d, want %v, version %d", got, restarted.RunningVersion(), tt.wantRunning, tt.wantVersion)
+			}
+			history, err := restarted.History()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if history[0].Comment != tt.wantComment {
+				t.Errorf("comment = %q, want %q", history[0].Comment, tt.wantComment)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "confirm.json")); !os.IsNotExist(err) {
+				t.Errorf("confirm file left: %v", err)
+			}
+		})
+	}
+}
+
+func TestConfigApplyWithoutLock(t *testing.T) {
+	var m *console.ConfigManager
+	var seen []int
+	apply := func(config map[string]string) error {
+		// the manager is not locked while the configuration is applied
+		seen = append(seen, m.RunningVersion())
+		return nil
+	}
+	m, err := console.NewConfigManager(t.TempDir(), apply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newConfigSession(t, m)
+	if got := runLines(s, "configure", "set a 1", "commit", "set a 2", "commit"); got != "version 1 committed\nversion 2 committed\n" {
+		t.Errorf("commits = %q", got)
+	}
+	if !reflect.DeepEqual(seen, []int{0, 1}) {
+		t.Errorf("running versions seen by apply = %v", seen)
+	}
+}
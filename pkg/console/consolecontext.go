@@ -0,0 +1,208 @@
+package console
+
+import (
+	"sort"
+	"strings"
+)
+
+type OnContextChange func(console *Console, context *CommandContext)
+
+// CommandContext is a mode of the console, e.g. a configuration mode, with
+// its own commands. While it is active its commands replace the console ones,
+// the builtins stay available and exit/end leave it. A context can be shared
+// by the consoles, the hooks get the console entering or exiting it.
+type CommandContext struct {
+	name         string
+	promptSuffix string
+	commands     []*ConsoleCommand
+	onEnter      OnContextChange
+	onExit       OnContextChange
+}
+
+// NewCommandContext creates a context, promptSuffix is what {context} shows
+// in the prompt while it is the active context, e.g. "(config)".
+func NewCommandContext(name string, promptSuffix string) *CommandContext {
+	return &CommandContext{name: name, promptSuffix: promptSuffix}
+}
+
+func (cc *CommandContext) GetName() string {
+	return cc.name
+}
+
+func (cc *CommandContext) GetPromptSuffix() string {
+	return cc.promptSuffix
+}
+
+func (cc *CommandContext) AddConsoleCommand(cmd *ConsoleCommand) bool {
+	cc.commands = append(cc.commands, cmd)
+	return true
+}
+
+func (cc *CommandContext) AddCallbackOnEnter(cb OnContextChange) {
+	cc.onEnter = cb
+}
+
+func (cc *CommandContext) AddCallbackOnExit(cb OnContextChange) {
+	cc.onExit = cb
+}
+
+// NewContextCommand creates a command that enters context, e.g.
+// NewContextCommand("configure", configContext, "enter the configuration mode").
+func NewContextCommand(cmd string, context *CommandContext, help string) *ConsoleCommand {
+	return NewConsoleCommand(cmd, func(console *Console, command *ConsoleCommand, args []string) CommandError {
+		if len(args) != 0 {
+			return BAD_FORMAT
+		}
+		console.EnterContext(context)
+		return N0_ERR
+	}, help)
+}
+
+// EnterContext pushes context on the context stack, it becomes the active one.
+func (c *Console) EnterContext(context *CommandContext) {
+	c.mu.Lock()
+	c.contexts = append(c.contexts, context)
+	c.promptContext = context.promptSuffix
+	c.mu.Unlock()
+
+	if context.onEnter != nil {
+		context.onEnter(c, context)
+	}
+	c.updatePrompt()
+}
+
+// ExitContext returns to the previous context, it returns false when no
+// context is active.
+func (c *Console) ExitContext() bool {
+	c.mu.Lock()
+	n := len(c.contexts)
+	if n == 0 {
+		c.mu.Unlock()
+		return false
+	}
+	context := c.contexts[n-1]
+	c.contexts = c.contexts[:n-1]
+	c.promptContext = ""
+	if n > 1 {
+		c.promptContext = c.contexts[n-2].promptSuffix
+	}
+	c.mu.Unlock()
+
+	if context.onExit != nil {
+		context.onExit(c, context)
+	}
+	c.updatePrompt()
+	return true
+}
+
+// ExitAllContexts returns to the console commands, the contexts are exited
+// from the innermost.
+func (c *Console) ExitAllContexts() {
+	for c.ExitContext() {
+	}
+}
+
+// GetContextPath returns the names of the active contexts, from the outermost.
+func (c *Console) GetContextPath() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path := make([]string, len(c.contexts))
+	for i, context := range c.contexts {
+		path[i] = context.name
+	}
+	return path
+}
+
+// activeCommands returns the commands of the active context, or the console
+// ones when there is none. A builtin is left out when the application has a
+// command with the same name, so that only the application one runs.
+func (c *Console) activeCommands() []*ConsoleCommand {
+	c.mu.Lock()
+	n := len(c.contexts)
+	var context *CommandContext
+	if n > 0 {
+		context = c.contexts[n-1]
+	}
+	c.mu.Unlock()
+
+	if context == nil {
+		return withoutShadowedBuiltins(c.commands)
+	}
+
+	cmds := append([]*ConsoleCommand(nil), context.commands...)
+	for _, cmd := range c.commands {
+		if cmd.builtin {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return append(withoutShadowedBuiltins(cmds), c.exitCmd, c.endCmd)
+}
+
+func withoutShadowedBuiltins(cmds []*ConsoleCommand) []*ConsoleCommand {
+	names := make(map[string]bool)
+	for _, cmd := range cmds {
+		if !cmd.builtin {
+			names[cmd.GetCommand()] = true
+		}
+	}
+
+	active := make([]*ConsoleCommand, 0, len(cmds))
+	for _, cmd := range cmds {
+		if !cmd.builtin || !names[cmd.GetCommand()] {
+			active = append(active, cmd)
+		}
+	}
+	return active
+}
+
+func (c *Console) cmdExit(console *Console, command *ConsoleCommand, args []string) CommandError {
+	if len(args) != 0 {
+		return BAD_FORMAT
+	}
+	c.ExitContext()
+	return N0_ERR
+}
+
+func (c *Console) cmdEnd(console *Console, command *ConsoleCommand, args []string) CommandError {
+	if len(args) != 0 {
+		return BAD_FORMAT
+	}
+	c.ExitAllContexts()
+	return N0_ERR
+}
+
+// complete completes the command name at the start of the line with the
+// commands of the active context.
+func (c *Console) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' || pos != len(line) || strings.ContainsAny(line, " \t") {
+		return "", 0, false
+	}
+
+	var matches []string
+	for _, cmd := range c.activeCommands() {
+		if strings.HasPrefix(cmd.GetCommand(), line) && c.GetUserLevel() >= cmd.GetUserLevel() {
+			matches = append(matches, cmd.GetCommand())
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+	if len(matches) == 1 {
+		return matches[0], len(matches[0]), true
+	}
+
+	// complete up to the common prefix, list the candidates when there is
+	// nothing more to complete
+	sort.Strings(matches)
+	prefix := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if prefix == line {
+		c.Print(strings.Join(matches, "  "))
+	}
+	return prefix, len(prefix), true
+}
@@ -0,0 +1,199 @@
+package console_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"github.com/freedreamer82/go-console/pkg/console/consoletest"
+)
+
+// newContextSession returns a session with a "configure" command entering a
+// config context, which has a "hostname" command and an "interface"
+// command entering a nested context.
+func newContextSession(t *testing.T, level console.User) *consoletest.Session {
+	config := console.NewCommandContext("config", "(config)")
+	iface := console.NewCommandContext("interface", "(config-if)")
+
+	hostname := console.NewConsoleCommand("hostname", echo, "set the hostname")
+	hostname.SetUserLevel(console.Guest)
+	config.AddConsoleCommand(hostname)
+	config.AddConsoleCommand(newCommand("reload", "reloading"))
+	enterIface := console.NewContextCommand("interface", iface, "configure an interface")
+	enterIface.SetUserLevel(console.Guest)
+	config.AddConsoleCommand(enterIface)
+	iface.AddConsoleCommand(newCommand("shutdown", "down"))
+
+	return consoletest.NewSession(t, func(c *console.Console) {
+		echo := console.NewConsoleCommand("echo", echo, "print the arguments")
+		echo.SetUserLevel(console.Guest)
+		c.AddConsoleCommand(echo)
+		configure := console.NewContextCommand("configure", config, "enter the configuration mode")
+		configure.SetUserLevel(console.Guest)
+		c.AddConsoleCommand(configure)
+		c.SetUserLevel(level)
+	})
+}
+
+func TestContext(t *testing.T) {
+	notFound := string(console.CMD_NOT_FOUND) + "\n"
+
+	tests := []struct {
+		name     string
+		level    console.User
+		lines    []string
+		check    string
+		want     string
+		wantPath []string
+	}{
+		{name: "console commands", level: console.Root, check: "echo x", want: "x\n"},
+		{name: "context commands hidden outside", level: console.Root, check: "hostname r1", want: notFound},
+		{name: "context commands", level: console.Root, lines: []string{"configure"}, check: "hostname r1", want: "r1\n", wantPath: []string{"config"}},
+		{name: "console commands hidden inside", level: console.Root, lines: []string{"configure"}, check: "echo x", want: notFound,
+			wantPath: []string{"config"}},
+		{name: "builtins inside", level: console.Root, lines: []string{"configure"}, check: "whoAmI", want: "User Level = Root\n",
+			wantPath: []string{"config"}},
+		{name: "nested", level: console.Root, lines: []string{"configure", "interface"}, check: "shutdown", want: "down\n",
+			wantPath: []string{"config", "interface"}},
+		{name: "outer commands hidden when nested", level: console.Root, lines: []string{"configure", "interface"}, check: "hostname r1",
+			want: notFound, wantPath: []string{"config", "interface"}},
+		{name: "exit", level: console.Root, lines: []string{"configure", "interface", "exit"}, check: "hostname r1", want: "r1\n",
+			wantPath: []string{"config"}},
+		{name: "exit to the console", level: console.Root, lines: []string{"configure", "exit"}, check: "echo x", want: "x\n"},
+		{name: "end", level: console.Root, lines: []string{"configure", "interface", "end"}, check: "echo x", want: "x\n"},
+		{name: "exit outside", level: console.Root, check: "exit", want: notFound},
+		{name: "end outside", level: console.Root, check: "end", want: notFound},
+		{name: "exit with args", level: console.Root, lines: []string{"configure"}, check: "exit now", want: string(console.BAD_FORMAT) + "\n",
+			wantPath: []string{"config"}},
+		{name: "enter with args", level: console.Root, check: "configure terminal", want: string(console.BAD_FORMAT) + "\n"},
+		{name: "user levels", level: console.Guest, lines: []string{"configure"}, check: "reload", want: notFound,
+			wantPath: []string{"config"}},
+		{name: "guest commands", level: console.Guest, lines: []string{"configure"}, check: "hostname r1", want: "r1\n",
+			wantPath: []string{"config"}},
+		{name: "guest exit", level: console.Guest, lines: []string{"configure", "exit"}, check: "echo x", want: "x\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newContextSession(t, tt.level)
+			for _, line := range tt.lines {
+				if out := s.Run(line); out != "" {
+					t.Fatalf("%s: %q", line, out)
+				}
+			}
+			if got := s.Run(tt.check); got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.check, got, tt.want)
+			}
+			if got := s.Console.GetContextPath(); len(got) != len(tt.wantPath) || (len(got) > 0 && !reflect.DeepEqual(got, tt.wantPath)) {
+				t.Errorf("GetContextPath = %q, want %q", got, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestContextHelp(t *testing.T) {
+	s := newContextSession(t, console.Root)
+
+	help := s.Run("help")
+	for _, want := range []string{"+ echo", "+ configure", "+ whoAmI"} {
+		if !strings.Contains(help, want) {
+			t.Errorf("help does not list %q:\n%s", want, help)
+		}
+	}
+	for _, notWant := range []string{"+ hostname", "+ exit", "context:"} {
+		if strings.Contains(help, notWant) {
+			t.Errorf("help lists %q:\n%s", notWant, help)
+		}
+	}
+
+	s.Run("configure")
+	s.Run("interface")
+	help = s.Run("help")
+	for _, want := range []string{"context: config > interface", "+ shutdown", "+ exit", "+ end", "+ whoAmI"} {
+		if !strings.Contains(help, want) {
+			t.Errorf("help does not list %q:\n%s", want, help)
+		}
+	}
+	for _, notWant := range []string{"+ echo", "+ configure", "+ hostname"} {
+		if strings.Contains(help, notWant) {
+			t.Errorf("help lists %q:\n%s", notWant, help)
+		}
+	}
+}
+
+func TestContextCompletion(t *testing.T) {
+	s := newContextSession(t, console.Root)
+
+	// a single match is completed
+	s.ExpectPrompt()
+	s.SendRaw("conf\t\r")
+	s.Expect("configure\n")
+	s.ExpectRegexp(`(?m)^\(config\)> `)
+
+	s.SendRaw("hostn\t r1\r")
+	s.Expect("hostname r1\n")
+	s.Expect("r1\n")
+
+	// the candidates are listed when there is no common prefix to add
+	s.ExpectPrompt()
+	s.SendRaw("e\t")
+	s.Expect("end  exit\n")
+	s.SendRaw("x\t\r")
+	s.Expect("exit\n")
+	s.ExpectRegexp(`(?m)^> `)
+
+	// the console commands are back
+	s.SendRaw("ec\t x\r")
+	s.Expect("echo x\n")
+	s.Expect("x\n")
+}
+
+func TestContextHooks(t *testing.T) {
+	var events []string
+	record := func(event string) console.OnContextChange {
+		return func(c *console.Console, context *console.CommandContext) {
+			events = append(events, event+" "+context.GetName())
+		}
+	}
+	config := console.NewCommandContext("config", "(config)")
+	config.AddCallbackOnEnter(record("enter"))
+	config.AddCallbackOnExit(record("exit"))
+	iface := console.NewCommandContext("interface", "(config-if)")
+	iface.AddCallbackOnEnter(record("enter"))
+	iface.AddCallbackOnExit(record("exit"))
+	config.AddConsoleCommand(console.NewContextCommand("interface", iface, "configure an interface"))
+
+	s := consoletest.NewSession(t, func(c *console.Console) {
+		c.AddConsoleCommand(console.NewContextCommand("configure", config, "enter the configuration mode"))
+	})
+	s.Run("configure")
+	s.Run("interface")
+	s.Run("exit")
+	s.Run("interface")
+	s.Run("end")
+	s.Run("configure")
+	s.Run("interface")
+	// the contexts still active are exited when the console stops
+	s.Close()
+
+	want := []string{
+		"enter config", "enter interface", "exit interface", "enter interface", "exit interface", "exit config",
+		"enter config", "enter interface", "exit interface", "exit config",
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+}
+
+func TestShadowedBuiltins(t *testing.T) {
+	s := consoletest.NewSession(t, func(c *console.Console) {
+		c.AddConsoleCommand(newCommand("format", "disk formatted"))
+	})
+
+	if got := s.Run("format"); got != "disk formatted\n" {
+		t.Errorf("format = %q", got)
+	}
+	if got := strings.Count(s.Run("help"), "+ format"); got != 1 {
+		t.Errorf("help lists format %d times", got)
+	}
+}
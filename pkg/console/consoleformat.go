@@ -0,0 +1,488 @@
+package console
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+type OutputFormat string
+
+const (
+	FormatTable OutputFormat = "table"
+	FormatJSON  OutputFormat = "json"
+	FormatYAML  OutputFormat = "yaml"
+	FormatCSV   OutputFormat = "csv"
+)
+
+const outputFlag = "--output"
+const columnSeparator = "  "
+
+func parseOutputFormat(s string) (OutputFormat, bool) {
+	switch f := OutputFormat(strings.ToLower(s)); f {
+	case FormatTable, FormatJSON, FormatYAML, FormatCSV:
+		return f, true
+	}
+	return "", false
+}
+
+// Table is a structured result made of rows with named columns.
+type Table struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+func NewTable(columns ...string) *Table {
+	return &Table{Columns: columns}
+}
+
+func (t *Table) AddRow(values ...interface{}) *Table {
+	t.Rows = append(t.Rows, values)
+	return t
+}
+
+// WithOptionOutputFormat sets how the structured results are rendered, table
+// by default.
+func WithOptionOutputFormat(format OutputFormat) ConsoleOption {
+	return func(console *Console) {
+		console.format = format
+	}
+}
+
+func (c *Console) SetOutputFormat(format OutputFormat) error {
+	f, ok := parseOutputFormat(string(format))
+	if !ok {
+		return fmt.Errorf("unknown output format %q", format)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.format = f
+	return nil
+}
+
+// GetOutputFormat returns the format of the session, or the one given with
+// --output to the command being executed.
+func (c *Console) GetOutputFormat() OutputFormat {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.commandFormat != "" {
+		return c.commandFormat
+	}
+	if c.format == "" {
+		return FormatTable
+	}
+	return c.format
+}
+
+// extractOutputFlag removes "--output fmt" or "--output=fmt" from the
+// arguments of a command.
+func extractOutputFlag(args []string) ([]string, OutputFormat, bool) {
+	var format OutputFormat
+	out := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		value := ""
+		switch {
+		case args[i] == outputFlag:
+			if i+1 == len(args) {
+				return nil, "", false
+			}
+			i++
+			value = args[i]
+		case strings.HasPrefix(args[i], outputFlag+"="):
+			value = strings.TrimPrefix(args[i], outputFlag+"=")
+		default:
+			out = append(out, args[i])
+			continue
+		}
+		f, ok := parseOutputFormat(value)
+		if !ok {
+			return nil, "", false
+		}
+		format = f
+	}
+	return out, format, true
+}
+
+// runCommand runs the handler of cmd, the --output flag of the commands with
+// structured output sets the format of their results. The other commands get
+// their arguments untouched.
+func (c *Console) runCommand(cmd *ConsoleCommand, args []string) CommandError {
+	if !cmd.HasStructuredOutput() {
+		return cmd.handler(c, cmd, args)
+	}
+
+	args, format, ok := extractOutputFlag(args)
+	if !ok {
+		return BAD_FORMAT
+	}
+	if format != "" {
+		c.mu.Lock()
+		previous := c.commandFormat
+		c.commandFormat = format
+		c.mu.Unlock()
+		defer func() {
+			c.mu.Lock()
+			c.commandFormat = previous
+			c.mu.Unlock()
+		}()
+	}
+	return cmd.handler(c, cmd, args)
+}
+
+// PrintResult renders a structured result in the output format of the
+// session: a *Table, a slice of structs or maps, a struct, a map or a plain
+// value. It returns the error for the command handler to return.
+func (c *Console) PrintResult(v interface{}) CommandError {
+
+	if t, ok := v.(Table); ok {
+		v = &t
+	}
+
+	var text string
+	var err error
+	switch c.GetOutputFormat() {
+	case FormatJSON:
+		text, err = renderJSON(v)
+	case FormatYAML:
+		text, err = renderYAML(v)
+	case FormatCSV:
+		text, err = renderCSV(v)
+	default:
+		width, _ := c.GetSize()
+		text = renderTable(v, width)
+	}
+	if err != nil {
+		return CommandError(err.Error())
+	}
+
+	for _, l := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		c.Print(l)
+	}
+	return N0_ERR
+}
+
+func (c *Console) cmdFormat(console *Console, command *ConsoleCommand, args []string) CommandError {
+	switch len(args) {
+	case 0:
+		c.Print(c.GetOutputFormat())
+		return N0_ERR
+	case 1:
+		if err := c.SetOutputFormat(OutputFormat(args[0])); err != nil {
+			return CommandError(err.Error())
+		}
+		return N0_ERR
+	}
+	return BAD_FORMAT
+}
+
+// toTable turns v into a table, ok is false for plain values.
+func toTable(v interface{}) (*Table, bool) {
+
+	switch t := v.(type) {
+	case *Table:
+		return t, true
+	case Table:
+		return &t, true
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, false
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		elem := rv.Type().Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		switch elem.Kind() {
+		case reflect.Struct:
+			fields := structFields(elem)
+			t := NewTable()
+			for _, f := range fields {
+				t.Columns = append(t.Columns, f.name)
+			}
+			for i := 0; i < rv.Len(); i++ {
+				item := reflect.Indirect(rv.Index(i))
+				row := make([]interface{}, len(fields))
+				for j, f := range fields {
+					if item.IsValid() {
+						row[j] = item.Field(f.index).Interface()
+					}
+				}
+				t.Rows = append(t.Rows, row)
+			}
+			return t, true
+		case reflect.Map:
+			keys := map[string]bool{}
+			for i := 0; i < rv.Len(); i++ {
+				for _, k := range reflect.Indirect(rv.Index(i)).MapKeys() {
+					keys[fmt.Sprint(k.Interface())] = true
+				}
+			}
+			t := NewTable(sortedKeys(keys)...)
+			for i := 0; i < rv.Len(); i++ {
+				item := reflect.Indirect(rv.Index(i))
+				row := make([]interface{}, len(t.Columns))
+				for _, k := range item.MapKeys() {
+					idx := sort.SearchStrings(t.Columns, fmt.Sprint(k.Interface()))
+					row[idx] = item.MapIndex(k).Interface()
+				}
+				t.Rows = append(t.Rows, row)
+			}
+			return t, true
+		}
+		t := NewTable("VALUE")
+		for i := 0; i < rv.Len(); i++ {
+			t.AddRow(rv.Index(i).Interface())
+		}
+		return t, true
+	case reflect.Struct:
+		t := NewTable("KEY", "VALUE")
+		for _, f := range structFields(rv.Type()) {
+			t.AddRow(f.name, rv.Field(f.index).Interface())
+		}
+		return t, true
+	case reflect.Map:
+		keys := map[string]bool{}
+		values := map[string]interface{}{}
+		for _, k := range rv.MapKeys() {
+			key := fmt.Sprint(k.Interface())
+			keys[key] = true
+			values[key] = rv.MapIndex(k).Interface()
+		}
+		t := NewTable("KEY", "VALUE")
+		for _, k := range sortedKeys(keys) {
+			t.AddRow(k, values[k])
+		}
+		return t, true
+	}
+	return nil, false
+}
+
+type structField struct {
+	name  string
+	index int
+}
+
+// structFields returns the exported fields named as their json tag.
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			tagName := strings.Split(tag, ",")[0]
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+		fields = append(fields, structField{name: name, index: i})
+	}
+	return fields
+}
+
+func sortedKeys(keys map[string]bool) []string {
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func cellText(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// renderTable aligns the columns, when the table is wider than width the
+// widest columns are shrunk and their cells truncated.
+func renderTable(v interface{}, width int) string {
+
+	t, ok := toTable(v)
+	if !ok {
+		return cellText(v)
+	}
+
+	cells := make([][]string, 0, len(t.Rows)+1)
+	header := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		header[i] = strings.ToUpper(col)
+	}
+	cells = append(cells, header)
+	for _, row := range t.Rows {
+		line := make([]string, len(t.Columns))
+		for i := range line {
+			if i < len(row) {
+				line[i] = strings.ReplaceAll(cellText(row[i]), "\n", " ")
+			}
+		}
+		cells = append(cells, line)
+	}
+
+	widths := make([]int, len(t.Columns))
+	for _, line := range cells {
+		for i, cell := range line {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	if width > 0 && len(widths) > 0 {
+		total := len(columnSeparator) * (len(widths) - 1)
+		for _, w := range widths {
+			total += w
+		}
+		for total > width {
+			widest := 0
+			for i, w := range widths {
+				if w > widths[widest] {
+					widest = i
+				}
+			}
+			if widths[widest] <= 3 {
+				break
+			}
+			widths[widest]--
+			total--
+		}
+	}
+
+	var b strings.Builder
+	for _, line := range cells {
+		var l strings.Builder
+		for i, cell := range line {
+			if n := utf8.RuneCountInString(cell); n > widths[i] {
+				cell = string([]rune(cell)[:widths[i]-1]) + "…"
+			}
+			l.WriteString(cell)
+			l.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell)))
+			l.WriteString(columnSeparator)
+		}
+		b.WriteString(strings.TrimRight(l.String(), " "))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// tableRecords returns the rows of the table as objects keyed by the column
+// names, in column order.
+func tableRecords(t *Table) []*yaml.Node {
+	var records []*yaml.Node
+	for _, row := range t.Rows {
+		record := &yaml.Node{Kind: yaml.MappingNode}
+		for i, col := range t.Columns {
+			var value interface{}
+			if i < len(row) {
+				value = row[i]
+			}
+			valueNode := &yaml.Node{}
+			if err := valueNode.Encode(value); err != nil {
+				valueNode.Encode(cellText(value))
+			}
+			record.Content = append(record.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: col}, valueNode)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func renderJSON(v interface{}) (string, error) {
+	if t, ok := v.(*Table); ok {
+		var b bytes.Buffer
+		b.WriteString("[")
+		for r, row := range t.Rows {
+			if r > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString("\n  {")
+			for i, col := range t.Columns {
+				var value interface{}
+				if i < len(row) {
+					value = row[i]
+				}
+				k, _ := json.Marshal(col)
+				val, err := json.Marshal(value)
+				if err != nil {
+					return "", err
+				}
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				b.Write(k)
+				b.WriteString(": ")
+				b.Write(val)
+			}
+			b.WriteString("}")
+		}
+		if len(t.Rows) > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("]")
+		return b.String(), nil
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	return string(data), err
+}
+
+func renderYAML(v interface{}) (string, error) {
+	if t, ok := v.(*Table); ok {
+		v = &yaml.Node{Kind: yaml.SequenceNode, Content: tableRecords(t)}
+	}
+
+	var b bytes.Buffer
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	err := enc.Close()
+	return b.String(), err
+}
+
+func renderCSV(v interface{}) (string, error) {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+
+	t, ok := toTable(v)
+	if !ok {
+		w.Write([]string{cellText(v)})
+	} else {
+		w.Write(t.Columns)
+		for _, row := range t.Rows {
+			record := make([]string, len(t.Columns))
+			for i := range record {
+				if i < len(row) {
+					record[i] = cellText(row[i])
+				}
+			}
+			w.Write(record)
+		}
+	}
+	w.Flush()
+	return b.String(), w.Error()
+}
@@ -0,0 +1,178 @@
+package console_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"github.com/freedreamer82/go-console/pkg/console/consoletest"
+)
+
+type host struct {
+	Name   string `json:"name"`
+	Port   int    `json:"port"`
+	Secret string `json:"-"`
+}
+
+// newHostsCommand returns a structured command printing two hosts.
+func newHostsCommand() *console.ConsoleCommand {
+	cmd := console.NewConsoleCommand("hosts", func(c *console.Console, command *console.ConsoleCommand, args []string) console.CommandError {
+		if len(args) > 0 {
+			return console.BAD_FORMAT
+		}
+		return c.PrintResult(console.NewTable("name", "port").AddRow("a", 1).AddRow("bb", 22))
+	}, "print the hosts")
+	cmd.SetUserLevel(console.Guest)
+	cmd.SetStructuredOutput(true)
+	return cmd
+}
+
+func TestPrintResult(t *testing.T) {
+	hosts := []host{{"a", 1, "x"}, {"bb", 22, "y"}}
+
+	tests := []struct {
+		name   string
+		value  interface{}
+		format console.OutputFormat
+		width  int
+		want   string
+	}{
+		{name: "table", value: console.NewTable("name", "port").AddRow("a", 1).AddRow("bb", 22),
+			want: "NAME  PORT\na     1\nbb    22\n"},
+		{name: "table value", value: *console.NewTable("name").AddRow("a"), want: "NAME\na\n"},
+		{name: "short row", value: console.NewTable("name", "port").AddRow("a"), want: "NAME  PORT\na\n"},
+		{name: "structs", value: hosts, want: "NAME  PORT\na     1\nbb    22\n"},
+		{name: "struct pointers", value: []*host{&hosts[0]}, want: "NAME  PORT\na     1\n"},
+		{name: "maps", value: []map[string]interface{}{{"b": 2, "a": 1}, {"a": 3}}, want: "A  B\n1  2\n3\n"},
+		{name: "values", value: []string{"x", "y"}, want: "VALUE\nx\ny\n"},
+		{name: "struct", value: hosts[0], want: "KEY   VALUE\nname  a\nport  1\n"},
+		{name: "map", value: map[string]int{"b": 2, "a": 1}, want: "KEY  VALUE\na    1\nb    2\n"},
+		{name: "plain value", value: 42, want: "42\n"},
+		{name: "truncated to width", value: console.NewTable("name", "desc").AddRow("a", "a long description"),
+			width: 20, want: "NAME  DESC\na     a long descri…\n"},
+		{name: "wide enough", value: console.NewTable("name", "desc").AddRow("a", "a long description"),
+			width: 80, want: "NAME  DESC\na     a long description\n"},
+
+		{name: "json table", value: console.NewTable("name", "port").AddRow("a", 1).AddRow("bb", 22), format: console.FormatJSON,
+			want: "[\n  {\"name\": \"a\", \"port\": 1},\n  {\"name\": \"bb\", \"port\": 22}\n]\n"},
+		{name: "json empty table", value: console.NewTable("name"), format: console.FormatJSON, want: "[]\n"},
+		{name: "json structs", value: hosts[:1], format: console.FormatJSON,
+			want: "[\n  {\n    \"name\": \"a\",\n    \"port\": 1\n  }\n]\n"},
+		{name: "json plain value", value: "x", format: console.FormatJSON, want: "\"x\"\n"},
+
+		{name: "yaml table", value: console.NewTable("name", "port").AddRow("a", 1).AddRow("bb", 22), format: console.FormatYAML,
+			want: "- name: a\n  port: 1\n- name: bb\n  port: 22\n"},
+		{name: "yaml struct", value: map[string]int{"a": 1}, format: console.FormatYAML, want: "a: 1\n"},
+
+		{name: "csv table", value: console.NewTable("name", "port").AddRow("a", 1).AddRow("b,c", 22), format: console.FormatCSV,
+			want: "name,port\na,1\n\"b,c\",22\n"},
+		{name: "csv structs", value: hosts, format: console.FormatCSV, want: "name,port\na,1\nbb,22\n"},
+		{name: "csv plain value", value: 42, format: console.FormatCSV, want: "42\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipe := consoletest.NewPipe()
+			c := console.NewConsole(pipe.IO(), console.WithOptionOutputFormat(tt.format))
+			c.SetSize(tt.width, 0)
+
+			if err := c.PrintResult(tt.value); err != console.N0_ERR {
+				t.Fatalf("PrintResult = %q", err)
+			}
+			if got, _, _ := pipe.Output(); consoletest.Normalize(got) != tt.want {
+				t.Errorf("output = %q, want %q", consoletest.Normalize(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []console.ConsoleOption
+		lines []string
+		want  string
+	}{
+		{name: "table by default", lines: []string{"hosts"}, want: "NAME  PORT\na     1\nbb    22\n"},
+		{name: "default format", lines: []string{"format"}, want: "table\n"},
+		{name: "option", opts: []console.ConsoleOption{console.WithOptionOutputFormat(console.FormatCSV)},
+			lines: []string{"format", "hosts"}, want: "csv\nname,port\na,1\nbb,22\n"},
+		{name: "format builtin", lines: []string{"format yaml", "format", "hosts"},
+			want: "yaml\n- name: a\n  port: 1\n- name: bb\n  port: 22\n"},
+		{name: "format is case insensitive", lines: []string{"format CSV", "format"}, want: "csv\n"},
+		{name: "unknown format", lines: []string{"format xml", "format"}, want: "unknown output format \"xml\"\ntable\n"},
+		{name: "format with two args", lines: []string{"format json yaml"}, want: string(console.BAD_FORMAT) + "\n"},
+		{name: "output flag", lines: []string{"hosts --output csv"}, want: "name,port\na,1\nbb,22\n"},
+		{name: "output flag with =", lines: []string{"hosts --output=csv"}, want: "name,port\na,1\nbb,22\n"},
+		{name: "output flag is per command", lines: []string{"hosts --output csv", "format"}, want: "name,port\na,1\nbb,22\ntable\n"},
+		{name: "output flag overrides the session", lines: []string{"format yaml", "hosts --output csv"},
+			want: "name,port\na,1\nbb,22\n"},
+		{name: "unknown output format", lines: []string{"hosts --output xml"}, want: string(console.BAD_FORMAT) + "\n"},
+		{name: "missing output format", lines: []string{"hosts --output"}, want: string(console.BAD_FORMAT) + "\n"},
+		{name: "flag removed from the args", lines: []string{"hosts --output json extra"}, want: string(console.BAD_FORMAT) + "\n"},
+		{name: "plain commands keep the flag", lines: []string{"echo --output json"}, want: "--output\njson\n"},
+		{name: "pipes", lines: []string{"hosts --output csv | grep bb"}, want: "bb,22\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := consoletest.NewSession(t, func(c *console.Console) {
+				c.AddConsoleCommand(echoCommand)
+				c.AddConsoleCommand(newHostsCommand())
+			}, tt.opts...)
+
+			var got string
+			for _, line := range tt.lines {
+				got += s.Run(line)
+			}
+			if got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputFormatMachineTransports(t *testing.T) {
+	const want = "[\n  {\"name\": \"a\", \"port\": 1},\n  {\"name\": \"bb\", \"port\": 22}\n]\n"
+
+	t.Run("http", func(t *testing.T) {
+		server := console.NewHTTPConsole()
+		server.AddCallbackOnNewConsole(func(c *console.Console) {
+			c.AddConsoleCommand(newHostsCommand())
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/exec", strings.NewReader("hosts"))
+		req.Header.Set("Content-Type", "text/plain")
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+
+		var resp console.HTTPExecResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Output != want {
+			t.Errorf("output = %q, want %q", resp.Output, want)
+		}
+	})
+
+	t.Run("stdin script", func(t *testing.T) {
+		output := stdio(t, "hosts\n")
+
+		c := console.NewStdOutputConsole()
+		c.AddConsoleCommand(newHostsCommand())
+		c.Start()
+		select {
+		case err := <-c.ScriptResult():
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(testTimeout):
+			t.Fatal("no script result")
+		}
+		if got := output(); !strings.HasSuffix(got, want) {
+			t.Errorf("output = %q, want suffix %q", got, want)
+		}
+	})
+}
@@ -0,0 +1,267 @@
+package console
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const httpMaxRequestSize = 64 * 1024
+const httpReadHeaderTimeout = 10 * time.Second
+
+// HTTPExecRequest is the body of POST /exec, either the command line or the
+// command with its arguments.
+type HTTPExecRequest struct {
+	Line    string   `json:"line,omitempty"`
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+}
+
+type HTTPExecResponse struct {
+	Output     string  `json:"output"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+type HTTPCommandInfo struct {
+	Command string `json:"command"`
+	Help    string `json:"help"`
+	Level   string `json:"level"`
+}
+
+// HTTPConsole runs console commands over http: POST /exec runs a command and
+// GET /commands lists the commands available to the caller. It is an
+// http.Handler that can be mounted on any mux or served on its own with Start.
+type HTTPConsole struct {
+	mu                   *sync.RWMutex
+	mux                  *http.ServeMux
+	auth                 httpAuth
+	listCommands         bool
+	commandTimeout       time.Duration
+	callbackOnNewConsole OnNewConsole
+	server               *http.Server
+	closing              bool
+}
+
+type HTTPConsoleOption func(console *HTTPConsole)
+
+// WithOptionHTTPTokens maps the bearer tokens to user levels, without tokens
+// every request runs as Guest.
+func WithOptionHTTPTokens(tokens map[string]User) HTTPConsoleOption {
+	return func(console *HTTPConsole) {
+		console.auth.tokens = tokens
+	}
+}
+
+// WithOptionHTTPCommandList enables GET /commands.
+func WithOptionHTTPCommandList(enabled bool) HTTPConsoleOption {
+	return func(console *HTTPConsole) {
+		console.listCommands = enabled
+	}
+}
+
+// WithOptionHTTPCommandTimeout cancels the context of the commands running for
+// longer than timeout.
+func WithOptionHTTPCommandTimeout(timeout time.Duration) HTTPConsoleOption {
+	return func(console *HTTPConsole) {
+		console.commandTimeout = timeout
+	}
+}
+
+func NewHTTPConsole(opts ...HTTPConsoleOption) *HTTPConsole {
+	c := &HTTPConsole{mu: &sync.RWMutex{}, mux: http.NewServeMux()}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.mux.HandleFunc("/exec", c.handleExec)
+	c.mux.HandleFunc("/commands", c.handleCommands)
+
+	return c
+}
+
+// AddCallbackOnNewConsole registers the callback called on the console created
+// for each request, it is where the commands are added.
+func (c *HTTPConsole) AddCallbackOnNewConsole(cb OnNewConsole) {
+	c.callbackOnNewConsole = cb
+}
+
+func (c *HTTPConsole) RemoveCallbackOnNewConsole() {
+	c.callbackOnNewConsole = nil
+}
+
+func (c *HTTPConsole) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mux.ServeHTTP(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// newConsole creates the console of a request, authenticated as the caller.
+func (c *HTTPConsole) newConsole(w http.ResponseWriter, r *http.Request, ctx context.Context) (*Console, *captureIO, bool) {
+
+	username, level := "", Guest
+	if c.auth.enabled() {
+		var ok bool
+		username, level, ok = c.auth.authenticate(r, false)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="console"`)
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+			return nil, nil, false
+		}
+	}
+
+	console, capture := newCaptureConsole(WithOptionContext(ctx), WithOptionOutputFormat(FormatJSON), WithOptionColor(false),
+		WithOptionInteractive(false))
+	console.Authenticate(username, level)
+	if c.callbackOnNewConsole != nil {
+		c.callbackOnNewConsole(console)
+	}
+	return console, capture, true
+}
+
+func (c *HTTPConsole) handleExec(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req HTTPExecRequest
+	contentType := r.Header.Get("Content-Type")
+	body := http.MaxBytesReader(w, r.Body, httpMaxRequestSize)
+	switch {
+	case strings.HasPrefix(contentType, "application/json"):
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	case strings.HasPrefix(contentType, "text/plain"):
+		// the body is the command line as is
+		line, err := io.ReadAll(body)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Line = string(line)
+	default:
+		// form with the command line in the line field
+		r.Body = body
+		if err := r.ParseForm(); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Line = r.PostForm.Get("line")
+	}
+	req.Line = strings.TrimSpace(req.Line)
+	if req.Line == "" && req.Command == "" {
+		writeJSONError(w, http.StatusBadRequest, "missing line or command")
+		return
+	}
+
+	ctx := r.Context()
+	if c.commandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.commandTimeout)
+		defer cancel()
+	}
+
+	console, capture, ok := c.newConsole(w, r, ctx)
+	if !ok {
+		return
+	}
+	defer console.stop(false)
+
+	start := time.Now()
+	var cmdErr CommandError
+	if req.Command != "" {
+		cmdErr = console.ExecArgs(req.Command, req.Args)
+	} else {
+		cmdErr = console.Exec(req.Line)
+	}
+
+	writeJSON(w, http.StatusOK, HTTPExecResponse{
+		Output:     capture.Output(),
+		Error:      string(cmdErr),
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+	})
+}
+
+func (c *HTTPConsole) handleCommands(w http.ResponseWriter, r *http.Request) {
+	if !c.listCommands {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	console, _, ok := c.newConsole(w, r, r.Context())
+	if !ok {
+		return
+	}
+	defer console.stop(false)
+
+	commands := []HTTPCommandInfo{}
+	for _, cmd := range console.GetCommands() {
+		commands = append(commands, HTTPCommandInfo{Command: cmd.GetCommand(), Help: cmd.GetHelp(),
+			Level: cmd.GetUserLevel().String()})
+	}
+	writeJSON(w, http.StatusOK, commands)
+}
+
+// Start serves the http endpoints on addr, it blocks until the console is shut
+// down or the server fails.
+func (c *HTTPConsole) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.closing {
+		c.mu.Unlock()
+		return listener.Close()
+	}
+	c.server = &http.Server{Handler: c, ReadHeaderTimeout: httpReadHeaderTimeout}
+	server := c.server
+	c.mu.Unlock()
+
+	log.Infof("HTTP console listening on %s", listener.Addr())
+	err = server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting requests and waits for the running commands until
+// ctx expires.
+func (c *HTTPConsole) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	c.closing = true
+	server := c.server
+	c.mu.Unlock()
+
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
+}
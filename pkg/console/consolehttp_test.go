@@ -0,0 +1,159 @@
+package console_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+)
+
+func newHTTPConsole(opts ...console.HTTPConsoleOption) *console.HTTPConsole {
+	server := console.NewHTTPConsole(opts...)
+	server.AddCallbackOnNewConsole(func(c *console.Console) {
+		echo := console.NewConsoleCommand("echo", echo, "print the arguments")
+		echo.SetUserLevel(console.Guest)
+		c.AddConsoleCommand(echo)
+		c.AddConsoleCommand(newCommand("reboot", "rebooting"))
+		c.AddConsoleCommand(sleepCommand)
+	})
+	return server
+}
+
+func TestHTTPExec(t *testing.T) {
+	tokens := map[string]console.User{"guest": console.Guest, "admin": console.Root}
+
+	tests := []struct {
+		name        string
+		opts        []console.HTTPConsoleOption
+		method      string
+		contentType string
+		body        string
+		token       string
+		wantStatus  int
+		wantOutput  string
+		wantError   string
+	}{
+		{name: "json line", contentType: "application/json", body: `{"line":"echo one two"}`,
+			wantStatus: http.StatusOK, wantOutput: "one\ntwo\n"},
+		{name: "json command and args", contentType: "application/json", body: `{"command":"echo","args":["a b"]}`,
+			wantStatus: http.StatusOK, wantOutput: "a b\n"},
+		{name: "text plain", contentType: "text/plain", body: "echo plain\n",
+			wantStatus: http.StatusOK, wantOutput: "plain\n"},
+		{name: "form", contentType: "application/x-www-form-urlencoded", body: "line=echo+form",
+			wantStatus: http.StatusOK, wantOutput: "form\n"},
+		{name: "unknown command", contentType: "text/plain", body: "nosuch",
+			wantStatus: http.StatusOK, wantError: string(console.CMD_NOT_FOUND)},
+		{name: "guest can't run root commands", contentType: "text/plain", body: "reboot",
+			wantStatus: http.StatusOK, wantError: string(console.CMD_NOT_FOUND)},
+		{name: "empty body", contentType: "text/plain", body: " ", wantStatus: http.StatusBadRequest},
+		{name: "bad json", contentType: "application/json", body: `{"line":`, wantStatus: http.StatusBadRequest},
+		{name: "body too large", contentType: "text/plain", body: "echo " + strings.Repeat("x", 65*1024),
+			wantStatus: http.StatusBadRequest},
+		{name: "get", method: http.MethodGet, wantStatus: http.StatusMethodNotAllowed},
+		{name: "missing token", opts: []console.HTTPConsoleOption{console.WithOptionHTTPTokens(tokens)},
+			contentType: "text/plain", body: "echo one", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", opts: []console.HTTPConsoleOption{console.WithOptionHTTPTokens(tokens)},
+			contentType: "text/plain", body: "echo one", token: "nosuch", wantStatus: http.StatusUnauthorized},
+		{name: "guest token", opts: []console.HTTPConsoleOption{console.WithOptionHTTPTokens(tokens)},
+			contentType: "text/plain", body: "reboot", token: "guest",
+			wantStatus: http.StatusOK, wantError: string(console.CMD_NOT_FOUND)},
+		{name: "root token", opts: []console.HTTPConsoleOption{console.WithOptionHTTPTokens(tokens)},
+			contentType: "text/plain", body: "reboot", token: "admin",
+			wantStatus: http.StatusOK, wantOutput: "rebooting\n"},
+		{name: "command timeout", opts: []console.HTTPConsoleOption{console.WithOptionHTTPTokens(tokens),
+			console.WithOptionHTTPCommandTimeout(50 * time.Millisecond)},
+			contentType: "text/plain", body: "sleep 10s", token: "admin", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newHTTPConsole(tt.opts...)
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, "/exec", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var resp console.HTTPExecResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Output != tt.wantOutput || resp.Error != tt.wantError {
+				t.Errorf("response = %+v, want output %q error %q", resp, tt.wantOutput, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestHTTPCommands(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []console.HTTPConsoleOption
+		token      string
+		wantStatus int
+		want       []string
+		notWant    []string
+	}{
+		{name: "disabled", wantStatus: http.StatusNotFound},
+		{name: "guest", opts: []console.HTTPConsoleOption{console.WithOptionHTTPCommandList(true)},
+			wantStatus: http.StatusOK, want: []string{"echo"}, notWant: []string{"reboot"}},
+		{name: "root", opts: []console.HTTPConsoleOption{console.WithOptionHTTPCommandList(true),
+			console.WithOptionHTTPTokens(map[string]console.User{"admin": console.Root})}, token: "admin",
+			wantStatus: http.StatusOK, want: []string{"echo", "reboot"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newHTTPConsole(tt.opts...)
+
+			req := httptest.NewRequest(http.MethodGet, "/commands", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			server.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var commands []console.HTTPCommandInfo
+			if err := json.Unmarshal(rec.Body.Bytes(), &commands); err != nil {
+				t.Fatal(err)
+			}
+			names := map[string]bool{}
+			for _, cmd := range commands {
+				names[cmd.Command] = true
+			}
+			for _, name := range tt.want {
+				if !names[name] {
+					t.Errorf("%s not listed", name)
+				}
+			}
+			for _, name := range tt.notWant {
+				if names[name] {
+					t.Errorf("%s listed", name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package console
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+const tokenUsername = "token"
+
+// httpAuth authenticates the http transports with basic auth and/or bearer
+// tokens, each token carries its own user level.
+type httpAuth struct {
+	basicUsers  map[string]string
+	basicLevels map[string]User
+	tokens      map[string]User
+}
+
+func (a *httpAuth) enabled() bool {
+	return len(a.basicUsers) > 0 || len(a.tokens) > 0
+}
+
+func secureCompare(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func (a *httpAuth) checkToken(token string) (User, bool) {
+	for t, level := range a.tokens {
+		if secureCompare(t, token) {
+			return level, true
+		}
+	}
+	return Guest, false
+}
+
+// authenticate returns the user of the request, the token is taken from the
+// Authorization header or, when allowQuery is set, from the token query
+// parameter (browsers can't set headers on a websocket).
+func (a *httpAuth) authenticate(r *http.Request, allowQuery bool) (username string, level User, ok bool) {
+
+	if user, password, found := r.BasicAuth(); found && len(a.basicUsers) > 0 {
+		expected, exist := a.basicUsers[user]
+		if !exist || !secureCompare(expected, password) {
+			return "", Guest, false
+		}
+		level, exist := a.basicLevels[user]
+		if !exist {
+			level = Root
+		}
+		return user, level, true
+	}
+
+	if len(a.tokens) == 0 {
+		return "", Guest, false
+	}
+
+	token := ""
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	} else if allowQuery {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		return "", Guest, false
+	}
+
+	level, ok = a.checkToken(token)
+	return tokenUsername, level, ok
+}
+
+func (a *httpAuth) requestCredentials(w http.ResponseWriter) {
+	if len(a.basicUsers) > 0 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="console"`)
+	} else {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="console"`)
+	}
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
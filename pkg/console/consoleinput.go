@@ -0,0 +1,221 @@
+package console
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultInputTimeout = 2 * time.Minute
+
+// ErrNoInput is returned by the input functions on the consoles that only
+// execute commands, e.g. the HTTP and JSON-RPC ones.
+var ErrNoInput = errors.New("the console does not read the user input")
+
+type lineResult struct {
+	line string
+	err  error
+}
+
+// abortKeys end a terminal read given up with an empty line: end of line,
+// erase the line and enter. Ctrl-c would stay in the buffer of the terminal.
+var abortKeys = []byte{5, 21, '\r'}
+
+// inputReader is the input of the terminal, it can make the pending read end
+// as soon as the user types something.
+type inputReader struct {
+	mu      sync.Mutex
+	r       io.Reader
+	abort   bool
+	pending []byte
+}
+
+func (in *inputReader) Read(b []byte) (int, error) {
+	in.mu.Lock()
+	if len(in.pending) > 0 {
+		n := copy(b, in.pending)
+		in.pending = in.pending[n:]
+		in.mu.Unlock()
+		return n, nil
+	}
+	in.mu.Unlock()
+
+	n, err := in.r.Read(b)
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	if !in.abort || err != nil {
+		return n, err
+	}
+	// what the user typed goes to the next read
+	in.abort = false
+	in.pending = append(in.pending, b[:n]...)
+	return copy(b, abortKeys), nil
+}
+
+// setAbort asks the read in progress to end, or cancels the request.
+func (in *inputReader) setAbort(abort bool) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	in.abort = abort
+}
+
+// WithOptionInputTimeout sets how long Confirm, Ask, AskSecret and Select wait
+// for the answer, 2 minutes by default.
+func WithOptionInputTimeout(timeout time.Duration) ConsoleOption {
+	return func(console *Console) {
+		console.SetInputTimeout(timeout)
+	}
+}
+
+func (c *Console) SetInputTimeout(timeout time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inputTimeout = timeout
+}
+
+// readInput reads a line with read, waiting until ctx is done. A read given up
+// is aborted when the user types again and its line is dropped, the next
+// readInput waits for it so that the terminal is never read twice at the same
+// time.
+func (c *Console) readInput(ctx context.Context, read func() (string, error)) (string, error) {
+	for {
+		c.mu.Lock()
+		pending := c.pendingRead
+		if pending == nil {
+			pending = make(chan lineResult, 1)
+			c.pendingRead = pending
+			go func() {
+				line, err := read()
+				pending <- lineResult{line, err}
+			}()
+		}
+		c.mu.Unlock()
+
+		select {
+		case r := <-pending:
+			c.mu.Lock()
+			c.pendingRead = nil
+			aborted := c.abortedRead == pending
+			c.abortedRead = nil
+			c.mu.Unlock()
+			if aborted {
+				// the line may have ended before the abort keys were sent
+				c.input.setAbort(false)
+				continue
+			}
+			return r.line, r.err
+		case <-ctx.Done():
+			c.mu.Lock()
+			if c.pendingRead == pending {
+				c.abortedRead = pending
+				c.input.setAbort(true)
+			}
+			c.mu.Unlock()
+			return "", ctx.Err()
+		}
+	}
+}
+
+// ask shows prompt and reads the answer within the input timeout, the prompt
+// of the console is restored afterwards.
+func (c *Console) ask(prompt string, secret bool) (string, error) {
+	c.mu.Lock()
+	running, timeout := c.running, c.inputTimeout
+	c.mu.Unlock()
+
+	if !running {
+		return "", ErrNoInput
+	}
+	if timeout <= 0 {
+		timeout = defaultInputTimeout
+	}
+	ctx, cancel := context.WithTimeout(c.Context(), timeout)
+	defer cancel()
+
+	var line string
+	var err error
+	if secret {
+		line, err = c.readInput(ctx, func() (string, error) { return c.term.ReadPassword(prompt) })
+	} else {
+		c.term.SetPrompt(prompt)
+		line, err = c.readInput(ctx, c.term.ReadLine)
+	}
+	// also while the password read given up is still pending
+	c.updatePrompt()
+	if err != nil && ctx.Err() != nil {
+		// the question stays on the line, move to the next one
+		c.Print()
+	}
+	c.touch()
+	return line, err
+}
+
+// Confirm asks a yes/no question, e.g. Confirm("Reboot? [y/N]"), only y and
+// yes are a yes.
+func (c *Console) Confirm(question string) (bool, error) {
+	answer, err := c.ask(question+" ", false)
+	if err != nil {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// Ask reads a line, def is returned when the answer is empty.
+func (c *Console) Ask(prompt string, def string) (string, error) {
+	question := prompt + " "
+	if def != "" {
+		question = fmt.Sprintf("%s [%s] ", prompt, def)
+	}
+	answer, err := c.ask(question, false)
+	if err != nil {
+		return "", err
+	}
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+// AskSecret reads a line without echo, e.g. a password.
+func (c *Console) AskSecret(prompt string) (string, error) {
+	return c.ask(prompt+" ", true)
+}
+
+// Select shows the numbered options and returns the index of the one chosen
+// by number or by name, it asks again until the answer is valid.
+func (c *Console) Select(prompt string, options []string) (int, error) {
+	if len(options) == 0 {
+		return -1, errors.New("no options")
+	}
+	for i, o := range options {
+		c.Print(fmt.Sprintf("%d) %s", i+1, o))
+	}
+	for {
+		answer, err := c.ask(fmt.Sprintf("%s [1-%d] ", prompt, len(options)), false)
+		if err != nil {
+			return -1, err
+		}
+		answer = strings.TrimSpace(answer)
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(options) {
+			return n - 1, nil
+		}
+		for i, o := range options {
+			if strings.EqualFold(answer, o) {
+				return i, nil
+			}
+		}
+	}
+}
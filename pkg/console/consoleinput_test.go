@@ -0,0 +1,194 @@
+package console_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"github.com/freedreamer82/go-console/pkg/console/consoletest"
+)
+
+// askCommand asks the question of its first argument and prints the answer,
+// or the error.
+var askCommand = console.NewConsoleCommand("ask", func(c *console.Console, command *console.ConsoleCommand, args []string) console.CommandError {
+	if len(args) != 1 {
+		return console.BAD_FORMAT
+	}
+	var answer interface{}
+	var err error
+	switch args[0] {
+	case "confirm":
+		answer, err = c.Confirm("Reboot? [y/N]")
+	case "name":
+		answer, err = c.Ask("Name?", "")
+	case "default":
+		answer, err = c.Ask("Name?", "r1")
+	case "secret":
+		var secret string
+		secret, err = c.AskSecret("Password?")
+		answer = fmt.Sprintf("%d chars, %s", len(secret), strings.ToUpper(secret))
+	case "select":
+		answer, err = c.Select("Color?", []string{"red", "green", "blue"})
+	default:
+		return console.BAD_FORMAT
+	}
+	if err != nil {
+		return console.CommandError(err.Error())
+	}
+	c.Print(fmt.Sprint(answer))
+	return console.N0_ERR
+}, "ask confirm|name|default|secret|select")
+
+func TestInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		kind     string
+		question string
+		answers  []string
+		want     string
+	}{
+		{"confirm y", "confirm", "Reboot? [y/N] ", []string{"y"}, "true"},
+		{"confirm yes", "confirm", "Reboot? [y/N] ", []string{" YES "}, "true"},
+		{"confirm n", "confirm", "Reboot? [y/N] ", []string{"n"}, "false"},
+		{"confirm empty", "confirm", "Reboot? [y/N] ", []string{""}, "false"},
+		{"confirm other", "confirm", "Reboot? [y/N] ", []string{"sure"}, "false"},
+		{"ask", "name", "Name? ", []string{" r2 "}, "r2"},
+		{"ask empty", "name", "Name? ", []string{""}, ""},
+		{"ask default", "default", "Name? [r1] ", []string{""}, "r1"},
+		{"ask over default", "default", "Name? [r1] ", []string{"r2"}, "r2"},
+		{"secret", "secret", "Password? ", []string{"hunter2"}, "7 chars, HUNTER2"},
+		{"select number", "select", "Color? [1-3] ", []string{"2"}, "1"},
+		{"select name", "select", "Color? [1-3] ", []string{"Blue"}, "2"},
+		{"select asks again", "select", "Color? [1-3] ", []string{"4", "0", "pink", "1"}, "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := consoletest.NewSession(t, func(c *console.Console) {
+				c.AddConsoleCommand(askCommand)
+			})
+			s.ExpectPrompt()
+			s.Send("ask " + tt.kind)
+			for _, answer := range tt.answers {
+				s.Expect(tt.question)
+				s.Send(answer)
+			}
+			s.Expect(tt.want + "\n")
+			s.ExpectPrompt()
+
+			if tt.kind == "secret" && strings.Contains(s.Transcript(), tt.answers[0]) {
+				t.Errorf("the secret is echoed:\n%s", s.Transcript())
+			}
+			if tt.kind == "select" && !strings.Contains(s.Transcript(), "1) red\n2) green\n3) blue\n") {
+				t.Errorf("the options are not listed:\n%s", s.Transcript())
+			}
+		})
+	}
+}
+
+func TestInputTimeout(t *testing.T) {
+	for _, kind := range []string{"confirm", "name", "secret", "select"} {
+		t.Run(kind, func(t *testing.T) {
+			s := consoletest.NewSession(t, func(c *console.Console) {
+				c.AddConsoleCommand(askCommand)
+				c.AddConsoleCommand(echoCommand)
+			}, console.WithOptionInputTimeout(50*time.Millisecond))
+
+			s.ExpectPrompt()
+			s.Send("ask " + kind)
+			s.ExpectError("context deadline exceeded")
+
+			// the read given up ends when the user types, the line goes to
+			// the console prompt, echoed also after a password
+			if got := s.Run("echo typed"); got != "typed\n" {
+				t.Errorf("echo typed = %q", got)
+			}
+			if got := s.Run("echo after"); got != "after\n" {
+				t.Errorf("echo after = %q", got)
+			}
+		})
+	}
+}
+
+func TestInputTimeoutPartialSecret(t *testing.T) {
+	s := consoletest.NewSession(t, func(c *console.Console) {
+		c.AddConsoleCommand(askCommand)
+		c.AddConsoleCommand(echoCommand)
+	}, console.WithOptionInputTimeout(100*time.Millisecond))
+
+	s.ExpectPrompt()
+	s.Send("ask secret")
+	s.Expect("Password? ")
+	s.SendRaw("hunter")
+	s.ExpectError("context deadline exceeded")
+
+	// what was typed of the password is dropped with the read
+	if got := s.Run("echo after"); got != "after\n" {
+		t.Errorf("echo after = %q", got)
+	}
+	if strings.Contains(s.Transcript(), "hunter") {
+		t.Errorf("the password shows up:\n%s", s.Transcript())
+	}
+}
+
+func TestInputCancel(t *testing.T) {
+	errs := make(chan error, 1)
+	s := consoletest.NewSession(t, func(c *console.Console) {
+		c.AddConsoleCommand(console.NewConsoleCommand("reboot", func(c *console.Console, command *console.ConsoleCommand, args []string) console.CommandError {
+			_, err := c.Confirm("Reboot?")
+			errs <- err
+			return console.N0_ERR
+		}, "reboot"))
+	})
+	s.ExpectPrompt()
+	s.Send("reboot")
+	s.Expect("Reboot? ")
+	s.Console.Stop()
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("Confirm returned no error")
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Confirm did not return")
+	}
+}
+
+func TestInputNotRunning(t *testing.T) {
+	c := console.NewConsole(consoletest.NewPipe().IO())
+	c.AddConsoleCommand(askCommand)
+
+	if err := c.Exec("ask confirm"); err != console.CommandError(console.ErrNoInput.Error()) {
+		t.Errorf("ask confirm = %q", err)
+	}
+
+	if _, err := c.Select("Color?", nil); err == nil {
+		t.Error("Select without options returned no error")
+	}
+}
+
+func TestInputHTTP(t *testing.T) {
+	server := console.NewHTTPConsole()
+	errs := make(chan error, 1)
+	server.AddCallbackOnNewConsole(func(c *console.Console) {
+		reboot := console.NewConsoleCommand("reboot", func(c *console.Console, command *console.ConsoleCommand, args []string) console.CommandError {
+			_, err := c.Confirm("Reboot?")
+			errs <- err
+			return console.N0_ERR
+		}, "reboot")
+		reboot.SetUserLevel(console.Guest)
+		c.AddConsoleCommand(reboot)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/exec", strings.NewReader("reboot"))
+	req.Header.Set("Content-Type", "text/plain")
+	server.ServeHTTP(httptest.NewRecorder(), req)
+	if err := <-errs; !errors.Is(err, console.ErrNoInput) {
+		t.Errorf("Confirm = %v, want ErrNoInput", err)
+	}
+}
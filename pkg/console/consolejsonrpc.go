@@ -0,0 +1,565 @@
+package console
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const jsonRPCVersion = "2.0"
+const jsonRPCMaxLineSize = 1024 * 1024
+const jsonRPCWriteTimeout = 10 * time.Second
+
+// json-rpc 2.0 error codes, -32000 to -32099 are reserved to the server.
+const (
+	JSONRPC_PARSE_ERROR      = -32700
+	JSONRPC_INVALID_REQUEST  = -32600
+	JSONRPC_METHOD_NOT_FOUND = -32601
+	JSONRPC_INVALID_PARAMS   = -32602
+	JSONRPC_UNAUTHORIZED     = -32001
+)
+
+const defaultJSONRPCRejectMessage = `{"jsonrpc":"2.0","method":"rejected","params":{"text":"Too many connections, try again later"}}` + "\n"
+
+// exit codes returned by the json-rpc exec method, they follow the shell
+// conventions.
+const (
+	EXIT_OK        = 0
+	EXIT_ERROR     = 1
+	EXIT_BAD_USAGE = 2
+	EXIT_REFUSED   = 75
+	EXIT_NOT_FOUND = 127
+)
+
+type jsonRPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+type JSONRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type jsonRPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *JSONRPCError   `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type jsonRPCNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params,omitempty"`
+}
+
+// JSONRPCExecParams are the params of the exec method, either the command line
+// or the command with its arguments.
+type JSONRPCExecParams struct {
+	Line    string   `json:"line,omitempty"`
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+}
+
+type JSONRPCExecResult struct {
+	Output   string `json:"output"`
+	Error    string `json:"error,omitempty"`
+	ExitCode int    `json:"exit_code"`
+}
+
+type JSONRPCCommandInfo struct {
+	Command string `json:"command"`
+	Help    string `json:"help"`
+	Level   string `json:"level"`
+}
+
+// JSONRPCConsole serves the console commands to programs: every line sent by
+// the client is a json-rpc 2.0 request (or batch) and every response is a
+// line. The methods are "exec", "commands" and "auth", what is printed on the
+// console outside of a command is sent as a "message" notification.
+type JSONRPCConsole struct {
+	*listenerServer
+	mu                   *sync.RWMutex
+	sessions             []*jsonRPCSession
+	host                 string
+	port                 int
+	network              string
+	tokens               map[string]User
+	callbackOnNewConsole OnNewConsole
+	timeout              time.Duration
+	shutdownNotice       string
+}
+
+type JSONRPCConsoleOption func(console *JSONRPCConsole)
+
+func WithOptionJSONRPCHost(host string) JSONRPCConsoleOption {
+	return func(console *JSONRPCConsole) {
+		console.host = host
+	}
+}
+
+func WithOptionJSONRPCPort(port int) JSONRPCConsoleOption {
+	return func(console *JSONRPCConsole) {
+		console.port = port
+	}
+}
+
+func WithOptionJSONRPCNetwork(network string) JSONRPCConsoleOption {
+	return func(console *JSONRPCConsole) {
+		console.network = network
+	}
+}
+
+func WithOptionJSONRPCKeepAlive(period time.Duration) JSONRPCConsoleOption {
+	return func(console *JSONRPCConsole) {
+		console.keepAlive = period
+	}
+}
+
+func WithOptionJSONRPCListener(listener net.Listener) JSONRPCConsoleOption {
+	return func(console *JSONRPCConsole) {
+		console.listener = listener
+	}
+}
+
+func WithOptionJSONRPCMaxClients(maxclient int) JSONRPCConsoleOption {
+	return func(console *JSONRPCConsole) {
+		console.maxclient = maxclient
+	}
+}
+
+func WithOptionJSONRPCMaxClientsPerIP(maxclient int) JSONRPCConsoleOption {
+	return func(console *JSONRPCConsole) {
+		console.maxclientPerIP = maxclient
+	}
+}
+
+// WithOptionJSONRPCTokens requires the clients to call auth with one of the
+// tokens before running commands, the token gives the user level. Without
+// tokens the sessions are Root, as a console without login.
+func WithOptionJSONRPCTokens(tokens map[string]User) JSONRPCConsoleOption {
+	return func(console *JSONRPCConsole) {
+		console.tokens = tokens
+	}
+}
+
+// WithOptionJSONRPCTimeout closes the connections idle for longer than timeout.
+func WithOptionJSONRPCTimeout(timeout time.Duration) JSONRPCConsoleOption {
+	return func(console *JSONRPCConsole) {
+		console.timeout = timeout
+	}
+}
+
+func WithOptionJSONRPCShutdownNotice(notice string) JSONRPCConsoleOption {
+	return func(console *JSONRPCConsole) {
+		console.shutdownNotice = notice
+	}
+}
+
+// NewJSONRPCConsole creates the console, it starts serving only when Start is
+// called.
+func NewJSONRPCConsole(opts ...JSONRPCConsoleOption) *JSONRPCConsole {
+	c := &JSONRPCConsole{
+		listenerServer: newListenerServer("JSON-RPC"),
+		mu:             &sync.RWMutex{},
+		network:        "tcp",
+		shutdownNotice: defaultShutdownNotice,
+	}
+	c.rejectMessage = defaultJSONRPCRejectMessage
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func (c *JSONRPCConsole) AddCallbackOnNewConsole(cb OnNewConsole) {
+	c.callbackOnNewConsole = cb
+}
+
+func (c *JSONRPCConsole) RemoveCallbackOnNewConsole() {
+	c.callbackOnNewConsole = nil
+}
+
+// Start listens and serves the clients, it blocks until the console is shut
+// down or the listener fails.
+func (c *JSONRPCConsole) Start() error {
+
+	listener, err := c.openListener(c.network, net.JoinHostPort(c.host, strconv.Itoa(c.port)))
+	if err != nil {
+		return err
+	}
+
+	return c.serve(listener, c.handler)
+}
+
+// Notify sends a notification to every connected client.
+func (c *JSONRPCConsole) Notify(method string, params interface{}) error {
+	c.mu.RLock()
+	sessions := append([]*jsonRPCSession(nil), c.sessions...)
+	c.mu.RUnlock()
+
+	var errs []error
+	for _, s := range sessions {
+		errs = append(errs, s.conn.notify(method, params))
+	}
+	return errors.Join(errs...)
+}
+
+// stopAccepting closes the listener and returns the consoles still alive.
+func (c *JSONRPCConsole) stopAccepting() ([]*Console, error) {
+	err := c.closeListener()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	consoles := make([]*Console, 0, len(c.sessions))
+	for _, s := range c.sessions {
+		consoles = append(consoles, s.console)
+	}
+	return consoles, err
+}
+
+// Stop closes the listener and every connection immediately.
+func (c *JSONRPCConsole) Stop() error {
+	consoles, err := c.stopAccepting()
+	for _, console := range consoles {
+		console.Stop()
+	}
+	return err
+}
+
+// Shutdown stops accepting connections, notifies the clients and waits for
+// the running commands to complete until ctx expires, then closes every
+// connection.
+func (c *JSONRPCConsole) Shutdown(ctx context.Context) error {
+	consoles, err := c.stopAccepting()
+	// the notice would end up in the output of the running commands
+	if c.shutdownNotice != "" {
+		c.Notify("shutdown", map[string]string{"text": c.shutdownNotice})
+	}
+	return errors.Join(err, shutdownConsoles(ctx, consoles, ""))
+}
+
+func (c *JSONRPCConsole) addSession(s *jsonRPCSession) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sessions = append(c.sessions, s)
+}
+
+func (c *JSONRPCConsole) removeSession(s *jsonRPCSession) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for idx, cl := range c.sessions {
+		if cl == s {
+			c.sessions = append(c.sessions[:idx], c.sessions[idx+1:]...)
+			break
+		}
+	}
+}
+
+func (c *JSONRPCConsole) handler(conn net.Conn) {
+
+	rpcConn := &jsonRPCConn{conn: conn}
+	console := NewConsole(ConsoleI{rpcConn, rpcConn, rpcConn}, WithOptionOutputFormat(FormatJSON), WithOptionColor(false),
+		WithOptionInteractive(false))
+	// wall and write reach the client as message notifications, even while a
+	// command is running
+	console.notifyHook = func(msg string) error {
+		return rpcConn.notify("message", map[string]string{"text": msg})
+	}
+	s := &jsonRPCSession{server: c, conn: rpcConn, console: console}
+	if len(c.tokens) > 0 {
+		console.SetUserLevel(Guest)
+	}
+
+	if c.callbackOnNewConsole != nil {
+		c.callbackOnNewConsole(console)
+	}
+
+	c.addSession(s)
+	defer c.removeSession(s)
+	defer console.stop(false)
+
+	// with tokens the session joins the session manager once authenticated
+	if len(c.tokens) == 0 {
+		console.joinSessionManager()
+	}
+	defer console.leaveSessionManager()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), jsonRPCMaxLineSize)
+	for {
+		if c.timeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(c.timeout))
+		}
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+				log.Debugf("JSON-RPC connection from %s: %s", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if resp := s.handleLine(line); resp != nil {
+			if err := rpcConn.send(resp); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// jsonRPCConn serialises the responses and the notifications on the
+// connection. While a command is running its output is collected, otherwise
+// what is printed is sent as a message notification on flush.
+type jsonRPCConn struct {
+	conn      net.Conn
+	mu        sync.Mutex
+	out       bytes.Buffer
+	capturing bool
+}
+
+func (conn *jsonRPCConn) Read(b []byte) (int, error) {
+	return conn.conn.Read(b)
+}
+
+func (conn *jsonRPCConn) Write(b []byte) (int, error) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	return conn.out.Write(b)
+}
+
+func (conn *jsonRPCConn) Flush() error {
+	conn.mu.Lock()
+	if conn.capturing || conn.out.Len() == 0 {
+		conn.mu.Unlock()
+		return nil
+	}
+	text := strings.TrimRight(strings.ReplaceAll(conn.out.String(), "\r", ""), "\n")
+	conn.out.Reset()
+	conn.mu.Unlock()
+
+	if text == "" {
+		return nil
+	}
+	return conn.notify("message", map[string]string{"text": text})
+}
+
+func (conn *jsonRPCConn) Close() error {
+	return conn.conn.Close()
+}
+
+func (conn *jsonRPCConn) notify(method string, params interface{}) error {
+	return conn.send(jsonRPCNotification{JSONRPC: jsonRPCVersion, Method: method, Params: params})
+}
+
+func (conn *jsonRPCConn) send(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	// the lock keeps responses and notifications whole on the wire
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	conn.conn.SetWriteDeadline(time.Now().Add(jsonRPCWriteTimeout))
+	_, err = conn.conn.Write(data)
+	return err
+}
+
+// startCapture collects the output of the command about to run, stopCapture
+// returns it.
+func (conn *jsonRPCConn) startCapture() {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	conn.capturing = true
+	conn.out.Reset()
+}
+
+func (conn *jsonRPCConn) stopCapture() string {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	conn.capturing = false
+	output := strings.ReplaceAll(conn.out.String(), "\r", "")
+	conn.out.Reset()
+	return output
+}
+
+type jsonRPCSession struct {
+	server        *JSONRPCConsole
+	conn          *jsonRPCConn
+	console       *Console
+	authenticated bool
+}
+
+// handleLine runs a request or a batch, it returns nil when there is nothing
+// to answer (notifications only).
+func (s *jsonRPCSession) handleLine(line []byte) interface{} {
+
+	if line[0] != '[' {
+		var req jsonRPCRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			return newJSONRPCErrorResponse(nil, JSONRPC_PARSE_ERROR, err.Error())
+		}
+		// a nil *jsonRPCResponse would be answered as null
+		if resp := s.handleRequest(&req); resp != nil {
+			return resp
+		}
+		return nil
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(line, &batch); err != nil {
+		return newJSONRPCErrorResponse(nil, JSONRPC_PARSE_ERROR, err.Error())
+	}
+	if len(batch) == 0 {
+		return newJSONRPCErrorResponse(nil, JSONRPC_INVALID_REQUEST, "empty batch")
+	}
+
+	responses := []*jsonRPCResponse{}
+	for _, raw := range batch {
+		var req jsonRPCRequest
+		var resp *jsonRPCResponse
+		if err := json.Unmarshal(raw, &req); err != nil {
+			resp = newJSONRPCErrorResponse(nil, JSONRPC_INVALID_REQUEST, err.Error())
+		} else {
+			resp = s.handleRequest(&req)
+		}
+		if resp != nil {
+			responses = append(responses, resp)
+		}
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+	return responses
+}
+
+func newJSONRPCErrorResponse(id json.RawMessage, code int, msg string) *jsonRPCResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &jsonRPCResponse{JSONRPC: jsonRPCVersion, Error: &JSONRPCError{Code: code, Message: msg}, ID: id}
+}
+
+func (s *jsonRPCSession) handleRequest(req *jsonRPCRequest) *jsonRPCResponse {
+
+	if req.JSONRPC != jsonRPCVersion || req.Method == "" {
+		return newJSONRPCErrorResponse(req.ID, JSONRPC_INVALID_REQUEST, "invalid request")
+	}
+
+	result, rpcErr := s.call(req.Method, req.Params)
+
+	// a request without id is a notification, it is never answered
+	if req.ID == nil {
+		return nil
+	}
+	if rpcErr != nil {
+		return &jsonRPCResponse{JSONRPC: jsonRPCVersion, Error: rpcErr, ID: req.ID}
+	}
+	return &jsonRPCResponse{JSONRPC: jsonRPCVersion, Result: result, ID: req.ID}
+}
+
+func (s *jsonRPCSession) call(method string, params json.RawMessage) (interface{}, *JSONRPCError) {
+
+	if method == "auth" {
+		return s.auth(params)
+	}
+	if (len(s.server.tokens) > 0 && !s.authenticated) || (s.console.IsLoginEnabled() && !s.console.IsUserLogged()) {
+		return nil, &JSONRPCError{Code: JSONRPC_UNAUTHORIZED, Message: "unauthorized"}
+	}
+
+	switch method {
+	case "exec":
+		return s.exec(params)
+	case "commands":
+		commands := []JSONRPCCommandInfo{}
+		for _, cmd := range s.console.GetCommands() {
+			commands = append(commands, JSONRPCCommandInfo{Command: cmd.GetCommand(), Help: cmd.GetHelp(),
+				Level: cmd.GetUserLevel().String()})
+		}
+		return commands, nil
+	}
+	return nil, &JSONRPCError{Code: JSONRPC_METHOD_NOT_FOUND, Message: "method not found"}
+}
+
+func (s *jsonRPCSession) auth(params json.RawMessage) (interface{}, *JSONRPCError) {
+	var p struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil || p.Token == "" {
+		return nil, &JSONRPCError{Code: JSONRPC_INVALID_PARAMS, Message: "missing token"}
+	}
+
+	for token, level := range s.server.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(p.Token)) == 1 {
+			s.console.Authenticate("token", level)
+			if !s.authenticated {
+				s.console.joinSessionManager()
+			}
+			s.authenticated = true
+			return map[string]string{"level": level.String()}, nil
+		}
+	}
+	log.Warnf("JSON-RPC auth failed from %s", s.conn.conn.RemoteAddr())
+	return nil, &JSONRPCError{Code: JSONRPC_UNAUTHORIZED, Message: "invalid token"}
+}
+
+func (s *jsonRPCSession) exec(params json.RawMessage) (interface{}, *JSONRPCError) {
+	var p JSONRPCExecParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &JSONRPCError{Code: JSONRPC_INVALID_PARAMS, Message: err.Error()}
+	}
+	p.Line = strings.TrimSpace(p.Line)
+	if p.Line == "" && p.Command == "" {
+		return nil, &JSONRPCError{Code: JSONRPC_INVALID_PARAMS, Message: "missing line or command"}
+	}
+
+	s.conn.startCapture()
+	var cmdErr CommandError
+	if p.Command != "" {
+		cmdErr = s.console.ExecArgs(p.Command, p.Args)
+	} else {
+		cmdErr = s.console.Exec(p.Line)
+	}
+	output := s.conn.stopCapture()
+
+	return JSONRPCExecResult{Output: output, Error: string(cmdErr), ExitCode: commandExitCode(cmdErr)}, nil
+}
+
+func commandExitCode(err CommandError) int {
+	switch err {
+	case N0_ERR:
+		return EXIT_OK
+	case CMD_NOT_FOUND:
+		return EXIT_NOT_FOUND
+	case BAD_FORMAT:
+		return EXIT_BAD_USAGE
+	case CMD_REFUSED:
+		return EXIT_REFUSED
+	}
+	return EXIT_ERROR
+}
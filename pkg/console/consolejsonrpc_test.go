@@ -0,0 +1,143 @@
+package console_test
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+)
+
+func startJSONRPC(t *testing.T, setup func(c *console.Console), opts ...console.JSONRPCConsoleOption) (*console.JSONRPCConsole, string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := console.NewJSONRPCConsole(append(opts, console.WithOptionJSONRPCListener(listener))...)
+	if setup != nil {
+		server.AddCallbackOnNewConsole(setup)
+	}
+	serveInBackground(t, server.Start, server.Stop)
+	return server, listener.Addr().String()
+}
+
+// expectJSON waits for the next line and compares it with want as json.
+func (cl *testClient) expectJSON(want string) {
+	cl.t.Helper()
+
+	got := strings.TrimSuffix(cl.expect("\n"), "\n")
+	var gotValue, wantValue interface{}
+	if err := json.Unmarshal([]byte(got), &gotValue); err != nil {
+		cl.t.Fatalf("bad json %q: %s", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		cl.t.Fatalf("bad expected json %q: %s", want, err)
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		cl.t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestJSONRPC(t *testing.T) {
+	type exchange struct {
+		request  string
+		response string
+	}
+	tests := []struct {
+		name      string
+		opts      []console.JSONRPCConsoleOption
+		exchanges []exchange
+	}{
+		{"exec line", nil, []exchange{
+			{`{"jsonrpc":"2.0","id":1,"method":"exec","params":{"line":"echo one two"}}`,
+				`{"jsonrpc":"2.0","id":1,"result":{"output":"one\ntwo\n","exit_code":0}}`},
+		}},
+		{"exec command and args", nil, []exchange{
+			{`{"jsonrpc":"2.0","id":"a","method":"exec","params":{"command":"echo","args":["a b"]}}`,
+				`{"jsonrpc":"2.0","id":"a","result":{"output":"a b\n","exit_code":0}}`},
+		}},
+		{"unknown command", nil, []exchange{
+			{`{"jsonrpc":"2.0","id":1,"method":"exec","params":{"line":"nosuch"}}`,
+				`{"jsonrpc":"2.0","id":1,"result":{"output":"","error":"Command Not Found!","exit_code":127}}`},
+		}},
+		{"missing params", nil, []exchange{
+			{`{"jsonrpc":"2.0","id":1,"method":"exec","params":{}}`,
+				`{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"missing line or command"}}`},
+		}},
+		{"unknown method", nil, []exchange{
+			{`{"jsonrpc":"2.0","id":1,"method":"nosuch"}`,
+				`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method not found"}}`},
+		}},
+		{"invalid request", nil, []exchange{
+			{`{"id":1,"method":"exec"}`,
+				`{"jsonrpc":"2.0","id":1,"error":{"code":-32600,"message":"invalid request"}}`},
+		}},
+		{"notification is not answered", nil, []exchange{
+			{`{"jsonrpc":"2.0","method":"exec","params":{"line":"echo ignored"}}`, ""},
+			{`{"jsonrpc":"2.0","id":2,"method":"exec","params":{"line":"echo two"}}`,
+				`{"jsonrpc":"2.0","id":2,"result":{"output":"two\n","exit_code":0}}`},
+		}},
+		{"batch", nil, []exchange{
+			{`[{"jsonrpc":"2.0","id":1,"method":"exec","params":{"line":"echo one"}},{"jsonrpc":"2.0","method":"exec","params":{"line":"echo x"}},{"jsonrpc":"2.0","id":2,"method":"nosuch"}]`,
+				`[{"jsonrpc":"2.0","id":1,"result":{"output":"one\n","exit_code":0}},{"jsonrpc":"2.0","id":2,"error":{"code":-32601,"message":"method not found"}}]`},
+		}},
+		{"empty batch", nil, []exchange{
+			{`[]`, `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"empty batch"}}`},
+		}},
+		{"tokens", []console.JSONRPCConsoleOption{
+			console.WithOptionJSONRPCTokens(map[string]console.User{"tok": console.Root})}, []exchange{
+			{`{"jsonrpc":"2.0","id":1,"method":"exec","params":{"line":"echo one"}}`,
+				`{"jsonrpc":"2.0","id":1,"error":{"code":-32001,"message":"unauthorized"}}`},
+			{`{"jsonrpc":"2.0","id":2,"method":"auth","params":{"token":"bad"}}`,
+				`{"jsonrpc":"2.0","id":2,"error":{"code":-32001,"message":"invalid token"}}`},
+			{`{"jsonrpc":"2.0","id":3,"method":"auth","params":{"token":"tok"}}`,
+				`{"jsonrpc":"2.0","id":3,"result":{"level":"Root"}}`},
+			{`{"jsonrpc":"2.0","id":4,"method":"exec","params":{"line":"echo one"}}`,
+				`{"jsonrpc":"2.0","id":4,"result":{"output":"one\n","exit_code":0}}`},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, addr := startJSONRPC(t, func(c *console.Console) {
+				c.AddConsoleCommand(echoCommand)
+			}, tt.opts...)
+			cl := dialTestClient(t, "tcp", addr)
+
+			for _, ex := range tt.exchanges {
+				cl.send(ex.request + "\n")
+				if ex.response != "" {
+					cl.expectJSON(ex.response)
+				}
+			}
+		})
+	}
+}
+
+func TestJSONRPCParseError(t *testing.T) {
+	_, addr := startJSONRPC(t, nil)
+	cl := dialTestClient(t, "tcp", addr)
+
+	cl.send("{not json\n")
+	line := cl.expect("\n")
+	if !strings.Contains(line, `"code":-32700`) || !strings.Contains(line, `"id":null`) {
+		t.Errorf("response = %s", line)
+	}
+}
+
+func TestJSONRPCNotify(t *testing.T) {
+	server, addr := startJSONRPC(t, nil)
+	cl := dialTestClient(t, "tcp", addr)
+
+	// a request makes sure the session is served before the notification
+	cl.send(`{"jsonrpc":"2.0","id":1,"method":"commands"}` + "\n")
+	cl.expect("\n")
+
+	if err := server.Notify("alarm", map[string]string{"text": "fan failure"}); err != nil {
+		t.Fatal(err)
+	}
+	cl.expectJSON(`{"jsonrpc":"2.0","method":"alarm","params":{"text":"fan failure"}}`)
+}
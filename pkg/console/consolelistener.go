@@ -0,0 +1,255 @@
+package console
+
+import (
+	"crypto/tls"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"sync"
+	"time"
+)
+
+type RejectReason string
+
+const REJECT_MAX_CLIENTS RejectReason = "max clients reached"
+const REJECT_MAX_CLIENTS_PER_IP RejectReason = "max clients per ip reached"
+
+const defaultRejectMessage = "Too many connections, try again later" + eol
+const rejectTimeout = time.Second
+const maxAcceptDelay = time.Second
+
+// UnlimitedClients removes a client limit, the default of the consoles.
+const UnlimitedClients = -1
+
+type OnRejectConnection func(remote net.Addr, reason RejectReason)
+
+// listenerServer is the accept loop shared by the stream transports (telnet,
+// unix socket, json-rpc): it owns the listener and enforces the client limits.
+type listenerServer struct {
+	lmu              sync.RWMutex
+	name             string
+	listener         net.Listener
+	closing          bool
+	keepAlive        time.Duration
+	maxclient        int
+	maxclientPerIP   int
+	active           int
+	activePerIP      map[string]int
+	rejectMessage    string
+	callbackOnReject OnRejectConnection
+	wrapListener     func(net.Listener) net.Listener
+}
+
+func newListenerServer(name string) *listenerServer {
+	return &listenerServer{name: name, maxclient: UnlimitedClients, maxclientPerIP: UnlimitedClients,
+		rejectMessage: defaultRejectMessage, activePerIP: make(map[string]int)}
+}
+
+// openListener returns the listener provided by the caller, if any, otherwise
+// it listens on address.
+func (s *listenerServer) openListener(network string, address string) (net.Listener, error) {
+	s.lmu.RLock()
+	listener := s.listener
+	s.lmu.RUnlock()
+
+	if listener != nil {
+		return listener, nil
+	}
+	return net.Listen(network, address)
+}
+
+// serve accepts the connections and runs handler on each of them, it blocks
+// until the listener is closed by closeListener or fails.
+func (s *listenerServer) serve(listener net.Listener, handler func(conn net.Conn)) error {
+
+	if s.wrapListener != nil {
+		listener = s.wrapListener(listener)
+	}
+
+	s.lmu.Lock()
+	if s.closing {
+		s.lmu.Unlock()
+		return listener.Close()
+	}
+	s.listener = listener
+	s.lmu.Unlock()
+
+	defer listener.Close()
+
+	var delay time.Duration
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.isClosing() {
+				return nil
+			}
+			// out of file descriptors or aborted connections, as net/http
+			// retry with a backoff
+			if isTemporary(err) {
+				delay = min(max(2*delay, 5*time.Millisecond), maxAcceptDelay)
+				log.Warnf("%s accept error: %v, retrying in %v", s.name, err, delay)
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+
+		s.setKeepAlive(conn)
+
+		if reason, ok := s.reserveSlot(conn); !ok {
+			// a tls client silent during the handshake must not hold up
+			// the accept loop
+			go s.reject(conn, reason)
+			continue
+		}
+		go func() {
+			defer s.releaseSlot(conn)
+			handler(conn)
+		}()
+	}
+}
+
+func isTemporary(err error) bool {
+	var te interface{ Temporary() bool }
+	return errors.As(err, &te) && te.Temporary()
+}
+
+func (s *listenerServer) isClosing() bool {
+	s.lmu.RLock()
+	defer s.lmu.RUnlock()
+
+	return s.closing
+}
+
+// closeListener stops accepting connections, the live ones are left open.
+func (s *listenerServer) closeListener() error {
+	s.lmu.Lock()
+	defer s.lmu.Unlock()
+
+	s.closing = true
+	if s.listener == nil {
+		return nil
+	}
+	err := s.listener.Close()
+	s.listener = nil
+	if errors.Is(err, net.ErrClosed) {
+		err = nil
+	}
+	return err
+}
+
+func remoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// limitReached tells whether active clients fill limit. A limit of 0 still
+// accepts one client, as NewTelnetConsole(port, 0) always did.
+func limitReached(active int, limit int) bool {
+	if limit == UnlimitedClients {
+		return false
+	}
+	return active >= max(limit, 1)
+}
+
+// reserveSlot accounts the connection against the client limits.
+func (s *listenerServer) reserveSlot(conn net.Conn) (RejectReason, bool) {
+	s.lmu.Lock()
+	defer s.lmu.Unlock()
+
+	ip := remoteIP(conn)
+	if limitReached(s.active, s.maxclient) {
+		return REJECT_MAX_CLIENTS, false
+	}
+	if limitReached(s.activePerIP[ip], s.maxclientPerIP) {
+		return REJECT_MAX_CLIENTS_PER_IP, false
+	}
+	s.active++
+	s.activePerIP[ip]++
+	return "", true
+}
+
+func (s *listenerServer) releaseSlot(conn net.Conn) {
+	s.lmu.Lock()
+	defer s.lmu.Unlock()
+
+	ip := remoteIP(conn)
+	s.active--
+	if s.activePerIP[ip]--; s.activePerIP[ip] <= 0 {
+		delete(s.activePerIP, ip)
+	}
+}
+
+func (s *listenerServer) reject(conn net.Conn, reason RejectReason) {
+	log.Warnf("%s connection from %s rejected: %s", s.name, conn.RemoteAddr(), reason)
+
+	if s.rejectMessage != "" {
+		// the tls handshake reads too
+		conn.SetDeadline(time.Now().Add(rejectTimeout))
+		conn.Write([]byte(s.rejectMessage))
+	}
+	conn.Close()
+
+	s.lmu.RLock()
+	cb := s.callbackOnReject
+	s.lmu.RUnlock()
+	if cb != nil {
+		cb(conn.RemoteAddr(), reason)
+	}
+}
+
+func (s *listenerServer) setKeepAlive(conn net.Conn) {
+	if s.keepAlive == 0 {
+		return
+	}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	if s.keepAlive < 0 {
+		tcpConn.SetKeepAlive(false)
+		return
+	}
+	tcpConn.SetKeepAlive(true)
+	tcpConn.SetKeepAlivePeriod(s.keepAlive)
+}
+
+// Addr returns the address the console is listening on, nil if not started.
+func (s *listenerServer) Addr() net.Addr {
+	s.lmu.RLock()
+	defer s.lmu.RUnlock()
+
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+func (s *listenerServer) AddCallbackOnReject(cb OnRejectConnection) {
+	s.lmu.Lock()
+	defer s.lmu.Unlock()
+
+	s.callbackOnReject = cb
+}
+
+func (s *listenerServer) RemoveCallbackOnReject() {
+	s.lmu.Lock()
+	defer s.lmu.Unlock()
+
+	s.callbackOnReject = nil
+}
+
+// GetClientsCount returns the number of connections being served.
+func (s *listenerServer) GetClientsCount() int {
+	s.lmu.RLock()
+	defer s.lmu.RUnlock()
+
+	return s.active
+}
@@ -1,6 +1,8 @@
 package console
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	mqttinfo "github.com/freedreamer82/mqtt-shell/pkg/info"
@@ -9,6 +11,7 @@ import (
 	"io"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -29,17 +32,30 @@ type outMessage struct {
 	cmdUUID    string
 }
 
+// mqttConsoleConnection is the stream of a client session, in is never closed
+// so that the messages received while it closes cannot panic: done ends it.
 type mqttConsoleConnection struct {
+	mu          sync.Mutex
 	uuid        string
 	lastCmdUuid string
 	in          chan []byte
 	out         *chan outMessage
-	isUp        bool
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+func newMqttConsoleConnection(clientUUID string, out *chan outMessage) *mqttConsoleConnection {
+	return &mqttConsoleConnection{uuid: clientUUID, out: out, in: make(chan []byte, 20), done: make(chan struct{})}
 }
 
 func (conn *mqttConsoleConnection) Read(b []byte) (int, error) {
-	data := <-conn.in
-	if data == nil || string(data) == defaultPresentationMessage {
+	var data []byte
+	select {
+	case data = <-conn.in:
+	case <-conn.done:
+		return 0, io.EOF
+	}
+	if string(data) == defaultPresentationMessage {
 		return 0, nil
 	}
 	dataEOF := string(data) + "\r\n"
@@ -47,18 +63,36 @@ func (conn *mqttConsoleConnection) Read(b []byte) (int, error) {
 	return n, nil
 }
 
+// send delivers a message of the client, it is dropped once the connection is
+// closed.
+func (conn *mqttConsoleConnection) send(data []byte, cmdUUID string) {
+	conn.mu.Lock()
+	conn.lastCmdUuid = cmdUUID
+	conn.mu.Unlock()
+
+	select {
+	case conn.in <- data:
+	case <-conn.done:
+	}
+}
+
 func (conn *mqttConsoleConnection) Close() error {
-	conn.isUp = false
-	conn.in <- []byte("onclose")
-	close(conn.in)
+	conn.closeOnce.Do(func() { close(conn.done) })
 	return nil
 }
 
 func (conn *mqttConsoleConnection) Write(b []byte) (int, error) {
-	if conn.isUp {
-		msg := strings.Trim(string(b), "\r\n")
-		*conn.out <- outMessage{msg: msg, clientUUID: conn.uuid, cmdUUID: conn.lastCmdUuid}
+	select {
+	case <-conn.done:
+		return len(b), nil
+	default:
 	}
+	conn.mu.Lock()
+	cmdUUID := conn.lastCmdUuid
+	conn.mu.Unlock()
+
+	msg := strings.Trim(string(b), "\r\n")
+	*conn.out <- outMessage{msg: msg, clientUUID: conn.uuid, cmdUUID: cmdUUID}
 	return len(b), nil
 }
 
@@ -70,6 +104,9 @@ type MqttConsole struct {
 	timeout              time.Duration
 	maxConnections       int
 	chOut                chan outMessage
+	quit                 chan struct{}
+	closing              atomic.Bool
+	shutdownNotice       string
 }
 
 type MqttConsoleOption func(console *MqttConsole)
@@ -86,6 +123,12 @@ func WithOptionMqttConsoleTimeout(timeout time.Duration) MqttConsoleOption {
 	}
 }
 
+func WithOptionMqttConsoleShutdownNotice(notice string) MqttConsoleOption {
+	return func(console *MqttConsole) {
+		console.shutdownNotice = notice
+	}
+}
+
 func (mqttConsole *MqttConsole) AddCallbackOnNewConsole(cb OnNewConsole) {
 	mqttConsole.callbackOnNewConsole = cb
 }
@@ -101,7 +144,7 @@ func (mqttConsole *MqttConsole) countConnections() int {
 
 func NewMqttConsole(mqttOption *mqtt.ClientOptions, instanceID string, opts ...MqttConsoleOption) *MqttConsole {
 
-	mqttConsole := &MqttConsole{maxConnections: 0}
+	mqttConsole := &MqttConsole{maxConnections: 0, shutdownNotice: defaultShutdownNotice}
 
 	txTopic := fmt.Sprintf(templateTxTopic, instanceID)
 	rxTopic := fmt.Sprintf(templateRxTopic, instanceID)
@@ -114,6 +157,7 @@ func NewMqttConsole(mqttOption *mqtt.ClientOptions, instanceID string, opts ...M
 	out := make(chan outMessage, 100)
 
 	mqttConsole.chOut = out
+	mqttConsole.quit = make(chan struct{})
 	mqttConsole.mqttChat = mqttChat
 
 	for _, opt := range opts {
@@ -129,6 +173,47 @@ func (mqttConsole *MqttConsole) Start() {
 	mqttConsole.mqttChat.Start()
 }
 
+// Shutdown stops accepting new clients, sends the shutdown notice to the live
+// sessions and waits for their commands to complete until ctx expires, then
+// closes every session and disconnects from the broker.
+func (mqttConsole *MqttConsole) Shutdown(ctx context.Context) error {
+	if !mqttConsole.closing.CompareAndSwap(false, true) {
+		return errors.New("mqtt console already shut down")
+	}
+	log.Info("SHUTDOWN - MQTT Console")
+
+	var consoles []*Console
+	mqttConsole.consoles.Range(func(k, v interface{}) bool {
+		consoles = append(consoles, v.(*Console))
+		return true
+	})
+
+	errs := []error{shutdownConsoles(ctx, consoles, mqttConsole.shutdownNotice)}
+	errs = append(errs, mqttConsole.drainOutput(ctx))
+
+	close(mqttConsole.quit)
+	if mqttConsole.mqttChat.IsRunning() {
+		mqttConsole.mqttChat.Stop()
+	}
+
+	return errors.Join(errs...)
+}
+
+// drainOutput waits until the pending messages have been transmitted.
+func (mqttConsole *MqttConsole) drainOutput(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for len(mqttConsole.chOut) > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("pending mqtt output: %w", ctx.Err())
+		}
+	}
+	return nil
+}
+
 func (mqttConsole *MqttConsole) removeConsoleAndConnection(clientUUID string) {
 	log.Infof("Close mqtt connection with client: %s", clientUUID)
 	mqttConsole.connections.Delete(clientUUID)
@@ -136,8 +221,7 @@ func (mqttConsole *MqttConsole) removeConsoleAndConnection(clientUUID string) {
 }
 
 func (mqttConsole *MqttConsole) createNewConsoleAndConnection(clientUUID string) (*Console, *mqttConsoleConnection) {
-	in := make(chan []byte, 20)
-	conn := &mqttConsoleConnection{uuid: clientUUID, out: &mqttConsole.chOut, in: in, isUp: true}
+	conn := newMqttConsoleConnection(clientUUID, &mqttConsole.chOut)
 
 	mqttConsole.connections.Store(clientUUID, conn)
 
@@ -151,7 +235,9 @@ func (mqttConsole *MqttConsole) createNewConsoleAndConnection(clientUUID string)
 		nil,
 	}
 
-	console := NewConsole(consoleIO, WithOptionCustomUUID(clientUUID))
+	// the mqtt client shows its own prompt
+	console := NewConsole(consoleIO, WithOptionCustomUUID(clientUUID), WithOptionOutputFormat(FormatJSON), WithOptionColor(false),
+		WithOptionInteractive(false), WithOptionPrompt(""))
 	console.AddCallbackOnClose(func() {
 		mqttConsole.removeConsoleAndConnection(clientUUID)
 	})
@@ -175,6 +261,10 @@ func (mqttConsole *MqttConsole) onDataRx(data mqttchat.MqttJsonData) {
 		return
 	}
 
+	if mqttConsole.closing.Load() {
+		return
+	}
+
 	_, consoleExist := mqttConsole.consoles.Load(data.ClientUUID)
 
 	if !consoleExist {
@@ -196,9 +286,7 @@ func (mqttConsole *MqttConsole) onDataRx(data mqttchat.MqttJsonData) {
 		return
 	}
 
-	mqttConn := conn.(*mqttConsoleConnection)
-	mqttConn.lastCmdUuid = data.CmdUUID
-	mqttConn.in <- []byte(data.Data)
+	conn.(*mqttConsoleConnection).send([]byte(data.Data), data.CmdUUID)
 
 }
 
@@ -211,13 +299,14 @@ func (mqttConsole *MqttConsole) dataTx() {
 				if outMsg == "\r\n" {
 					outMsg = ""
 				}
-				outMsg = strings.Replace(outMsg, ">", "", -1)
 				data := mqttchat.NewMqttJsonDataEmpty()
-				data.Data =  outMsg
-				data.CmdUUID =  out.cmdUUID
+				data.Data = outMsg
+				data.CmdUUID = out.cmdUUID
 				data.ClientUUID = out.clientUUID
 				mqttConsole.mqttChat.Transmit(data)
 			}
+		case <-mqttConsole.quit:
+			return
 		}
 	}
 }
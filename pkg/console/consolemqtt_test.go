@@ -0,0 +1,60 @@
+package console_test
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+)
+
+func TestMqttConnectionClose(t *testing.T) {
+	conn, send := console.NewMqttConnection()
+
+	buf := make([]byte, 64)
+	send("echo one")
+	if n, err := conn.Read(buf); err != nil || string(buf[:n]) != "echo one\r\n" {
+		t.Fatalf("Read = %q, %v", buf[:n], err)
+	}
+
+	// the messages keep arriving while the session closes, more than the
+	// connection buffers
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				send("late")
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(testTimeout):
+		t.Fatal("send blocked after Close")
+	}
+
+	for {
+		if _, err := conn.Read(buf); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Read = %v", err)
+		}
+	}
+	if n, err := conn.Write([]byte("output")); n != 6 || err != nil {
+		t.Errorf("Write after Close = %d, %v", n, err)
+	}
+}
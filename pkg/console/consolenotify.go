@@ -0,0 +1,105 @@
+package console
+
+import (
+	"sort"
+	"strings"
+)
+
+// Notify prints msg on the session from any goroutine. It goes above the line
+// being typed, which is then reprinted with the prompt, and never into the
+// output of the running command (pipes, redirections, pager). It returns false
+// when the session muted the notifications or unsubscribed from topic.
+func (c *Console) Notify(topic string, msg string) bool {
+	c.mu.Lock()
+	muted := c.notifyMuted || c.notifyExcluded[topic]
+	c.mu.Unlock()
+
+	if muted {
+		return false
+	}
+	return c.notify(msg)
+}
+
+func (c *Console) notify(msg string) bool {
+	c.mu.Lock()
+	c.clearProgress()
+	hook := c.notifyHook
+	c.mu.Unlock()
+
+	if hook != nil {
+		// the transport delivers it on its own, e.g. as a json-rpc notification
+		return hook(msg) == nil
+	}
+
+	text := c.styled(func(t Theme) string { return t.Notice }, msg)
+	if _, err := c.term.Write([]byte(text + "\n")); err != nil {
+		return false
+	}
+	c.flush()
+	return true
+}
+
+// MuteNotifications stops or restarts the notifications of the session.
+func (c *Console) MuteNotifications(muted bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.notifyMuted = muted
+}
+
+// Subscribe restores the notifications of the topics, the sessions get all
+// the topics until they unsubscribe.
+func (c *Console) Subscribe(topics ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, t := range topics {
+		delete(c.notifyExcluded, t)
+	}
+}
+
+func (c *Console) Unsubscribe(topics ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.notifyExcluded == nil {
+		c.notifyExcluded = make(map[string]bool)
+	}
+	for _, t := range topics {
+		c.notifyExcluded[t] = true
+	}
+}
+
+func (c *Console) cmdNotifications(console *Console, command *ConsoleCommand, args []string) CommandError {
+	switch {
+	case len(args) == 0:
+		c.mu.Lock()
+		muted := c.notifyMuted
+		excluded := make([]string, 0, len(c.notifyExcluded))
+		for t := range c.notifyExcluded {
+			excluded = append(excluded, t)
+		}
+		c.mu.Unlock()
+
+		sort.Strings(excluded)
+		if muted {
+			c.Print("notifications off")
+		} else {
+			c.Print("notifications on")
+		}
+		if len(excluded) > 0 {
+			c.Print("unsubscribed: " + strings.Join(excluded, " "))
+		}
+	case len(args) == 1 && args[0] == "on":
+		c.MuteNotifications(false)
+	case len(args) == 1 && args[0] == "off":
+		c.MuteNotifications(true)
+	case len(args) > 1 && args[0] == "subscribe":
+		c.Subscribe(args[1:]...)
+	case len(args) > 1 && args[0] == "unsubscribe":
+		c.Unsubscribe(args[1:]...)
+	default:
+		return BAD_FORMAT
+	}
+	return N0_ERR
+}
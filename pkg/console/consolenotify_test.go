@@ -0,0 +1,142 @@
+package console_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"github.com/freedreamer82/go-console/pkg/console/consoletest"
+)
+
+func TestNotify(t *testing.T) {
+	type notice struct {
+		topic string
+		msg   string
+		want  bool
+	}
+	tests := []struct {
+		name    string
+		opts    []console.ConsoleOption
+		setup   func(c *console.Console)
+		notices []notice
+		want    string
+	}{
+		{name: "plain", notices: []notice{{"link", "eth0 down", true}}, want: "eth0 down\r\n"},
+		{name: "colors", opts: []console.ConsoleOption{console.WithOptionColor(true)},
+			notices: []notice{{"link", "eth0 down", true}}, want: "\x1b[36meth0 down\x1b[0m\r\n"},
+		{name: "muted", setup: func(c *console.Console) { c.MuteNotifications(true) },
+			notices: []notice{{"link", "eth0 down", false}}, want: ""},
+		{name: "unmuted", setup: func(c *console.Console) {
+			c.MuteNotifications(true)
+			c.MuteNotifications(false)
+		}, notices: []notice{{"link", "eth0 down", true}}, want: "eth0 down\r\n"},
+		{name: "unsubscribed", setup: func(c *console.Console) { c.Unsubscribe("link", "config") },
+			notices: []notice{{"link", "eth0 down", false}, {"config", "changed", false}, {"alarm", "fan", true}},
+			want:    "fan\r\n"},
+		{name: "subscribed again", setup: func(c *console.Console) {
+			c.Unsubscribe("link", "config")
+			c.Subscribe("link")
+		}, notices: []notice{{"link", "eth0 down", true}, {"config", "changed", false}}, want: "eth0 down\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipe := consoletest.NewPipe()
+			c := console.NewConsole(pipe.IO(), tt.opts...)
+			if tt.setup != nil {
+				tt.setup(c)
+			}
+			for _, n := range tt.notices {
+				if got := c.Notify(n.topic, n.msg); got != n.want {
+					t.Errorf("Notify(%s, %s) = %v, want %v", n.topic, n.msg, got, n.want)
+				}
+			}
+			if got, _, _ := pipe.Output(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotificationsBuiltin(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{"on by default", []string{"notifications"}, "notifications on\n"},
+		{"off", []string{"notifications off", "notifications"}, "notifications off\n"},
+		{"on", []string{"notifications off", "notifications on", "notifications"}, "notifications on\n"},
+		{"unsubscribe", []string{"notifications unsubscribe link config", "notifications"},
+			"notifications on\nunsubscribed: config link\n"},
+		{"subscribe", []string{"notifications unsubscribe link config", "notifications subscribe config", "notifications"},
+			"notifications on\nunsubscribed: link\n"},
+		{"subscribe without topics", []string{"notifications subscribe"}, string(console.BAD_FORMAT) + "\n"},
+		{"bad argument", []string{"notifications maybe"}, string(console.BAD_FORMAT) + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := consoletest.NewSession(t, nil)
+			if got := runLines(s, tt.lines...); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// the builtin drives the notifications of the session
+	s := consoletest.NewSession(t, nil)
+	s.Run("notifications unsubscribe link")
+	if s.Console.Notify("link", "eth0 down") {
+		t.Error("notified an unsubscribed topic")
+	}
+	s.Run("notifications off")
+	if s.Console.Notify("alarm", "fan") {
+		t.Error("notified a muted session")
+	}
+}
+
+func TestNotifyAboveInput(t *testing.T) {
+	s := consoletest.NewSession(t, func(c *console.Console) {
+		c.AddConsoleCommand(echoCommand)
+	})
+	s.ExpectPrompt()
+
+	// the line being typed is reprinted after the notice
+	s.SendRaw("echo he")
+	s.Expect("echo he")
+	if !s.Console.Notify("link", "eth0 down") {
+		t.Fatal("Notify failed")
+	}
+	s.Expect("eth0 down\n> echo he")
+	s.SendRaw("llo\r")
+	s.Expect("hello\n")
+	s.ExpectPrompt()
+}
+
+func TestNotifyDuringCommand(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s := consoletest.NewSession(t, func(c *console.Console) {
+		c.AddConsoleCommand(console.NewConsoleCommand("wait", func(c *console.Console, command *console.ConsoleCommand, args []string) console.CommandError {
+			c.Print("before")
+			close(started)
+			<-release
+			c.Print("after")
+			return console.N0_ERR
+		}, "wait to be released"))
+	})
+	s.ExpectPrompt()
+	s.Send("wait > @out")
+	<-started
+	s.Console.Notify("link", "eth0 down")
+	close(release)
+	s.Expect("eth0 down\n")
+	s.ExpectPrompt()
+
+	// the notice is not part of the output of the command
+	if text, _ := s.Console.GetBuffer("out"); text != "before\nafter\n" {
+		t.Errorf("buffer = %q", text)
+	}
+	if strings.Contains(s.Transcript(), "before") {
+		t.Errorf("the redirected output reached the terminal:\n%s", s.Transcript())
+	}
+}
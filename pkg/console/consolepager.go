@@ -0,0 +1,139 @@
+package console
+
+const pagerPrompt = "--More--"
+const eraseLine = "\r\x1b[K"
+
+// WithOptionPager pauses the output of the commands every terminal height
+// lines: space shows the next page, enter the next line and q aborts the
+// command. It only applies to the commands typed on interactive sessions.
+func WithOptionPager(enabled bool) ConsoleOption {
+	return func(console *Console) {
+		console.pagerEnabled = enabled
+	}
+}
+
+// WithOptionInteractive set to false marks the sessions whose output is read
+// by a program, the pager is never used on them.
+func WithOptionInteractive(interactive bool) ConsoleOption {
+	return func(console *Console) {
+		console.nonInteractive = !interactive
+	}
+}
+
+func (c *Console) SetPager(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pagerEnabled = enabled
+}
+
+func (c *Console) IsPagerEnabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.pagerEnabled && !c.nonInteractive
+}
+
+// pager counts the lines written on the terminal during a command and waits
+// for a key when a page is full.
+type pager struct {
+	console *Console
+	lines   int
+	aborted bool
+	cr      bool
+}
+
+// startPager pages the output of the command typed by the user, if enabled.
+func (c *Console) startPager() {
+	if !c.IsPagerEnabled() {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pager = &pager{console: c}
+}
+
+func (c *Console) stopPager() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pager = nil
+}
+
+func (p *pager) Write(b []byte) (int, error) {
+	c := p.console
+	_, height := c.GetSize()
+	pageLines := height - 1
+
+	for start := 0; start < len(b); {
+		if p.aborted {
+			// the rest of the output is dropped
+			return len(b), nil
+		}
+		if pageLines > 0 && p.lines >= pageLines && !p.more(pageLines) {
+			p.aborted = true
+			continue
+		}
+
+		end := len(b)
+		for i := start; i < len(b); i++ {
+			if b[i] == '\n' {
+				end = i + 1
+				p.lines++
+				break
+			}
+		}
+		if _, err := c.term.Write(b[start:end]); err != nil {
+			return start, err
+		}
+		start = end
+	}
+	return len(b), nil
+}
+
+// more shows the pager prompt and waits for a key, it returns false when the
+// output is aborted.
+func (p *pager) more(pageLines int) bool {
+	c := p.console
+
+	c.mu.Lock()
+	reading := c.pendingRead != nil
+	c.mu.Unlock()
+	if reading {
+		// a question given up is still reading the terminal
+		p.lines = 0
+		return true
+	}
+
+	c.term.Write([]byte(c.styled(func(t Theme) string { return t.Heading }, pagerPrompt)))
+	c.flush()
+
+	key := make([]byte, 1)
+	for {
+		if _, err := c.input.Read(key); err != nil {
+			return false
+		}
+		// enter may come as \r\n or \r\0
+		if p.cr && (key[0] == '\n' || key[0] == 0) {
+			p.cr = false
+			continue
+		}
+		p.cr = key[0] == '\r'
+		switch key[0] {
+		case ' ':
+			p.lines = 0
+		case '\r', '\n':
+			p.lines = pageLines - 1
+		case 'q', 'Q', 3:
+			c.term.Write([]byte(eraseLine))
+			c.abortCommand()
+			return false
+		default:
+			continue
+		}
+		c.term.Write([]byte(eraseLine))
+		return true
+	}
+}
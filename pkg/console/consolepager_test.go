@@ -0,0 +1,176 @@
+package console_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"github.com/freedreamer82/go-console/pkg/console/consoletest"
+)
+
+// linesCommand prints "line 1" to "line N".
+var linesCommand = console.NewConsoleCommand("lines", func(c *console.Console, command *console.ConsoleCommand, args []string) console.CommandError {
+	if len(args) != 1 {
+		return console.BAD_FORMAT
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return console.BAD_FORMAT
+	}
+	for i := 1; i <= n; i++ {
+		c.Print(fmt.Sprintf("line %d", i))
+	}
+	return console.N0_ERR
+}, "lines N, print N lines")
+
+// newStreamCommand returns a command printing lines until its context is
+// done, the error of the context is sent on the channel.
+func newStreamCommand() (*console.ConsoleCommand, chan error) {
+	done := make(chan error, 1)
+	cmd := console.NewConsoleCommand("stream", func(c *console.Console, command *console.ConsoleCommand, args []string) console.CommandError {
+		ctx := c.Context()
+		for i := 1; ctx.Err() == nil; i++ {
+			c.Print(fmt.Sprintf("line %d", i))
+		}
+		done <- ctx.Err()
+		return console.N0_ERR
+	}, "print lines until interrupted")
+	return cmd, done
+}
+
+func newPagerSession(t *testing.T, height int, opts ...console.ConsoleOption) *consoletest.Session {
+	return consoletest.NewSession(t, func(c *console.Console) {
+		c.AddConsoleCommand(linesCommand)
+		c.SetSize(80, height)
+	}, opts...)
+}
+
+func TestPager(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []console.ConsoleOption
+		height int
+		line   string
+		keys   []string
+		want   string
+	}{
+		{name: "disabled by default", height: 4, line: "lines 5",
+			want: "line 1\nline 2\nline 3\nline 4\nline 5\n"},
+		{name: "page fits", opts: []console.ConsoleOption{console.WithOptionPager(true)}, height: 4, line: "lines 3",
+			want: "line 1\nline 2\nline 3\n"},
+		{name: "space", opts: []console.ConsoleOption{console.WithOptionPager(true)}, height: 4, line: "lines 7",
+			keys: []string{" ", " "},
+			want: "line 1\nline 2\nline 3\n--More--line 4\nline 5\nline 6\n--More--line 7\n"},
+		{name: "enter", opts: []console.ConsoleOption{console.WithOptionPager(true)}, height: 4, line: "lines 5",
+			keys: []string{"\r", "\r\n"},
+			want: "line 1\nline 2\nline 3\n--More--line 4\n--More--line 5\n"},
+		{name: "other keys are ignored", opts: []console.ConsoleOption{console.WithOptionPager(true)}, height: 4, line: "lines 4",
+			keys: []string{"x "},
+			want: "line 1\nline 2\nline 3\n--More--line 4\n"},
+		{name: "q", opts: []console.ConsoleOption{console.WithOptionPager(true)}, height: 4, line: "lines 7",
+			keys: []string{"q"},
+			want: "line 1\nline 2\nline 3\n--More--"},
+		{name: "pipes", opts: []console.ConsoleOption{console.WithOptionPager(true)}, height: 4, line: "lines 5 | grep line",
+			keys: []string{" "},
+			want: "line 1\nline 2\nline 3\n--More--line 4\nline 5\n"},
+		{name: "redirection", opts: []console.ConsoleOption{console.WithOptionPager(true)}, height: 4, line: "lines 5 > @out",
+			want: ""},
+		{name: "no height", opts: []console.ConsoleOption{console.WithOptionPager(true)}, height: 0, line: "lines 5",
+			want: "line 1\nline 2\nline 3\nline 4\nline 5\n"},
+		{name: "non interactive", opts: []console.ConsoleOption{console.WithOptionPager(true), console.WithOptionInteractive(false)},
+			height: 4, line: "lines 5",
+			want: "line 1\nline 2\nline 3\nline 4\nline 5\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newPagerSession(t, tt.height, tt.opts...)
+			s.ExpectPrompt()
+			s.Send(tt.line)
+			s.Expect(tt.line + "\n")
+			for _, key := range tt.keys {
+				s.Expect("--More--")
+				s.SendRaw(key)
+			}
+
+			s.ExpectPrompt()
+			if got := s.Transcript(); !strings.HasSuffix(got, tt.line+"\n"+tt.want+"> ") {
+				t.Errorf("output = %q, want suffix %q", got, tt.want+"> ")
+			}
+		})
+	}
+}
+
+func TestPagerAbort(t *testing.T) {
+	stream, done := newStreamCommand()
+	s := consoletest.NewSession(t, func(c *console.Console) {
+		c.AddConsoleCommand(stream)
+		c.SetSize(80, 4)
+	}, console.WithOptionPager(true))
+
+	s.ExpectPrompt()
+	s.Send("stream")
+	s.Expect("line 3\n--More--")
+	s.SendRaw("q")
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("context error = %v", err)
+	}
+	s.ExpectPrompt()
+
+	// the next command is paged again
+	s.Send("stream")
+	s.Expect("line 3\n--More--")
+	s.SendRaw("\x03")
+	<-done
+	s.ExpectPrompt()
+}
+
+func TestPagerSetting(t *testing.T) {
+	c := console.NewConsole(consoletest.NewPipe().IO())
+	if c.IsPagerEnabled() {
+		t.Error("pager enabled by default")
+	}
+	c.SetPager(true)
+	if !c.IsPagerEnabled() {
+		t.Error("SetPager(true) not applied")
+	}
+
+	c = console.NewConsole(consoletest.NewPipe().IO(), console.WithOptionPager(true), console.WithOptionInteractive(false))
+	if c.IsPagerEnabled() {
+		t.Error("pager enabled on a non interactive session")
+	}
+}
+
+func TestSSHPager(t *testing.T) {
+	sessions := make(chan *console.Console, 1)
+	_, addr := startSSH(t, func(c *console.Console) {
+		c.AddConsoleCommand(linesCommand)
+		c.SetPager(true)
+		sessions <- c
+	})
+
+	cl := dialSSH(t, addr, 100, 4)
+	c := <-sessions
+	cl.expectPrompt()
+	if w, h := c.GetSize(); w != 100 || h != 4 {
+		t.Errorf("size = %dx%d, want 100x4", w, h)
+	}
+	cl.send("lines 4\r")
+	cl.expect("line 3\n--More--")
+	cl.send(" ")
+	cl.expect("line 4\n")
+
+	cl.resize(100, 3)
+	waitFor(t, "window-change", func() bool {
+		_, h := c.GetSize()
+		return h == 3
+	})
+	cl.expectPrompt()
+	cl.send("lines 3\r")
+	cl.expect("line 2\n--More--")
+	cl.send("q")
+	cl.expectPrompt()
+}
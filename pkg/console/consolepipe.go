@@ -0,0 +1,355 @@
+package console
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const FILTER_NOT_FOUND CommandError = "Filter Not Found!"
+
+// outputFilter transforms the lines printed by a command, args are the
+// arguments of the filter in the pipeline.
+type outputFilter func(ctx context.Context, args []string, lines []string) ([]string, error)
+
+var outputFilters = map[string]outputFilter{
+	"grep":  filterGrep,
+	"head":  filterHead,
+	"tail":  filterTail,
+	"wc":    filterWc,
+	"count": filterCount,
+	"sort":  filterSort,
+}
+
+// writer returns where the console output goes: the innermost capture, the
+// pager or the terminal.
+func (c *Console) writer() io.Writer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if n := len(c.captures); n > 0 {
+		return c.captures[n-1]
+	}
+	c.clearProgress()
+	if c.pager != nil {
+		return c.pager
+	}
+	return c.term
+}
+
+// startCapture collects what is printed until endCapture, captures nest.
+func (c *Console) startCapture() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.captures = append(c.captures, &bytes.Buffer{})
+}
+
+func (c *Console) endCapture() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(c.captures)
+	out := c.captures[n-1].String()
+	c.captures = c.captures[:n-1]
+	return out
+}
+
+// splitUnquoted splits s on the sep characters outside quotes, the quotes are
+// kept.
+func splitUnquoted(s string, sep rune) []string {
+	var parts []string
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == sep:
+			parts = append(parts, s[start:i])
+			start = i + len(string(sep))
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// splitArgs splits the arguments of a filter on the spaces, quotes group
+// spaces and are removed.
+func splitArgs(s string) []string {
+	var args []string
+	var cur strings.Builder
+	var quote rune
+	inArg := false
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args
+}
+
+// execPipeline runs a command line whose output can go through filters and be
+// redirected, e.g. "show routes | grep 10.0 | head 20 > @routes".
+func (c *Console) execPipeline(line string, expanding []string) CommandError {
+
+	stages := splitUnquoted(line, '|')
+	last := len(stages) - 1
+	redir, ok := parseRedirect(stages[last])
+	if !ok {
+		return BAD_FORMAT
+	}
+	if redir != nil {
+		stages[last] = redir.command
+	}
+	if len(stages) == 1 && redir == nil {
+		return c.execExpanded(line, expanding)
+	}
+
+	type stage struct {
+		filter outputFilter
+		args   []string
+	}
+	var filters []stage
+	for _, s := range stages[1:] {
+		args := splitArgs(s)
+		if len(args) == 0 {
+			return BAD_FORMAT
+		}
+		filter, ok := outputFilters[args[0]]
+		if !ok {
+			return FILTER_NOT_FOUND
+		}
+		filters = append(filters, stage{filter, args[1:]})
+	}
+	if redir != nil {
+		if err := c.checkRedirect(redir); err != N0_ERR {
+			return err
+		}
+	}
+
+	c.startCapture()
+	cmdErr := c.execExpanded(strings.TrimSpace(stages[0]), expanding)
+	output := c.endCapture()
+
+	lines := strings.Split(strings.ReplaceAll(output, "\r", ""), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	ctx := c.Context()
+	for _, f := range filters {
+		var err error
+		if lines, err = f.filter(ctx, f.args, lines); err != nil {
+			return CommandError(err.Error())
+		}
+	}
+
+	if redir != nil {
+		if err := c.writeRedirect(redir, lines); err != N0_ERR {
+			return err
+		}
+		return cmdErr
+	}
+	for _, l := range lines {
+		c.Print(l)
+	}
+	return cmdErr
+}
+
+func filterGrep(ctx context.Context, args []string, lines []string) ([]string, error) {
+
+	ignoreCase, invert := false, false
+	var pattern string
+	for i, arg := range args {
+		if arg == "-i" {
+			ignoreCase = true
+		} else if arg == "-v" {
+			invert = true
+		} else if arg == "-iv" || arg == "-vi" {
+			ignoreCase, invert = true, true
+		} else {
+			pattern = strings.Join(args[i:], " ")
+			break
+		}
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("grep: missing pattern")
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("grep: %s", err)
+	}
+
+	var out []string
+	for _, l := range lines {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if re.MatchString(l) != invert {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+// countArg parses the line count of head and tail, "N" or "-n N".
+func countArg(name string, args []string) (int, error) {
+	if len(args) == 2 && args[0] == "-n" {
+		args = args[1:]
+	}
+	switch len(args) {
+	case 0:
+		return 10, nil
+	case 1:
+		n, err := strconv.Atoi(strings.TrimPrefix(args[0], "-"))
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%s: invalid count %q", name, args[0])
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("%s: too many arguments", name)
+}
+
+func filterHead(ctx context.Context, args []string, lines []string) ([]string, error) {
+	n, err := countArg("head", args)
+	if err != nil {
+		return nil, err
+	}
+	if n < len(lines) {
+		lines = lines[:n]
+	}
+	return lines, nil
+}
+
+func filterTail(ctx context.Context, args []string, lines []string) ([]string, error) {
+	n, err := countArg("tail", args)
+	if err != nil {
+		return nil, err
+	}
+	if n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+func filterWc(ctx context.Context, args []string, lines []string) ([]string, error) {
+	words, chars := 0, 0
+	for _, l := range lines {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		words += len(strings.Fields(l))
+		chars += utf8.RuneCountInString(l) + 1
+	}
+
+	if len(args) == 1 && args[0] == "-l" {
+		return []string{strconv.Itoa(len(lines))}, nil
+	}
+	if len(args) > 0 {
+		return nil, fmt.Errorf("wc: unsupported arguments %v", args)
+	}
+	return []string{fmt.Sprintf("%d %d %d", len(lines), words, chars)}, nil
+}
+
+func filterCount(ctx context.Context, args []string, lines []string) ([]string, error) {
+	return []string{strconv.Itoa(len(lines))}, nil
+}
+
+func filterSort(ctx context.Context, args []string, lines []string) ([]string, error) {
+	reverse, numeric, unique := false, false, false
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			return nil, fmt.Errorf("sort: unsupported argument %q", arg)
+		}
+		for _, flag := range arg[1:] {
+			switch flag {
+			case 'r':
+				reverse = true
+			case 'n':
+				numeric = true
+			case 'u':
+				unique = true
+			default:
+				return nil, fmt.Errorf("sort: unsupported flag -%c", flag)
+			}
+		}
+	}
+
+	out := append([]string(nil), lines...)
+	less := func(a, b string) bool { return a < b }
+	if numeric {
+		less = func(a, b string) bool {
+			na, errA := strconv.ParseFloat(firstField(a), 64)
+			nb, errB := strconv.ParseFloat(firstField(b), 64)
+			if errA != nil || errB != nil {
+				// the lines that are not numbers come first, as sort -n
+				if (errA != nil) != (errB != nil) {
+					return errA != nil
+				}
+				return a < b
+			}
+			return na < nb
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if reverse {
+			return less(out[j], out[i])
+		}
+		return less(out[i], out[j])
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if unique {
+		dedup := out[:0]
+		for i, l := range out {
+			if i == 0 || l != out[i-1] {
+				dedup = append(dedup, l)
+			}
+		}
+		out = dedup
+	}
+	return out, nil
+}
+
+func firstField(s string) string {
+	if fields := strings.Fields(s); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
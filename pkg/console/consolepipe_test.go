@@ -0,0 +1,57 @@
+package console_test
+
+import (
+	"testing"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"github.com/freedreamer82/go-console/pkg/console/consoletest"
+)
+
+func TestPipe(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"fruits | grep an", "banana 3\norange 10\n"},
+		{"fruits | grep -i APPLE", "apple 2\nApple 7\n"},
+		{"fruits | grep -v an", "apple 2\ncherry 1\nApple 7\n"},
+		{"fruits | grep -vi apple", "banana 3\norange 10\ncherry 1\n"},
+		{"fruits | grep 'e 1'", "orange 10\n"},
+		{"fruits | grep ^[ab]", "apple 2\nbanana 3\n"},
+		{"fruits | head 2", "apple 2\nbanana 3\n"},
+		{"fruits | head -n 1", "apple 2\n"},
+		{"fruits | tail -2", "cherry 1\nApple 7\n"},
+		{"fruits | wc", "5 10 44\n"},
+		{"fruits | wc -l", "5\n"},
+		{"echo héllo wörld | wc", "2 2 12\n"},
+		{"fruits | count", "5\n"},
+		{"fruits | sort", "Apple 7\napple 2\nbanana 3\ncherry 1\norange 10\n"},
+		{"fruits | sort -r | head 1", "orange 10\n"},
+		{"numbers | sort -n", "x\n1\n2\n10\n"},
+		{"numbers | sort -nr", "10\n2\n1\nx\n"},
+		{"dups | sort -u", "a\nb\n"},
+		{"fruits | grep an | count", "2\n"},
+		{"echo 'a|b' | count", "1\n"},
+		{"fruits | nosuch", string(console.FILTER_NOT_FOUND) + "\n"},
+		{"fruits |", string(console.BAD_FORMAT) + "\n"},
+		{"fruits | grep", "grep: missing pattern\n"},
+		{"fruits | grep (", "grep: error parsing regexp: missing closing ): `(`\n"},
+		{"fruits | head x", "head: invalid count \"x\"\n"},
+		{"fruits | wc -w", "wc: unsupported arguments [-w]\n"},
+		{"fruits | sort -z", "sort: unsupported flag -z\n"},
+		{"nosuch | count", "0\n" + string(console.CMD_NOT_FOUND) + "\n"},
+	}
+	s := consoletest.NewSession(t, func(c *console.Console) {
+		c.AddConsoleCommand(echoCommand)
+		c.AddConsoleCommand(newCommand("fruits", "apple 2", "banana 3", "orange 10", "cherry 1", "Apple 7"))
+		c.AddConsoleCommand(newCommand("numbers", "10", "x", "2", "1"))
+		c.AddConsoleCommand(newCommand("dups", "b", "a", "b", "a"))
+	})
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := s.Run(tt.line); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
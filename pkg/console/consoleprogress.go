@@ -0,0 +1,238 @@
+package console
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const progressRedraw = 100 * time.Millisecond
+const defaultProgressInterval = 5 * time.Second
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// WithOptionProgressInterval sets how often the progress is printed on the
+// sessions that cannot redraw it in place, 5 seconds by default.
+func WithOptionProgressInterval(interval time.Duration) ConsoleOption {
+	return func(console *Console) {
+		console.progressInterval = interval
+	}
+}
+
+// Progress shows the progress of a long command: a bar, or a spinner when the
+// total is unknown. It is redrawn in place on the interactive terminals and
+// printed as a line every progress interval on the other sessions.
+type Progress struct {
+	mu       sync.Mutex
+	console  *Console
+	label    string
+	total    int64
+	current  int64
+	spinner  bool
+	frame    int
+	inPlace  bool
+	drawn    bool
+	width    int
+	interval time.Duration
+	lastDraw time.Time
+	start    time.Time
+	done     bool
+	stop     chan struct{}
+}
+
+// NewProgress starts a progress bar going from 0 to total.
+func (c *Console) NewProgress(label string, total int64) *Progress {
+	return c.newProgress(label, total, false)
+}
+
+// NewSpinner starts a spinner, for the tasks whose length is unknown.
+func (c *Console) NewSpinner(label string) *Progress {
+	return c.newProgress(label, 0, true)
+}
+
+func (c *Console) newProgress(label string, total int64, spinner bool) *Progress {
+	c.finishProgress()
+
+	c.mu.Lock()
+	p := &Progress{console: c, label: label, total: total, spinner: spinner, width: c.width,
+		interval: c.progressInterval, start: time.Now(), stop: make(chan struct{})}
+	p.inPlace = !c.nonInteractive && len(c.captures) == 0 && c.termType != "dumb"
+	if p.interval <= 0 {
+		p.interval = defaultProgressInterval
+	}
+	c.progress = p
+	c.mu.Unlock()
+
+	p.update(func() {}, true)
+
+	if spinner {
+		go p.spin()
+	}
+	return p
+}
+
+// finishProgress ends the progress left running by a command, so that the
+// prompt starts on a new line.
+func (c *Console) finishProgress() {
+	c.mu.Lock()
+	p := c.progress
+	c.mu.Unlock()
+
+	if p != nil {
+		p.Done("")
+	}
+}
+
+// clearProgress erases the progress line before something else is printed,
+// it is redrawn by the next update. It is called with the console lock held.
+func (c *Console) clearProgress() {
+	p := c.progress
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.inPlace && p.drawn {
+		c.term.Write([]byte(eraseLine))
+		p.drawn = false
+	}
+}
+
+func (p *Progress) spin() {
+	period := progressRedraw
+	if !p.inPlace {
+		period = p.interval
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	ctx := p.console.Context()
+	for {
+		select {
+		case <-ticker.C:
+			p.update(func() { p.frame++ }, true)
+		case <-p.stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *Progress) Set(current int64) {
+	p.update(func() { p.current = current }, false)
+}
+
+func (p *Progress) Add(n int64) {
+	p.update(func() { p.current += n }, false)
+}
+
+func (p *Progress) SetLabel(label string) {
+	p.update(func() { p.label = label }, false)
+}
+
+// Done ends the progress with msg, or with its last state when msg is empty.
+func (p *Progress) Done(msg string) {
+	p.mu.Lock()
+	if p.done {
+		p.mu.Unlock()
+		return
+	}
+	p.done = true
+	close(p.stop)
+
+	if msg == "" {
+		if p.total > 0 {
+			p.current = p.total
+		}
+		msg = p.render()
+	}
+	c := p.console
+	if p.inPlace {
+		// the terminal turns \n into \r\n
+		c.term.Write([]byte("\r" + msg + "\x1b[K\n"))
+		c.flush()
+	}
+	p.drawn = false
+	p.mu.Unlock()
+
+	if !p.inPlace {
+		c.Print(msg)
+	}
+
+	c.mu.Lock()
+	if c.progress == p {
+		c.progress = nil
+	}
+	c.mu.Unlock()
+}
+
+// update changes the progress with change and shows it if it is time to. The
+// line is redrawn in place, or printed once the lock is released since Print
+// takes the console lock.
+func (p *Progress) update(change func(), force bool) {
+	p.mu.Lock()
+	if p.done {
+		p.mu.Unlock()
+		return
+	}
+	change()
+
+	every := progressRedraw
+	if !p.inPlace {
+		every = p.interval
+	}
+	now := time.Now()
+	if !force && now.Sub(p.lastDraw) < every {
+		p.mu.Unlock()
+		return
+	}
+	p.lastDraw = now
+
+	line := p.render()
+	c := p.console
+	if p.inPlace {
+		c.term.Write([]byte("\r" + line + "\x1b[K"))
+		c.flush()
+		p.drawn = true
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+
+	c.Print(line)
+}
+
+func (p *Progress) render() string {
+	if p.spinner {
+		elapsed := time.Since(p.start).Truncate(time.Second)
+		if p.inPlace {
+			return fmt.Sprintf("%s %s %s", spinnerFrames[p.frame%len(spinnerFrames)], p.label, elapsed)
+		}
+		return fmt.Sprintf("%s... %s", p.label, elapsed)
+	}
+	if p.total <= 0 {
+		return fmt.Sprintf("%s %d", p.label, p.current)
+	}
+
+	current := p.current
+	if current > p.total {
+		current = p.total
+	}
+	percent := int(current * 100 / p.total)
+	counts := fmt.Sprintf(" %3d%% %d/%d", percent, current, p.total)
+	if !p.inPlace {
+		return p.label + counts
+	}
+
+	// the bar takes what is left of the line
+	barWidth := p.width - len(p.label) - len(counts) - 4
+	if barWidth < 10 {
+		barWidth = 10
+	}
+	filled := int(int64(barWidth) * current / p.total)
+	return fmt.Sprintf("%s [%s%s]%s", p.label, strings.Repeat("#", filled), strings.Repeat(".", barWidth-filled), counts)
+}
@@ -0,0 +1,139 @@
+package console_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"github.com/freedreamer82/go-console/pkg/console/consoletest"
+)
+
+func TestProgress(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []console.ConsoleOption
+		term string
+		run  func(c *console.Console)
+		want string
+	}{
+		{name: "bar", run: func(c *console.Console) {
+			p := c.NewProgress("copy", 10)
+			p.Set(5)
+			p.Done("")
+		}, want: "\rcopy [......................]   0% 0/10\x1b[K" + "\rcopy [#####################] 100% 10/10\x1b[K\r\n"},
+		{name: "done message", run: func(c *console.Console) {
+			c.NewProgress("copy", 10).Done("copied")
+		}, want: "\rcopy [......................]   0% 0/10\x1b[K" + "\rcopied\x1b[K\r\n"},
+		{name: "done once", run: func(c *console.Console) {
+			p := c.NewProgress("copy", 10)
+			p.Done("copied")
+			p.Done("again")
+			p.Set(3)
+		}, want: "\rcopy [......................]   0% 0/10\x1b[K" + "\rcopied\x1b[K\r\n"},
+		{name: "updates are rate limited", run: func(c *console.Console) {
+			p := c.NewProgress("copy", 10)
+			p.Set(2)
+			time.Sleep(150 * time.Millisecond)
+			p.Set(5)
+			p.Set(6)
+			p.Done("copied")
+		}, want: "\rcopy [......................]   0% 0/10\x1b[K" + "\rcopy [###########...........]  50% 5/10\x1b[K" +
+			"\rcopied\x1b[K\r\n"},
+		{name: "unknown total", run: func(c *console.Console) {
+			p := c.NewProgress("files", 0)
+			p.Add(3)
+			p.Done("")
+		}, want: "\rfiles 0\x1b[K" + "\rfiles 3\x1b[K\r\n"},
+		{name: "print clears the line", run: func(c *console.Console) {
+			p := c.NewProgress("copy", 10)
+			c.Print("log")
+			p.Done("copied")
+		}, want: "\rcopy [......................]   0% 0/10\x1b[K" + "\r\x1b[Klog\r\n" + "\rcopied\x1b[K\r\n"},
+		{name: "next progress ends the previous", run: func(c *console.Console) {
+			c.NewProgress("a", 0)
+			c.NewProgress("b", 0).Done("")
+		}, want: "\ra 0\x1b[K" + "\ra 0\x1b[K\r\n" + "\rb 0\x1b[K" + "\rb 0\x1b[K\r\n"},
+		{name: "spinner", run: func(c *console.Console) {
+			c.NewSpinner("scan").Done("scanned")
+		}, want: "\r| scan 0s\x1b[K" + "\rscanned\x1b[K\r\n"},
+
+		{name: "lines when non interactive", opts: []console.ConsoleOption{console.WithOptionInteractive(false)},
+			run: func(c *console.Console) {
+				p := c.NewProgress("copy", 10)
+				p.Set(5)
+				p.Done("")
+			}, want: "copy   0% 0/10\r\ncopy 100% 10/10\r\n"},
+		{name: "lines on dumb terminals", term: "dumb", run: func(c *console.Console) {
+			c.NewProgress("copy", 10).Done("copied")
+		}, want: "copy   0% 0/10\r\ncopied\r\n"},
+		{name: "lines every interval", opts: []console.ConsoleOption{console.WithOptionInteractive(false),
+			console.WithOptionProgressInterval(time.Nanosecond)},
+			run: func(c *console.Console) {
+				p := c.NewProgress("copy", 10)
+				time.Sleep(time.Millisecond)
+				p.Set(5)
+				p.Done("copied")
+			}, want: "copy   0% 0/10\r\ncopy  50% 5/10\r\ncopied\r\n"},
+		{name: "spinner lines", opts: []console.ConsoleOption{console.WithOptionInteractive(false)},
+			run: func(c *console.Console) {
+				c.NewSpinner("scan").Done("")
+			}, want: "scan... 0s\r\nscan... 0s\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipe := consoletest.NewPipe()
+			c := console.NewConsole(pipe.IO(), tt.opts...)
+			c.SetSize(40, 10)
+			if tt.term != "" {
+				c.SetTerminalType(tt.term)
+			}
+
+			tt.run(c)
+			if got, _, _ := pipe.Output(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProgressSpins(t *testing.T) {
+	pipe := consoletest.NewPipe()
+	c := console.NewConsole(pipe.IO())
+
+	s := c.NewSpinner("scan")
+	var out string
+	waitFor(t, "spinner frames", func() bool {
+		out, _, _ = pipe.Output()
+		return strings.Contains(out, "\r- scan")
+	})
+	s.Done("scanned")
+	if !strings.Contains(out, "\r/ scan") {
+		t.Errorf("output = %q", out)
+	}
+}
+
+func TestProgressSession(t *testing.T) {
+	s := consoletest.NewSession(t, func(c *console.Console) {
+		c.AddConsoleCommand(console.NewConsoleCommand("flash", func(c *console.Console, command *console.ConsoleCommand, args []string) console.CommandError {
+			p := c.NewProgress("flash", 4)
+			for i := 0; i < 4; i++ {
+				p.Add(1)
+			}
+			// left running, the console ends it
+			return console.N0_ERR
+		}, "flash the firmware"))
+		c.AddConsoleCommand(console.NewConsoleCommand("flashgrep", func(c *console.Console, command *console.ConsoleCommand, args []string) console.CommandError {
+			c.NewProgress("flash", 4).Done("")
+			return console.N0_ERR
+		}, "flash the firmware"))
+	})
+
+	if got := s.Run("flash"); !strings.HasSuffix(got, "100% 4/4\n") || strings.Count(got, "\n") != 1 {
+		t.Errorf("flash = %q", got)
+	}
+	// a captured output gets lines
+	if got := s.Run("flashgrep | grep flash"); got != "flash   0% 0/4\nflash 100% 4/4\n" {
+		t.Errorf("flashgrep = %q", got)
+	}
+}
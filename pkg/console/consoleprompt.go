@@ -0,0 +1,107 @@
+package console
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The placeholders of the prompt templates.
+const (
+	PromptHostname = "{hostname}"
+	PromptUsername = "{username}"
+	PromptLevel    = "{level}"
+	PromptContext  = "{context}"
+	PromptStatus   = "{status}"
+	PromptTime     = "{time}"
+	PromptMark     = "{mark}"
+)
+
+// WithOptionPrompt sets the prompt template, e.g. "{username}@{hostname}{context}{mark} ".
+// {mark} is # for Root and > otherwise, {status} is the exit status of the
+// last command and {time} the time the prompt is printed at (15:04:05).
+func WithOptionPrompt(template string) ConsoleOption {
+	return func(console *Console) {
+		console.promptTemplate = template
+	}
+}
+
+func (c *Console) SetPrompt(template string) {
+	c.mu.Lock()
+	c.promptTemplate = template
+	c.mu.Unlock()
+
+	c.updatePrompt()
+}
+
+func (c *Console) GetPrompt() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.promptTemplate
+}
+
+// SetPromptContext sets what {context} shows, e.g. "(config)" while the
+// commands of a configuration mode are active. Entering or exiting a
+// CommandContext sets it to the prompt suffix of the active context.
+func (c *Console) SetPromptContext(context string) {
+	c.mu.Lock()
+	c.promptContext = context
+	c.mu.Unlock()
+
+	c.updatePrompt()
+}
+
+func (c *Console) setLastStatus(err CommandError) {
+	c.mu.Lock()
+	c.lastStatus = commandExitCode(err)
+	c.mu.Unlock()
+}
+
+// renderPrompt expands the placeholders of the template, it is called with the
+// lock held. A template without {context}, e.g. the default "> ", gets the
+// context in front of it.
+func (c *Console) renderPrompt() string {
+	template := c.promptTemplate
+	if !strings.Contains(template, PromptContext) {
+		template = c.promptContext + template
+	}
+	if !strings.Contains(template, "{") {
+		return template
+	}
+
+	hostname := ""
+	if strings.Contains(template, PromptHostname) {
+		hostname, _ = os.Hostname()
+	}
+	mark := ">"
+	if c.userLevel == Root {
+		mark = "#"
+	}
+	return strings.NewReplacer(
+		PromptHostname, hostname,
+		PromptUsername, c.username,
+		PromptLevel, c.userLevel.String(),
+		PromptContext, c.promptContext,
+		PromptStatus, strconv.Itoa(c.lastStatus),
+		PromptTime, time.Now().Format("15:04:05"),
+		PromptMark, mark,
+	).Replace(template)
+}
+
+// updatePrompt sets the prompt of the terminal from the console state, it is
+// called after every command so that the placeholders are up to date.
+func (c *Console) updatePrompt() {
+	c.mu.Lock()
+	p := ""
+	if c.promptEnabled {
+		p = c.renderPrompt()
+		if text := strings.TrimRight(p, " "); text != "" && c.colorEnabled() && c.theme.Prompt != "" {
+			p = c.theme.Prompt + text + ansiReset + p[len(text):]
+		}
+	}
+	c.mu.Unlock()
+
+	c.term.SetPrompt(p)
+}
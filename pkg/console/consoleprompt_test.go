@@ -0,0 +1,98 @@
+package console_test
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"github.com/freedreamer82/go-console/pkg/console/consoletest"
+)
+
+// expectLinesPrompt sends the lines one after the other and waits for the
+// prompt printed after the last one, want is a regular expression.
+func expectLinesPrompt(s *consoletest.Session, lines []string, want string) {
+	for _, line := range lines {
+		s.Send(line)
+		s.Expect(line + "\n")
+	}
+	s.ExpectRegexp(`(?m)^` + want)
+}
+
+func TestPrompt(t *testing.T) {
+	hostname, _ := os.Hostname()
+	config := console.NewCommandContext("config", "(config)")
+	iface := console.NewCommandContext("interface", "(config-if)")
+	config.AddConsoleCommand(console.NewContextCommand("interface", iface, "configure an interface"))
+
+	tests := []struct {
+		name     string
+		template string
+		setup    func(c *console.Console)
+		lines    []string
+		want     string
+	}{
+		{name: "default", want: `> `},
+		{name: "hostname", template: "{hostname}$ ", want: regexp.QuoteMeta(hostname + "$ ")},
+		{name: "username and level", template: "{username}:{level}{mark} ",
+			setup: func(c *console.Console) { c.Authenticate("alice", console.Guest) }, want: `alice:Guest> `},
+		{name: "root mark", template: "{level}{mark} ", want: `Root# `},
+		{name: "status", template: "[{status}]> ", lines: []string{"nosuch"},
+			want: regexp.QuoteMeta("[" + strconv.Itoa(console.EXIT_NOT_FOUND) + "]> ")},
+		{name: "status reset", template: "[{status}]> ", lines: []string{"nosuch", "echo"}, want: `\[0\]> `},
+		{name: "time", template: "{time} > ", want: `\d\d:\d\d:\d\d > `},
+		{name: "unknown placeholder", template: "{nosuch}> ", want: `\{nosuch\}> `},
+		{name: "context in front", setup: func(c *console.Console) { c.SetPromptContext("(x)") }, want: `\(x\)> `},
+		{name: "context placeholder", template: "dev{context}{mark} ",
+			setup: func(c *console.Console) { c.SetPromptContext("(x)") }, want: `dev\(x\)# `},
+		{name: "enter context", lines: []string{"configure"}, want: `\(config\)> `},
+		{name: "nested context", template: "r1{context}{mark} ", lines: []string{"configure", "interface"},
+			want: `r1\(config-if\)# `},
+		{name: "exit context", template: "r1{context}{mark} ", lines: []string{"configure", "interface", "exit"},
+			want: `r1\(config\)# `},
+		{name: "end", template: "r1{context}{mark} ", lines: []string{"configure", "interface", "end"}, want: `r1# `},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []console.ConsoleOption
+			if tt.template != "" {
+				opts = append(opts, console.WithOptionPrompt(tt.template))
+			}
+			s := consoletest.NewSession(t, func(c *console.Console) {
+				c.AddConsoleCommand(echoCommand)
+				c.AddConsoleCommand(console.NewContextCommand("configure", config, "enter the configuration mode"))
+				if tt.setup != nil {
+					tt.setup(c)
+				}
+			}, opts...)
+
+			expectLinesPrompt(s, tt.lines, tt.want)
+		})
+	}
+}
+
+func TestSetPrompt(t *testing.T) {
+	s := consoletest.NewSession(t, func(c *console.Console) {
+		c.AddConsoleCommand(echoCommand)
+	})
+	s.Prompt = regexp.MustCompile(`(?m)^(> |new\$ )`)
+
+	if got := s.Console.GetPrompt(); got != "> " {
+		t.Errorf("GetPrompt = %q", got)
+	}
+	s.Run("echo")
+	s.Console.SetPrompt("new$ ")
+	if got := s.Console.GetPrompt(); got != "new$ " {
+		t.Errorf("GetPrompt = %q", got)
+	}
+	s.Run("echo")
+	s.Expect("new$ ")
+}
+
+func TestTelnetPrompt(t *testing.T) {
+	_, addr := startTelnet(t, nil, console.WithOptionTelnetPrompt("telnet{mark} "))
+
+	cl := dialTelnet(t, addr)
+	cl.expect("telnet# ")
+}
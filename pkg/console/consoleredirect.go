@@ -0,0 +1,402 @@
+package console
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const REDIRECT_NOT_ALLOWED CommandError = "Redirection Not Allowed!"
+const BUFFER_NOT_FOUND CommandError = "Buffer Not Found!"
+
+const maxDiffLines = 2000
+const diffContext = 3
+
+var bufferName = regexp.MustCompile(`^@[A-Za-z0-9_.-]+$`)
+
+// redirect is the "> target" or ">> target" at the end of a command line, the
+// target is a file or a named buffer (@name).
+type redirect struct {
+	command string
+	target  string
+	append  bool
+}
+
+func (r *redirect) isBuffer() bool {
+	return strings.HasPrefix(r.target, "@")
+}
+
+// WithOptionRedirectDirs allows the users of level or above to redirect the
+// output of the commands to files inside dirs, relative paths are relative to
+// the first dir. Without it only the named buffers can be used.
+func WithOptionRedirectDirs(level User, dirs ...string) ConsoleOption {
+	return func(console *Console) {
+		console.SetRedirectDirs(level, dirs...)
+	}
+}
+
+// SetRedirectDirs sets the redirect dirs as WithOptionRedirectDirs, e.g. from
+// the OnNewConsole callback of a transport.
+func (c *Console) SetRedirectDirs(level User, dirs ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.redirectLevel = level
+	c.redirectDirs = dirs
+}
+
+func (c *Console) getRedirectDirs() (User, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.redirectLevel, c.redirectDirs
+}
+
+// parseRedirect looks for an unquoted > in the last stage of a pipeline, it
+// returns nil when there is none and false when the target is missing.
+func parseRedirect(stage string) (*redirect, bool) {
+	var quote rune
+	for i, r := range stage {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == '>':
+			redir := &redirect{command: stage[:i]}
+			rest := stage[i+1:]
+			if strings.HasPrefix(rest, ">") {
+				redir.append = true
+				rest = rest[1:]
+			}
+			args := splitArgs(rest)
+			if len(args) != 1 {
+				return nil, false
+			}
+			redir.target = args[0]
+			return redir, true
+		}
+	}
+	return nil, true
+}
+
+// resolveRedirectPath returns the absolute path of target if it is inside one
+// of the redirect dirs.
+func (c *Console) resolveRedirectPath(target string) (string, error) {
+	_, dirs := c.getRedirectDirs()
+	if len(dirs) == 0 {
+		return "", errors.New("no redirect dir")
+	}
+
+	path := target
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dirs[0], path)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	// the symlinks are resolved so that they cannot point outside
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		return "", fmt.Errorf("%s is a symlink", target)
+	}
+
+	for _, allowed := range dirs {
+		allowed, err := filepath.EvalSymlinks(allowed)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(allowed, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.Join(dir, filepath.Base(path)), nil
+		}
+	}
+	return "", fmt.Errorf("%s is outside the redirect dirs", target)
+}
+
+// checkRedirect validates the target before the command is run.
+func (c *Console) checkRedirect(redir *redirect) CommandError {
+	if redir.isBuffer() {
+		if !bufferName.MatchString(redir.target) {
+			return BAD_FORMAT
+		}
+		return N0_ERR
+	}
+
+	if level, dirs := c.getRedirectDirs(); len(dirs) == 0 || c.GetUserLevel() < level {
+		return REDIRECT_NOT_ALLOWED
+	}
+	if _, err := c.resolveRedirectPath(redir.target); err != nil {
+		log.Warnf("Console %s redirection refused: %s", c.uuid, err)
+		return REDIRECT_NOT_ALLOWED
+	}
+	return N0_ERR
+}
+
+func (c *Console) writeRedirect(redir *redirect, lines []string) CommandError {
+
+	text := ""
+	if len(lines) > 0 {
+		text = strings.Join(lines, "\n") + "\n"
+	}
+
+	if redir.isBuffer() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if c.buffers == nil {
+			c.buffers = make(map[string]string)
+		}
+		name := redir.target[1:]
+		if redir.append {
+			c.buffers[name] += text
+		} else {
+			c.buffers[name] = text
+		}
+		return N0_ERR
+	}
+
+	path, err := c.resolveRedirectPath(redir.target)
+	if err != nil {
+		return REDIRECT_NOT_ALLOWED
+	}
+	// a symlink put at path after the check is not followed, the file is
+	// truncated once it is known to be the one at path
+	flags := os.O_WRONLY | os.O_CREATE | openNoFollow
+	if redir.append {
+		flags |= os.O_APPEND
+	}
+	f, err := os.OpenFile(path, flags, 0640)
+	if err != nil {
+		if fi, lerr := os.Lstat(path); lerr == nil && fi.Mode()&os.ModeSymlink != 0 {
+			log.Warnf("Console %s redirection refused: %s is a symlink", c.uuid, redir.target)
+			return REDIRECT_NOT_ALLOWED
+		}
+		return CommandError(err.Error())
+	}
+	if err := checkOpenedFile(f, path); err != nil {
+		f.Close()
+		log.Warnf("Console %s redirection refused: %s", c.uuid, err)
+		return REDIRECT_NOT_ALLOWED
+	}
+	if !redir.append {
+		if err := f.Truncate(0); err != nil {
+			f.Close()
+			return CommandError(err.Error())
+		}
+	}
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return CommandError(err.Error())
+	}
+	if err := f.Close(); err != nil {
+		return CommandError(err.Error())
+	}
+	return N0_ERR
+}
+
+// checkOpenedFile verifies that f is the regular file at path, where
+// O_NOFOLLOW is missing.
+func checkOpenedFile(f *os.File, path string) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	lfi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() || !os.SameFile(fi, lfi) {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	return nil
+}
+
+// GetBuffer returns the content of the named buffer, without the @.
+func (c *Console) GetBuffer(name string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	text, ok := c.buffers[strings.TrimPrefix(name, "@")]
+	return text, ok
+}
+
+func (c *Console) bufferLines(name string) ([]string, bool) {
+	text, ok := c.GetBuffer(name)
+	if !ok {
+		return nil, false
+	}
+	lines := strings.Split(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines, true
+}
+
+func (c *Console) cmdBuffers(console *Console, command *ConsoleCommand, args []string) CommandError {
+
+	switch {
+	case len(args) == 0:
+		c.mu.Lock()
+		names := make([]string, 0, len(c.buffers))
+		for name := range c.buffers {
+			names = append(names, name)
+		}
+		sizes := make(map[string]int, len(c.buffers))
+		for name, text := range c.buffers {
+			sizes[name] = strings.Count(text, "\n")
+		}
+		c.mu.Unlock()
+
+		sort.Strings(names)
+		for _, name := range names {
+			c.Print(fmt.Sprintf("@%s %d lines", name, sizes[name]))
+		}
+	case len(args) == 2 && args[0] == "show":
+		lines, ok := c.bufferLines(args[1])
+		if !ok {
+			return BUFFER_NOT_FOUND
+		}
+		for _, l := range lines {
+			c.Print(l)
+		}
+	case len(args) >= 1 && args[0] == "clear":
+		c.mu.Lock()
+		if len(args) == 1 {
+			c.buffers = nil
+		} else {
+			for _, name := range args[1:] {
+				delete(c.buffers, strings.TrimPrefix(name, "@"))
+			}
+		}
+		c.mu.Unlock()
+	default:
+		return BAD_FORMAT
+	}
+	return N0_ERR
+}
+
+func (c *Console) cmdDiff(console *Console, command *ConsoleCommand, args []string) CommandError {
+
+	if len(args) != 2 {
+		return BAD_FORMAT
+	}
+	a, ok := c.bufferLines(args[0])
+	if !ok {
+		return BUFFER_NOT_FOUND
+	}
+	b, ok := c.bufferLines(args[1])
+	if !ok {
+		return BUFFER_NOT_FOUND
+	}
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		return CommandError(fmt.Sprintf("diff: more than %d lines", maxDiffLines))
+	}
+
+	hunks := unifiedDiff(a, b)
+	if len(hunks) == 0 {
+		return N0_ERR
+	}
+	c.Print("--- " + args[0])
+	c.Print("+++ " + args[1])
+	for _, l := range hunks {
+		c.Print(l)
+	}
+	return N0_ERR
+}
+
+// unifiedDiff compares the lines with their longest common subsequence and
+// returns the hunks in unified format.
+func unifiedDiff(a, b []string) []string {
+
+	// lcs[i][j] is the length of the lcs of a[i:] and b[j:]
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	type edit struct {
+		op   byte
+		line string
+		ai   int
+		bi   int
+	}
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i], i, j})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			edits = append(edits, edit{'+', b[j], i, j})
+			j++
+		default:
+			edits = append(edits, edit{'-', a[i], i, j})
+			i++
+		}
+	}
+
+	var out []string
+	for k := 0; k < len(edits); {
+		if edits[k].op == ' ' {
+			k++
+			continue
+		}
+		// a hunk starts diffContext lines before the change and goes on while
+		// the changes are closer than 2*diffContext
+		start := k - diffContext
+		if start < 0 {
+			start = 0
+		}
+		last := k
+		for end := k; end < len(edits) && end-last <= 2*diffContext; end++ {
+			if edits[end].op != ' ' {
+				last = end
+			}
+		}
+		end := last + diffContext + 1
+		if end > len(edits) {
+			end = len(edits)
+		}
+
+		aLen, bLen := 0, 0
+		var body []string
+		for _, e := range edits[start:end] {
+			if e.op != '+' {
+				aLen++
+			}
+			if e.op != '-' {
+				bLen++
+			}
+			body = append(body, string(e.op)+e.line)
+		}
+		out = append(out, fmt.Sprintf("@@ -%d,%d +%d,%d @@", edits[start].ai+1, aLen, edits[start].bi+1, bLen))
+		out = append(out, body...)
+		k = end
+	}
+	return out
+}
@@ -0,0 +1,5 @@
+//go:build !unix
+
+package console
+
+const openNoFollow = 0
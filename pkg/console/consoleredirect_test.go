@@ -0,0 +1,180 @@
+package console_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"github.com/freedreamer82/go-console/pkg/console/consoletest"
+)
+
+func TestRedirectBuffers(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		check string
+		want  string
+	}{
+		{"write", []string{"fruits > @f"}, "buffers show @f", "apple\nbanana\n"},
+		{"filtered", []string{"fruits | grep an > @f"}, "buffers show f", "banana\n"},
+		{"overwrite", []string{"fruits > @f", "echo x > @f"}, "buffers show @f", "x\n"},
+		{"append", []string{"echo x > @f", "echo y >> @f"}, "buffers show @f", "x\ny\n"},
+		{"quoted >", []string{"echo 'a>b' > @f"}, "buffers show @f", "'a>b'\n"},
+		{"list", []string{"fruits > @b", "echo x > @a"}, "buffers", "@a 1 lines\n@b 2 lines\n"},
+		{"clear one", []string{"echo x > @a", "echo y > @b", "buffers clear @a"}, "buffers", "@b 1 lines\n"},
+		{"clear all", []string{"echo x > @a", "echo y > @b", "buffers clear"}, "buffers", ""},
+		{"unknown buffer", nil, "buffers show @nosuch", string(console.BUFFER_NOT_FOUND) + "\n"},
+		{"bad buffer name", nil, "echo x > @a/b", string(console.BAD_FORMAT) + "\n"},
+		{"missing target", nil, "echo x >", string(console.BAD_FORMAT) + "\n"},
+		{"two targets", nil, "echo x > @a @b", string(console.BAD_FORMAT) + "\n"},
+		{"command error is kept", nil, "nosuch > @a", string(console.CMD_NOT_FOUND) + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := consoletest.NewSession(t, func(c *console.Console) {
+				c.AddConsoleCommand(echoCommand)
+				c.AddConsoleCommand(newCommand("fruits", "apple", "banana"))
+			})
+			for _, line := range tt.lines {
+				if out := s.Run(line); out != "" {
+					t.Fatalf("%s: %q", line, out)
+				}
+			}
+			if got := s.Run(tt.check); got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.check, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetBuffer(t *testing.T) {
+	s := consoletest.NewSession(t, func(c *console.Console) {
+		c.AddConsoleCommand(echoCommand)
+	})
+	s.Run("echo one > @out")
+
+	for _, name := range []string{"out", "@out"} {
+		if text, ok := s.Console.GetBuffer(name); !ok || text != "one\n" {
+			t.Errorf("GetBuffer(%q) = %q, %v", name, text, ok)
+		}
+	}
+	if _, ok := s.Console.GetBuffer("nosuch"); ok {
+		t.Error("GetBuffer(nosuch) found")
+	}
+}
+
+func TestRedirectFiles(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(filepath.Join(outside, "target"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "linkdir")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     []console.ConsoleOption
+		level    console.User
+		lines    []string
+		wantOut  string
+		file     string
+		wantFile string
+	}{
+		{name: "no redirect dirs", level: console.Root, lines: []string{"echo x > out.txt"},
+			wantOut: string(console.REDIRECT_NOT_ALLOWED) + "\n"},
+		{name: "relative path", opts: []console.ConsoleOption{console.WithOptionRedirectDirs(console.Root, dir)},
+			level: console.Root, lines: []string{"echo x > out.txt"}, file: "out.txt", wantFile: "x\n"},
+		{name: "absolute path", opts: []console.ConsoleOption{console.WithOptionRedirectDirs(console.Root, dir)},
+			level: console.Root, lines: []string{"echo x > " + filepath.Join(dir, "abs.txt")}, file: "abs.txt", wantFile: "x\n"},
+		{name: "append", opts: []console.ConsoleOption{console.WithOptionRedirectDirs(console.Root, dir)},
+			level: console.Root, lines: []string{"echo x > app.txt", "echo y >> app.txt"}, file: "app.txt", wantFile: "x\ny\n"},
+		{name: "outside", opts: []console.ConsoleOption{console.WithOptionRedirectDirs(console.Root, dir)},
+			level: console.Root, lines: []string{"echo x > ../out.txt"}, wantOut: string(console.REDIRECT_NOT_ALLOWED) + "\n"},
+		{name: "symlink", opts: []console.ConsoleOption{console.WithOptionRedirectDirs(console.Root, dir)},
+			level: console.Root, lines: []string{"echo x > link"}, wantOut: string(console.REDIRECT_NOT_ALLOWED) + "\n"},
+		{name: "symlinked dir", opts: []console.ConsoleOption{console.WithOptionRedirectDirs(console.Root, dir)},
+			level: console.Root, lines: []string{"echo x > linkdir/out.txt"}, wantOut: string(console.REDIRECT_NOT_ALLOWED) + "\n"},
+		{name: "symlink created by the command", opts: []console.ConsoleOption{console.WithOptionRedirectDirs(console.Root, dir)},
+			level: console.Root, lines: []string{"swap > swapped"}, wantOut: string(console.REDIRECT_NOT_ALLOWED) + "\n"},
+		{name: "level too low", opts: []console.ConsoleOption{console.WithOptionRedirectDirs(console.Root, dir)},
+			level: console.Guest, lines: []string{"echo x > guest.txt"}, wantOut: string(console.REDIRECT_NOT_ALLOWED) + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := consoletest.NewSession(t, func(c *console.Console) {
+				echo := console.NewConsoleCommand("echo", echo, "print the arguments")
+				echo.SetUserLevel(console.Guest)
+				c.AddConsoleCommand(echo)
+				// swap replaces its redirect target, checked already, with a
+				// symlink
+				c.AddConsoleCommand(console.NewConsoleCommand("swap", func(c *console.Console, command *console.ConsoleCommand, args []string) console.CommandError {
+					if err := os.Symlink(filepath.Join(outside, "target"), filepath.Join(dir, "swapped")); err != nil {
+						return console.CommandError(err.Error())
+					}
+					c.Print("swapping")
+					return console.N0_ERR
+				}, "swap"))
+				c.SetUserLevel(tt.level)
+			}, tt.opts...)
+
+			var out string
+			for _, line := range tt.lines {
+				out += s.Run(line)
+			}
+			if out != tt.wantOut {
+				t.Errorf("output = %q, want %q", out, tt.wantOut)
+			}
+			if tt.file != "" {
+				data, err := os.ReadFile(filepath.Join(dir, tt.file))
+				if err != nil || string(data) != tt.wantFile {
+					t.Errorf("%s = %q, %v, want %q", tt.file, data, err, tt.wantFile)
+				}
+				if fi, err := os.Stat(filepath.Join(dir, tt.file)); err == nil && fi.Mode().Perm() != 0640 {
+					t.Errorf("%s mode = %v, want 0640", tt.file, fi.Mode().Perm())
+				}
+			}
+			if _, err := os.Stat(filepath.Join(outside, "target")); err == nil {
+				t.Error("file written outside the redirect dirs")
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a    []string
+		b    []string
+	}{
+		{"same", []string{"one", "two"}, []string{"one", "two"}},
+		{"changed-line", []string{"1", "2", "3", "4", "5", "6", "7", "8", "9"},
+			[]string{"1", "2", "3", "4", "five", "6", "7", "8", "9"}},
+		{"added-removed", []string{"a", "b", "c"}, []string{"b", "c", "d"}},
+		{"two-hunks", []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"},
+			[]string{"one", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "twelve"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := consoletest.NewSession(t, func(c *console.Console) {
+				c.AddConsoleCommand(newCommand("a", tt.a...))
+				c.AddConsoleCommand(newCommand("b", tt.b...))
+			})
+			s.Run("a > @a")
+			s.Run("b > @b")
+			s.Run("diff @a @b")
+			s.ExpectPrompt()
+			s.AssertGolden(filepath.Join("testdata", "diff", tt.name+".golden"))
+		})
+	}
+
+	s := consoletest.NewSession(t, nil)
+	if got := s.Run("diff @a @b"); got != string(console.BUFFER_NOT_FOUND)+"\n" {
+		t.Errorf("diff of missing buffers = %q", got)
+	}
+	if got := s.Run("diff @a"); got != string(console.BAD_FORMAT)+"\n" {
+		t.Errorf("diff with one buffer = %q", got)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build unix
+
+package console
+
+import "syscall"
+
+// openNoFollow makes the open of a redirect fail on a symlink.
+const openNoFollow = syscall.O_NOFOLLOW
@@ -0,0 +1,136 @@
+package console
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const maxScriptDepth = 8
+
+var errLoginRequired = errors.New("login required")
+
+// ScriptError reports the first command of a script that failed.
+type ScriptError struct {
+	Script  string
+	Line    int
+	Command string
+	Err     CommandError
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("%s:%d: %s: %s", e.Script, e.Line, e.Command, e.Err)
+}
+
+// RunScript runs the commands read from r one line at a time. Blank lines and
+// lines starting with # are skipped, "set -e" stops the script at the first
+// failing command and "set +e" goes back to continue on errors. The errors are
+// printed with their line number and the first one is returned as a
+// *ScriptError.
+func (c *Console) RunScript(r io.Reader) error {
+
+	if c.IsLoginEnabled() && !c.IsUserLogged() {
+		return errLoginRequired
+	}
+	if !c.beginCommand() {
+		return errors.New(string(CMD_REFUSED))
+	}
+	defer c.endCommand()
+
+	return c.runScript(r, "script", 0)
+}
+
+func (c *Console) runScript(r io.Reader, name string, depth int) error {
+
+	if depth >= maxScriptDepth {
+		return fmt.Errorf("%s: too many nested scripts", name)
+	}
+
+	var firstErr *ScriptError
+	stopOnError := false
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		// the command context, also cancelled when the source is aborted
+		if err := c.Context().Err(); err != nil {
+			return err
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case line == "set -e":
+			stopOnError = true
+			continue
+		case line == "set +e":
+			stopOnError = false
+			continue
+		}
+
+		var cmdErr CommandError
+		subs := strings.Split(line, " ")
+		if subs[0] == "source" && len(subs) == 2 && c.canRun("source") {
+			// nested scripts keep track of the depth
+			cmdErr = c.sourceFile(subs[1], depth+1)
+		} else {
+			cmdErr = c.execLine(line)
+		}
+		if cmdErr == N0_ERR {
+			continue
+		}
+
+		c.Print(fmt.Sprintf("%s:%d: %s", name, n, cmdErr))
+		if firstErr == nil {
+			firstErr = &ScriptError{Script: name, Line: n, Command: line, Err: cmdErr}
+		}
+		if stopOnError {
+			return firstErr
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	return nil
+}
+
+// canRun tells if the user can run the command.
+func (c *Console) canRun(command string) bool {
+	for _, cmd := range c.activeCommands() {
+		if cmd.GetCommand() == command && c.GetUserLevel() >= cmd.GetUserLevel() {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Console) sourceFile(path string, depth int) CommandError {
+	f, err := os.Open(path)
+	if err != nil {
+		return CommandError(err.Error())
+	}
+	defer f.Close()
+
+	err = c.runScript(f, path, depth)
+	var scriptErr *ScriptError
+	switch {
+	case err == nil:
+		return N0_ERR
+	case errors.As(err, &scriptErr):
+		// the failing line has already been printed
+		return SCRIPT_FAILED
+	}
+	return CommandError(err.Error())
+}
+
+func (c *Console) cmdSource(console *Console, command *ConsoleCommand, args []string) CommandError {
+	if len(args) != 1 {
+		return BAD_FORMAT
+	}
+	return c.sourceFile(args[0], 0)
+}
@@ -0,0 +1,261 @@
+package console_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"github.com/freedreamer82/go-console/pkg/console/consoletest"
+)
+
+// failCommand fails with its arguments as error.
+var failCommand = console.NewConsoleCommand("fail", func(c *console.Console, command *console.ConsoleCommand, args []string) console.CommandError {
+	return console.CommandError(strings.Join(args, " "))
+}, "fail with a message")
+
+func newScriptSession(t *testing.T) *consoletest.Session {
+	return consoletest.NewSession(t, func(c *console.Console) {
+		c.AddConsoleCommand(echoCommand)
+		c.AddConsoleCommand(failCommand)
+	})
+}
+
+func TestRunScript(t *testing.T) {
+	tests := []struct {
+		name       string
+		script     string
+		wantOutput string
+		wantErr    *console.ScriptError
+	}{
+		{"commands", "echo one\necho two\n", "one\ntwo\n", nil},
+		{"comments and blank lines", "# header\n\n  echo one  \n\t\n#echo no\n", "one\n", nil},
+		{"errors continue", "fail boom\necho after\n", "script:1: boom\nafter\n",
+			&console.ScriptError{Script: "script", Line: 1, Command: "fail boom", Err: "boom"}},
+		{"first error is returned", "echo one\nfail first\nfail second\n",
+			"one\nscript:2: first\nscript:3: second\n",
+			&console.ScriptError{Script: "script", Line: 2, Command: "fail first", Err: "first"}},
+		{"set -e stops", "set -e\nfail boom\necho after\n", "script:2: boom\n",
+			&console.ScriptError{Script: "script", Line: 2, Command: "fail boom", Err: "boom"}},
+		{"set +e continues", "set -e\nset +e\nfail boom\necho after\n", "script:3: boom\nafter\n",
+			&console.ScriptError{Script: "script", Line: 3, Command: "fail boom", Err: "boom"}},
+		{"unknown command", "nosuch\n", "script:1: " + string(console.CMD_NOT_FOUND) + "\n",
+			&console.ScriptError{Script: "script", Line: 1, Command: "nosuch", Err: console.CMD_NOT_FOUND}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the console is not started, the output has no prompt
+			pipe := consoletest.NewPipe()
+			c := console.NewConsole(pipe.IO())
+			c.AddConsoleCommand(echoCommand)
+			c.AddConsoleCommand(failCommand)
+
+			err := c.RunScript(strings.NewReader(tt.script))
+			var scriptErr *console.ScriptError
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Errorf("RunScript = %v", err)
+			case tt.wantErr != nil && !errors.As(err, &scriptErr):
+				t.Errorf("RunScript = %v, want %v", err, tt.wantErr)
+			case tt.wantErr != nil && *scriptErr != *tt.wantErr:
+				t.Errorf("RunScript = %+v, want %+v", scriptErr, tt.wantErr)
+			}
+			if got, _, _ := pipe.Output(); consoletest.Normalize(got) != tt.wantOutput {
+				t.Errorf("output = %q, want %q", got, tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestRunScriptLoginRequired(t *testing.T) {
+	s := consoletest.NewSession(t, func(c *console.Console) {
+		c.AddConsoleCommand(echoCommand)
+		c.EnableLogin("secret")
+	})
+	s.Expect("Password?")
+	if err := s.Console.RunScript(strings.NewReader("echo one\n")); err == nil {
+		t.Error("script run before the login")
+	}
+}
+
+func TestSource(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	inner := write("inner.txt", "echo inner\n")
+	write("outer.txt", "echo outer\nsource "+inner+"\n")
+	write("failing.txt", "echo before\nfail boom\n")
+	write("loop.txt", "source "+filepath.Join(dir, "loop.txt")+"\n")
+
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"script", "source " + inner, "inner\n"},
+		{"nested", "source " + filepath.Join(dir, "outer.txt"), "outer\ninner\n"},
+		{"failing line", "source " + filepath.Join(dir, "failing.txt"),
+			"before\n" + filepath.Join(dir, "failing.txt") + ":2: boom\n" + string(console.SCRIPT_FAILED) + "\n"},
+		{"missing file", "source " + filepath.Join(dir, "nosuch.txt"),
+			"open " + filepath.Join(dir, "nosuch.txt") + ": no such file or directory\n"},
+		{"no argument", "source", string(console.BAD_FORMAT) + "\n"},
+	}
+	s := newScriptSession(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.Run(tt.line); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("recursion", func(t *testing.T) {
+		if got := s.Run("source " + filepath.Join(dir, "loop.txt")); !strings.Contains(got, "too many nested scripts") {
+			t.Errorf("output = %q", got)
+		}
+	})
+}
+
+func TestSourceAbort(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.txt")
+	if err := os.WriteFile(path, []byte("stream\nmark\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stream, done := newStreamCommand()
+	marked := make(chan struct{}, 1)
+	s := consoletest.NewSession(t, func(c *console.Console) {
+		c.AddConsoleCommand(stream)
+		c.AddConsoleCommand(console.NewConsoleCommand("mark", func(c *console.Console, command *console.ConsoleCommand, args []string) console.CommandError {
+			marked <- struct{}{}
+			return console.N0_ERR
+		}, "mark"))
+		c.SetSize(80, 4)
+	}, console.WithOptionPager(true))
+
+	// q at the pager cancels the source command, not only the stream line
+	s.ExpectPrompt()
+	s.Send("source " + path)
+	s.Expect("--More--")
+	s.SendRaw("q")
+	<-done
+	s.ExpectPrompt()
+	select {
+	case <-marked:
+		t.Error("the script went on after the abort")
+	default:
+	}
+}
+
+func TestSourceUserLevel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.txt")
+	if err := os.WriteFile(path, []byte("echo one\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		level console.User
+		want  string
+	}{
+		{console.Root, "one\n"},
+		{console.Guest, string(console.CMD_NOT_FOUND) + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			s := consoletest.NewSession(t, func(c *console.Console) {
+				echo := console.NewConsoleCommand("echo", echo, "print the arguments")
+				echo.SetUserLevel(console.Guest)
+				c.AddConsoleCommand(echo)
+				c.SetUserLevel(tt.level)
+			})
+			if got := s.Run("source " + path); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// stdio replaces stdin and stdout with pipes for the time of the test, the
+// console reads input and its output is returned by the function.
+func stdio(t *testing.T, input string) func() string {
+	t.Helper()
+
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin, stdout := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = inR, outW
+	t.Cleanup(func() {
+		os.Stdin, os.Stdout = stdin, stdout
+		inR.Close()
+		outR.Close()
+	})
+
+	go func() {
+		inW.WriteString(input)
+		inW.Close()
+	}()
+	output := make(chan string, 1)
+	go func() {
+		data, _ := io.ReadAll(outR)
+		output <- string(data)
+	}()
+	return func() string {
+		outW.Close()
+		return <-output
+	}
+}
+
+func TestStdOutputScript(t *testing.T) {
+	tests := []struct {
+		name       string
+		login      bool
+		input      string
+		wantErr    string
+		wantOutput string
+	}{
+		{"script", false, "echo one\necho two\n", "", "one\ntwo\n"},
+		{"failing command", false, "fail boom\necho after\n", "script:1: fail boom: boom", "script:1: boom\nafter\n"},
+		{"login", true, "secret\necho one\n", "", "one\n"},
+		{"login failed", true, "wrong\necho one\n", "login failed", "Login failed\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := stdio(t, tt.input)
+
+			c := console.NewStdOutputConsole()
+			c.AddConsoleCommand(echoCommand)
+			c.AddConsoleCommand(failCommand)
+			if tt.login {
+				c.EnableLogin("secret")
+			}
+			c.Start()
+
+			var err error
+			select {
+			case err = <-c.ScriptResult():
+			case <-time.After(testTimeout):
+				t.Fatal("no script result")
+			}
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("ScriptResult = %v, want %q", err, tt.wantErr)
+			}
+			if got := output(); !strings.HasSuffix(got, tt.wantOutput) || strings.Contains(got, "\r") {
+				t.Errorf("output = %q, want suffix %q", got, tt.wantOutput)
+			}
+		})
+	}
+}
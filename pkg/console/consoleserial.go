@@ -0,0 +1,233 @@
+package console
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"sync"
+	"time"
+)
+
+const defaultSerialBaud = 115200
+const defaultSerialReopenDelay = 2 * time.Second
+
+type Parity int
+
+const (
+	ParityNone Parity = iota
+	ParityOdd
+	ParityEven
+)
+
+type serialConfig struct {
+	baud     int
+	dataBits int
+	parity   Parity
+	stopBits int
+}
+
+// SerialConsole runs a console on a tty device (a serial port or the slave
+// side of a pseudo-terminal), the device is reopened when it disappears.
+type SerialConsole struct {
+	mu                   *sync.Mutex
+	device               string
+	cfg                  serialConfig
+	reopenDelay          time.Duration
+	console              *Console
+	callbackOnNewConsole OnNewConsole
+	timeout              time.Duration
+	shutdownNotice       string
+	prompt               string
+	closing              bool
+	quit                 chan struct{}
+}
+
+type SerialConsoleOption func(console *SerialConsole)
+
+func WithOptionSerialBaud(baud int) SerialConsoleOption {
+	return func(console *SerialConsole) {
+		console.cfg.baud = baud
+	}
+}
+
+func WithOptionSerialDataBits(dataBits int) SerialConsoleOption {
+	return func(console *SerialConsole) {
+		console.cfg.dataBits = dataBits
+	}
+}
+
+func WithOptionSerialParity(parity Parity) SerialConsoleOption {
+	return func(console *SerialConsole) {
+		console.cfg.parity = parity
+	}
+}
+
+func WithOptionSerialStopBits(stopBits int) SerialConsoleOption {
+	return func(console *SerialConsole) {
+		console.cfg.stopBits = stopBits
+	}
+}
+
+// WithOptionSerialReopenDelay sets the delay between the attempts to reopen
+// the device once it has been lost.
+func WithOptionSerialReopenDelay(delay time.Duration) SerialConsoleOption {
+	return func(console *SerialConsole) {
+		console.reopenDelay = delay
+	}
+}
+
+func WithOptionSerialTimeout(timeout time.Duration) SerialConsoleOption {
+	return func(console *SerialConsole) {
+		console.timeout = timeout
+	}
+}
+
+func WithOptionSerialShutdownNotice(notice string) SerialConsoleOption {
+	return func(console *SerialConsole) {
+		console.shutdownNotice = notice
+	}
+}
+
+// WithOptionSerialPrompt sets the prompt template of the consoles, see WithOptionPrompt.
+func WithOptionSerialPrompt(template string) SerialConsoleOption {
+	return func(console *SerialConsole) {
+		console.prompt = template
+	}
+}
+
+// NewSerialConsole creates a console on device, 115200 8N1 by default, it is
+// opened only when Start is called.
+func NewSerialConsole(device string, opts ...SerialConsoleOption) *SerialConsole {
+	c := &SerialConsole{
+		mu:             &sync.Mutex{},
+		device:         device,
+		cfg:            serialConfig{baud: defaultSerialBaud, dataBits: 8, parity: ParityNone, stopBits: 1},
+		reopenDelay:    defaultSerialReopenDelay,
+		shutdownNotice: defaultShutdownNotice,
+		quit:           make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func (c *SerialConsole) AddCallbackOnNewConsole(cb OnNewConsole) {
+	c.callbackOnNewConsole = cb
+}
+
+func (c *SerialConsole) RemoveCallbackOnNewConsole() {
+	c.callbackOnNewConsole = nil
+}
+
+// Start opens the device and runs the console on it, it blocks until the
+// console is shut down. The first open error is returned, afterwards the
+// device is reopened every reopen delay until it comes back.
+func (c *SerialConsole) Start() error {
+
+	if c.cfg.stopBits != 1 && c.cfg.stopBits != 2 {
+		return fmt.Errorf("unsupported stop bits %d", c.cfg.stopBits)
+	}
+
+	dev, err := openSerial(c.device, c.cfg)
+	if err != nil {
+		return err
+	}
+
+	for {
+		if !c.run(dev) {
+			return nil
+		}
+
+		// the session ended or the device was lost (e.g. USB-serial unplugged),
+		// the delay also keeps a device failing right after the open from
+		// spinning the loop
+		for {
+			select {
+			case <-c.quit:
+				return nil
+			case <-time.After(c.reopenDelay):
+			}
+			dev, err = openSerial(c.device, c.cfg)
+			if err == nil {
+				break
+			}
+			log.Debugf("Serial device %s reopen failed: %s", c.device, err)
+		}
+	}
+}
+
+// run serves a console session on the device, it returns false when the
+// serial console is closing.
+func (c *SerialConsole) run(dev io.ReadWriteCloser) bool {
+
+	consoleIO := struct {
+		io.ReadCloser
+		io.Writer
+		Flusher
+	}{dev, dev, nil}
+
+	console := NewConsole(consoleIO)
+	if c.prompt != "" {
+		console.SetPrompt(c.prompt)
+	}
+
+	c.mu.Lock()
+	if c.closing {
+		c.mu.Unlock()
+		dev.Close()
+		return false
+	}
+	c.console = console
+	c.mu.Unlock()
+
+	if c.callbackOnNewConsole != nil {
+		c.callbackOnNewConsole(console)
+	}
+
+	console.SetTimeout(c.timeout)
+	console.Start()
+	<-console.Done()
+	console.Stop()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.console = nil
+	return !c.closing
+}
+
+// stopAccepting prevents the device to be reopened and returns the console
+// still alive, if any.
+func (c *SerialConsole) stopAccepting() []*Console {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closing {
+		return nil
+	}
+	c.closing = true
+	close(c.quit)
+
+	if c.console == nil {
+		return nil
+	}
+	return []*Console{c.console}
+}
+
+// Stop closes the device immediately.
+func (c *SerialConsole) Stop() error {
+	for _, console := range c.stopAccepting() {
+		console.Stop()
+	}
+	return nil
+}
+
+// Shutdown sends the shutdown notice, waits for the running command until ctx
+// expires and closes the device.
+func (c *SerialConsole) Shutdown(ctx context.Context) error {
+	return shutdownConsoles(ctx, c.stopAccepting(), c.shutdownNotice)
+}
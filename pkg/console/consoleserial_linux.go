@@ -0,0 +1,99 @@
+package console
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+	"os"
+)
+
+var serialBaudRates = map[int]uint32{
+	1200:    unix.B1200,
+	2400:    unix.B2400,
+	4800:    unix.B4800,
+	9600:    unix.B9600,
+	19200:   unix.B19200,
+	38400:   unix.B38400,
+	57600:   unix.B57600,
+	115200:  unix.B115200,
+	230400:  unix.B230400,
+	460800:  unix.B460800,
+	921600:  unix.B921600,
+	1000000: unix.B1000000,
+	2000000: unix.B2000000,
+	4000000: unix.B4000000,
+}
+
+var serialDataBits = map[int]uint32{
+	5: unix.CS5,
+	6: unix.CS6,
+	7: unix.CS7,
+	8: unix.CS8,
+}
+
+// openSerial opens the tty device and puts it in raw mode with the line
+// settings of the console.
+func openSerial(device string, cfg serialConfig) (*os.File, error) {
+
+	speed, ok := serialBaudRates[cfg.baud]
+	if !ok {
+		return nil, fmt.Errorf("unsupported baud rate %d", cfg.baud)
+	}
+	size, ok := serialDataBits[cfg.dataBits]
+	if !ok {
+		return nil, fmt.Errorf("unsupported data bits %d", cfg.dataBits)
+	}
+
+	f, err := os.OpenFile(device, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := f.SyscallConn()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	var ioctlErr error
+	err = raw.Control(func(fd uintptr) {
+		var t *unix.Termios
+		t, ioctlErr = unix.IoctlGetTermios(int(fd), unix.TCGETS)
+		if ioctlErr != nil {
+			return
+		}
+
+		t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON | unix.INPCK
+		t.Oflag &^= unix.OPOST
+		t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		t.Cflag &^= unix.CSIZE | unix.PARENB | unix.PARODD | unix.CSTOPB | unix.CBAUD
+		t.Cflag |= size | unix.CREAD | unix.CLOCAL | speed
+
+		switch cfg.parity {
+		case ParityOdd:
+			t.Cflag |= unix.PARENB | unix.PARODD
+			t.Iflag |= unix.INPCK
+		case ParityEven:
+			t.Cflag |= unix.PARENB
+			t.Iflag |= unix.INPCK
+		}
+		if cfg.stopBits == 2 {
+			t.Cflag |= unix.CSTOPB
+		}
+
+		t.Ispeed = speed
+		t.Ospeed = speed
+		t.Cc[unix.VMIN] = 1
+		t.Cc[unix.VTIME] = 0
+
+		ioctlErr = unix.IoctlSetTermios(int(fd), unix.TCSETS, t)
+	})
+	if err == nil {
+		err = ioctlErr
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", device, err)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,139 @@
+package console_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"golang.org/x/sys/unix"
+)
+
+// openPty returns the master side of a new pseudo-terminal and the path of
+// its slave, which plays the serial device. The test keeps the slave open as
+// well, the master would read EIO while the console reopens it.
+func openPty(t *testing.T) (*os.File, string) {
+	t.Helper()
+
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminals: %s", err)
+	}
+	fd := int(master.Fd())
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		t.Fatal(err)
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("/dev/pts/%d", n)
+	slave, err := os.OpenFile(path, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { slave.Close() })
+	return master, path
+}
+
+func TestSerialConfig(t *testing.T) {
+	// a pseudo-terminal keeps 8 data bits and no parity whatever is set, only
+	// the speed and the stop bits can be checked
+	tests := []struct {
+		name    string
+		opts    []console.SerialConsoleOption
+		wantErr string
+		cflag   uint32
+	}{
+		{name: "default 115200 8N1", cflag: unix.B115200},
+		{name: "9600 7E2", opts: []console.SerialConsoleOption{console.WithOptionSerialBaud(9600),
+			console.WithOptionSerialDataBits(7), console.WithOptionSerialParity(console.ParityEven),
+			console.WithOptionSerialStopBits(2)}, cflag: unix.B9600 | unix.CSTOPB},
+		{name: "odd parity", opts: []console.SerialConsoleOption{console.WithOptionSerialParity(console.ParityOdd)},
+			cflag: unix.B115200},
+		{name: "bad baud", opts: []console.SerialConsoleOption{console.WithOptionSerialBaud(1234)},
+			wantErr: "unsupported baud rate"},
+		{name: "bad data bits", opts: []console.SerialConsoleOption{console.WithOptionSerialDataBits(9)},
+			wantErr: "unsupported data bits"},
+		{name: "bad stop bits", opts: []console.SerialConsoleOption{console.WithOptionSerialStopBits(3)},
+			wantErr: "unsupported stop bits"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			master, slave := openPty(t)
+			cl := newTestClient(t, master)
+			server := console.NewSerialConsole(slave, tt.opts...)
+
+			if tt.wantErr != "" {
+				err := server.Start()
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Start = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+
+			serveInBackground(t, server.Start, server.Stop)
+			cl.expectPrompt()
+
+			tio, err := unix.IoctlGetTermios(int(master.Fd()), unix.TCGETS)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := tio.Cflag&(unix.CBAUD|unix.CSTOPB), tt.cflag; got != want {
+				t.Errorf("cflag = %#o, want %#o", got, want)
+			}
+			if tio.Lflag&(unix.ECHO|unix.ICANON) != 0 {
+				t.Errorf("device not in raw mode, lflag %#o", tio.Lflag)
+			}
+		})
+	}
+}
+
+func TestSerialSession(t *testing.T) {
+	master, slave := openPty(t)
+	cl := newTestClient(t, master)
+
+	sessions := make(chan *console.Console, 2)
+	server := console.NewSerialConsole(slave, console.WithOptionSerialReopenDelay(50*time.Millisecond),
+		console.WithOptionSerialShutdownNotice("bye"))
+	server.AddCallbackOnNewConsole(func(c *console.Console) {
+		c.AddConsoleCommand(echoCommand)
+		sessions <- c
+	})
+	serveInBackground(t, server.Start, server.Stop)
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"echo one", "one\n"},
+		{"echo one two", "one\ntwo\n"},
+		{"nosuch", string(console.CMD_NOT_FOUND) + "\n"},
+	}
+	for _, tt := range tests {
+		if got := cl.run(tt.line); got != tt.want {
+			t.Errorf("run(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	// the device is reopened once the session ends
+	(<-sessions).Stop()
+	cl.expect("Welcome")
+	<-sessions
+	if got := cl.run("echo again"); got != "again\n" {
+		t.Errorf("output after reopen = %q", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown = %v", err)
+	}
+	cl.expect("bye\n")
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package console
+
+import (
+	"errors"
+	"os"
+)
+
+func openSerial(device string, cfg serialConfig) (*os.File, error) {
+	return nil, errors.New("serial console not supported on this platform")
+}
@@ -0,0 +1,211 @@
+package console
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SESSION_NOT_FOUND CommandError = "Session Not Found!"
+
+// SessionManager tracks the running consoles of all the transports, the
+// consoles join DefaultSessionManager when they start and leave it when they
+// stop. The JSON-RPC sessions join it once authenticated. The HTTP and unix
+// one-shot consoles are left out: they only live for one command and cannot
+// get a message afterwards.
+type SessionManager struct {
+	mu       sync.RWMutex
+	sessions map[int]*Console
+	lastID   int
+}
+
+var DefaultSessionManager = NewSessionManager()
+
+func NewSessionManager() *SessionManager {
+	return &SessionManager{sessions: make(map[int]*Console)}
+}
+
+// WithOptionSessionManager sets the manager the console joins, nil keeps it
+// out of any.
+func WithOptionSessionManager(m *SessionManager) ConsoleOption {
+	return func(console *Console) {
+		console.sessionManager = m
+	}
+}
+
+func (c *Console) joinSessionManager() {
+	if c.sessionManager != nil {
+		c.sessionManager.add(c)
+	}
+}
+
+func (c *Console) leaveSessionManager() {
+	if c.sessionManager != nil {
+		c.sessionManager.remove(c)
+	}
+}
+
+func (m *SessionManager) add(c *Console) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastID++
+	c.mu.Lock()
+	c.sessionID = m.lastID
+	c.mu.Unlock()
+	m.sessions[m.lastID] = c
+}
+
+func (m *SessionManager) remove(c *Console) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, c.GetSessionID())
+}
+
+// Sessions returns the consoles, by session id.
+func (m *SessionManager) Sessions() []*Console {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]int, 0, len(m.sessions))
+	for id := range m.sessions {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	consoles := make([]*Console, len(ids))
+	for i, id := range ids {
+		consoles[i] = m.sessions[id]
+	}
+	return consoles
+}
+
+// Get returns the console with the session id or the uuid given.
+func (m *SessionManager) Get(session string) (*Console, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if id, err := strconv.Atoi(session); err == nil {
+		c, ok := m.sessions[id]
+		return c, ok
+	}
+	for _, c := range m.sessions {
+		if c.GetUUID() == session {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// broadcastTimeout bounds the wait of Broadcast for the sessions, changed by
+// the tests.
+var broadcastTimeout = time.Second
+
+// Broadcast prints msg on the sessions of level or above, even the ones that
+// muted the notifications. The sessions still at the login are skipped. Each
+// session gets it on its own, a stalled client does not delay the others. It
+// returns how many sessions got it within a second, the slower ones still get
+// it later.
+func (m *SessionManager) Broadcast(msg string, level User) int {
+	var targets []*Console
+	for _, c := range m.Sessions() {
+		if c.isLoggedIn() && c.GetUserLevel() >= level {
+			targets = append(targets, c)
+		}
+	}
+
+	results := make(chan bool, len(targets))
+	for _, c := range targets {
+		go func(c *Console) { results <- c.notify(msg) }(c)
+	}
+
+	sent := 0
+	timeout := time.NewTimer(broadcastTimeout)
+	defer timeout.Stop()
+	for range targets {
+		select {
+		case ok := <-results:
+			if ok {
+				sent++
+			}
+		case <-timeout.C:
+			return sent
+		}
+	}
+	return sent
+}
+
+// GetSessionID returns the id of the console in its session manager, 0 if it
+// is not in one.
+func (c *Console) GetSessionID() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.sessionID
+}
+
+// isLoggedIn tells whether the user passed the login, if enabled. Until then
+// the level of the session is not the one of its user.
+func (c *Console) isLoggedIn() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return !c.mask.HasFlag(LOGIN_ENABLED) || c.mask.HasFlag(USER_LOGGED)
+}
+
+// sender names the user of the console in the messages to the other sessions.
+func (c *Console) sender() string {
+	name := c.GetUsername()
+	if name == "" {
+		name = c.GetUserLevel().String()
+	}
+	return fmt.Sprintf("%s (session %d)", name, c.GetSessionID())
+}
+
+func (c *Console) cmdWall(console *Console, command *ConsoleCommand, args []string) CommandError {
+	if len(args) == 0 || c.sessionManager == nil {
+		return BAD_FORMAT
+	}
+	msg := fmt.Sprintf("Broadcast message from %s at %s:%s%s", c.sender(), time.Now().Format("15:04"), eol,
+		strings.Join(args, " "))
+	c.sessionManager.Broadcast(msg, Guest)
+	return N0_ERR
+}
+
+func (c *Console) cmdWrite(console *Console, command *ConsoleCommand, args []string) CommandError {
+	if len(args) < 2 || c.sessionManager == nil {
+		return BAD_FORMAT
+	}
+	target, ok := c.sessionManager.Get(args[0])
+	if !ok || !target.isLoggedIn() {
+		return SESSION_NOT_FOUND
+	}
+	msg := fmt.Sprintf("Message from %s: %s", c.sender(), strings.Join(args[1:], " "))
+	if !target.Notify("write", msg) {
+		return CommandError(fmt.Sprintf("session %s does not accept messages", args[0]))
+	}
+	return N0_ERR
+}
+
+func (c *Console) cmdWho(console *Console, command *ConsoleCommand, args []string) CommandError {
+	if len(args) != 0 || c.sessionManager == nil {
+		return BAD_FORMAT
+	}
+	t := NewTable("session", "user", "level", "idle", "uuid")
+	for _, s := range c.sessionManager.Sessions() {
+		id := strconv.Itoa(s.GetSessionID())
+		if s == c {
+			id += "*"
+		}
+		level := s.GetUserLevel().String()
+		if !s.isLoggedIn() {
+			level = "login"
+		}
+		t.AddRow(id, s.GetUsername(), level, time.Since(s.lastActivity()).Truncate(time.Second).String(), s.GetUUID())
+	}
+	return c.PrintResult(t)
+}
@@ -0,0 +1,303 @@
+package console_test
+
+import (
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"github.com/freedreamer82/go-console/pkg/console/consoletest"
+)
+
+// newManagedSession starts a session in m with the user level given, and the
+// login enabled if password is not empty.
+func newManagedSession(t *testing.T, m *console.SessionManager, level console.User, password string) *consoletest.Session {
+	s := consoletest.NewSession(t, func(c *console.Console) {
+		c.SetUserLevel(level)
+		if password != "" {
+			c.EnableLogin(password)
+		}
+	}, console.WithOptionSessionManager(m))
+	waitFor(t, "session join", func() bool { return s.Console.GetSessionID() != 0 })
+	return s
+}
+
+func TestSessionManager(t *testing.T) {
+	m := console.NewSessionManager()
+	s1 := newManagedSession(t, m, console.Root, "")
+	s2 := newManagedSession(t, m, console.Root, "")
+
+	if id1, id2 := s1.Console.GetSessionID(), s2.Console.GetSessionID(); id1 != 1 || id2 != 2 {
+		t.Errorf("session ids = %d %d", id1, id2)
+	}
+	if got := m.Sessions(); len(got) != 2 || got[0] != s1.Console || got[1] != s2.Console {
+		t.Errorf("Sessions = %v", got)
+	}
+	for _, key := range []string{"2", s2.Console.GetUUID()} {
+		if c, ok := m.Get(key); !ok || c != s2.Console {
+			t.Errorf("Get(%s) = %v, %v", key, c, ok)
+		}
+	}
+	if _, ok := m.Get("9"); ok {
+		t.Error("Get(9) found a session")
+	}
+
+	// the stopped consoles leave the manager, the ids are not reused
+	s1.Close()
+	waitFor(t, "session leave", func() bool { return len(m.Sessions()) == 1 })
+	s3 := newManagedSession(t, m, console.Root, "")
+	if id := s3.Console.GetSessionID(); id != 3 {
+		t.Errorf("session id = %d, want 3", id)
+	}
+
+	// a console can stay out of any manager
+	s := consoletest.NewSession(t, nil, console.WithOptionSessionManager(nil))
+	for _, line := range []string{"who", "wall hi", "write 1 hi"} {
+		if got := s.Run(line); got != string(console.BAD_FORMAT)+"\n" {
+			t.Errorf("%s = %q", line, got)
+		}
+	}
+	if id := s.Console.GetSessionID(); id != 0 {
+		t.Errorf("session id = %d, want 0", id)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	m := console.NewSessionManager()
+	root := newManagedSession(t, m, console.Root, "")
+	guest := newManagedSession(t, m, console.Guest, "")
+	login := newManagedSession(t, m, console.Root, "secret")
+	login.Expect("Password?")
+
+	// the muted sessions get the broadcasts anyway
+	guest.Console.MuteNotifications(true)
+
+	if n := m.Broadcast("to everybody", console.Guest); n != 2 {
+		t.Errorf("Broadcast to Guest = %d, want 2", n)
+	}
+	if n := m.Broadcast("to root", console.Root); n != 1 {
+		t.Errorf("Broadcast to Root = %d, want 1", n)
+	}
+	root.Expect("to everybody\n")
+	root.Expect("to root\n")
+	guest.Expect("to everybody\n")
+
+	// once logged in the session gets them
+	login.Send("secret")
+	login.Expect("Authenticated\n")
+	if n := m.Broadcast("after login", console.Root); n != 2 {
+		t.Errorf("Broadcast after login = %d, want 2", n)
+	}
+	login.Expect("after login\n")
+
+	if strings.Contains(guest.Transcript(), "to root") {
+		t.Errorf("guest got a root broadcast:\n%s", guest.Transcript())
+	}
+	if strings.Contains(login.Transcript(), "to everybody") {
+		t.Errorf("a session at the login got a broadcast:\n%s", login.Transcript())
+	}
+}
+
+// stalledClient never reads the output of its session nor sends anything,
+// until released.
+type stalledClient chan struct{}
+
+func (c stalledClient) Read(b []byte) (int, error) {
+	<-c
+	return 0, io.EOF
+}
+
+func (c stalledClient) Write(b []byte) (int, error) {
+	<-c
+	return len(b), nil
+}
+
+func (c stalledClient) Close() error { return nil }
+
+func TestBroadcastStalledSession(t *testing.T) {
+	defer console.SetBroadcastTimeout(200 * time.Millisecond)()
+
+	m := console.NewSessionManager()
+	client := make(stalledClient)
+	stalled := console.NewConsole(console.ConsoleI{ReadCloser: client, Writer: client}, console.WithOptionSessionManager(m))
+	stalled.Start()
+	t.Cleanup(func() {
+		close(client)
+		stalled.Stop()
+	})
+	waitFor(t, "stalled session join", func() bool { return stalled.GetSessionID() != 0 })
+	s := newManagedSession(t, m, console.Root, "")
+
+	start := time.Now()
+	if n := m.Broadcast("to everybody", console.Guest); n != 1 {
+		t.Errorf("Broadcast = %d, want 1", n)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Broadcast took %s", elapsed)
+	}
+	s.Expect("to everybody\n")
+}
+
+func TestWall(t *testing.T) {
+	m := console.NewSessionManager()
+	s1 := newManagedSession(t, m, console.Root, "")
+	s2 := newManagedSession(t, m, console.Guest, "")
+	s1.Console.Authenticate("admin", console.Root)
+
+	if got := s1.Run("wall rebooting in 5 minutes"); !regexp.MustCompile(
+		`^Broadcast message from admin \(session 1\) at \d\d:\d\d:\nrebooting in 5 minutes\n$`).MatchString(got) {
+		t.Errorf("wall = %q", got)
+	}
+	s2.ExpectRegexp(`Broadcast message from admin \(session 1\) at \d\d:\d\d:\n`)
+	s2.Expect("rebooting in 5 minutes\n")
+
+	if got := s1.Run("wall"); got != string(console.BAD_FORMAT)+"\n" {
+		t.Errorf("wall without message = %q", got)
+	}
+	if got := s2.Run("wall hi"); got != string(console.CMD_NOT_FOUND)+"\n" {
+		t.Errorf("wall by a guest = %q", got)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	m := console.NewSessionManager()
+	s1 := newManagedSession(t, m, console.Root, "")
+	s2 := newManagedSession(t, m, console.Guest, "")
+	s3 := newManagedSession(t, m, console.Root, "secret")
+	s3.Expect("Password?")
+
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{"by id", "write 2 hello there", ""},
+		{"by uuid", "write " + s2.Console.GetUUID() + " again", ""},
+		{"unknown session", "write 9 hello", string(console.SESSION_NOT_FOUND) + "\n"},
+		{"session at the login", "write 3 hello", string(console.SESSION_NOT_FOUND) + "\n"},
+		{"missing message", "write 2", string(console.BAD_FORMAT) + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s1.Run(tt.line); got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+	s2.Expect("Message from Root (session 1): hello there\n")
+	s2.Expect("Message from Root (session 1): again\n")
+
+	// write honors the notification settings of the target
+	s2.Console.Unsubscribe("write")
+	if got := s1.Run("write 2 ignored"); got != "session 2 does not accept messages\n" {
+		t.Errorf("write to an unsubscribed session = %q", got)
+	}
+	if got := s2.Run("write 1 hi"); got != string(console.CMD_NOT_FOUND)+"\n" {
+		t.Errorf("write by a guest = %q", got)
+	}
+}
+
+func TestWho(t *testing.T) {
+	m := console.NewSessionManager()
+	s1 := newManagedSession(t, m, console.Root, "")
+	s2 := newManagedSession(t, m, console.Guest, "")
+	s3 := newManagedSession(t, m, console.Root, "secret")
+	s3.Expect("Password?")
+	s2.Console.Authenticate("bob", console.Guest)
+
+	got := strings.Split(strings.TrimSuffix(s1.Run("who --output csv"), "\n"), "\n")
+	want := []string{
+		`^session,user,level,idle,uuid$`,
+		`^1\*,,Root,\d+s,` + s1.Console.GetUUID() + `$`,
+		`^2,bob,Guest,\d+s,` + s2.Console.GetUUID() + `$`,
+		`^3,,login,\d+s,` + s3.Console.GetUUID() + `$`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("who = %q", got)
+	}
+	for i := range want {
+		if !regexp.MustCompile(want[i]).MatchString(got[i]) {
+			t.Errorf("who line %d = %q, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestBuiltinUserLevels(t *testing.T) {
+	tests := []struct {
+		line  string
+		guest bool
+	}{
+		{"alias", true},
+		{"unalias -a", true},
+		{"buffers", true},
+		{"diff @a @b", true},
+		{"format", true},
+		{"color", true},
+		{"notifications", true},
+		{"help", false},
+		{"whoAmI", false},
+		{"source script", false},
+		{"who", false},
+		{"wall hi", false},
+		{"write 1 hi", false},
+	}
+	m := console.NewSessionManager()
+	guest := newManagedSession(t, m, console.Guest, "")
+	root := newManagedSession(t, m, console.Root, "")
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := guest.Run(tt.line); (got != string(console.CMD_NOT_FOUND)+"\n") != tt.guest {
+				t.Errorf("guest %s = %q", tt.line, got)
+			}
+			if got := root.Run(tt.line); got == string(console.CMD_NOT_FOUND)+"\n" {
+				t.Errorf("root %s = %q", tt.line, got)
+			}
+		})
+	}
+}
+
+func TestBroadcastTransports(t *testing.T) {
+	telnetConsoles := make(chan *console.Console, 1)
+	_, telnetAddr := startTelnet(t, func(c *console.Console) { telnetConsoles <- c })
+	rpcConsoles := make(chan *console.Console, 1)
+	_, rpcAddr := startJSONRPC(t, func(c *console.Console) { rpcConsoles <- c },
+		console.WithOptionJSONRPCTokens(map[string]console.User{"tok": console.Root}))
+
+	telnet := dialTelnet(t, telnetAddr)
+	telnet.expectPrompt()
+	telnetConsole := <-telnetConsoles
+	waitFor(t, "telnet session join", func() bool { return telnetConsole.GetSessionID() != 0 })
+
+	// the json-rpc sessions join once authenticated
+	rpc := dialTestClient(t, "tcp", rpcAddr)
+	rpcConsole := <-rpcConsoles
+	rpc.send(`{"jsonrpc":"2.0","id":1,"method":"exec","params":{"line":"whoAmI"}}` + "\n")
+	rpc.expectJSON(`{"jsonrpc":"2.0","id":1,"error":{"code":-32001,"message":"unauthorized"}}`)
+	if id := rpcConsole.GetSessionID(); id != 0 {
+		t.Errorf("json-rpc session id before auth = %d", id)
+	}
+	rpc.send(`{"jsonrpc":"2.0","id":2,"method":"auth","params":{"token":"tok"}}` + "\n")
+	rpc.expectJSON(`{"jsonrpc":"2.0","id":2,"result":{"level":"Root"}}`)
+	if id := rpcConsole.GetSessionID(); id == 0 {
+		t.Error("json-rpc session not joined after auth")
+	}
+
+	s := consoletest.NewSession(t, nil)
+	s.Run("wall maintenance at noon")
+	telnet.expect("maintenance at noon\n")
+	rpc.wait("message notification", func(pending string) int {
+		if idx := strings.Index(pending, `"method":"message"`); idx >= 0 && strings.Contains(pending[idx:], "maintenance at noon") {
+			return len(pending)
+		}
+		return -1
+	})
+
+	if got := s.Run("write " + strconv.Itoa(rpcConsole.GetSessionID()) + " hello"); got != "" {
+		t.Errorf("write to the json-rpc session = %q", got)
+	}
+	rpc.expectJSON(`{"jsonrpc":"2.0","method":"message","params":{"text":"Message from Root (session ` +
+		strconv.Itoa(s.Console.GetSessionID()) + `): hello"}}`)
+}
@@ -0,0 +1,30 @@
+package console
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const defaultShutdownNotice = "*** Server is shutting down, bye ***"
+
+// shutdownConsoles drains all the consoles in parallel sharing the same
+// deadline and returns the aggregated errors.
+func shutdownConsoles(ctx context.Context, consoles []*Console, notice string) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(consoles))
+
+	for idx, console := range consoles {
+		wg.Add(1)
+		go func(idx int, console *Console) {
+			defer wg.Done()
+			if err := console.Shutdown(ctx, notice); err != nil {
+				errs[idx] = fmt.Errorf("console %s: %w", console.GetUUID(), err)
+			}
+		}(idx, console)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
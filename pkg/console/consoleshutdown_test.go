@@ -0,0 +1,130 @@
+package console_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"github.com/freedreamer82/go-console/pkg/console/consoletest"
+)
+
+// sleepCommand blocks for its argument, or until the console is stopped.
+var sleepCommand = console.NewConsoleCommand("sleep", func(c *console.Console, command *console.ConsoleCommand, args []string) console.CommandError {
+	d, err := time.ParseDuration(args[0])
+	if err != nil {
+		return console.BAD_FORMAT
+	}
+	select {
+	case <-time.After(d):
+		c.Print("slept")
+	case <-c.Context().Done():
+	}
+	return console.N0_ERR
+}, "sleep for a duration")
+
+func TestConsoleShutdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		deadline time.Duration
+		wantErr  error
+	}{
+		{"idle", "", 500 * time.Millisecond, nil},
+		{"command completes", "sleep 100ms", 2 * time.Second, nil},
+		{"deadline expires", "sleep 10s", 100 * time.Millisecond, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := consoletest.NewSession(t, func(c *console.Console) {
+				c.AddConsoleCommand(sleepCommand)
+				c.AddConsoleCommand(echoCommand)
+			})
+			s.ExpectPrompt()
+			if tt.command != "" {
+				s.Send(tt.command)
+				s.Expect(tt.command + "\n")
+				waitFor(t, "command start", func() bool {
+					return s.Console.WaitIdle(expiredContext()) != nil
+				})
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.deadline)
+			defer cancel()
+			if err := s.Console.Shutdown(ctx, "going down"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Shutdown = %v, want %v", err, tt.wantErr)
+			}
+			s.Expect("going down\n")
+
+			select {
+			case <-s.Console.Done():
+			case <-time.After(testTimeout):
+				t.Fatal("console not stopped")
+			}
+			if err := s.Console.Exec("echo late"); err != console.CMD_REFUSED {
+				t.Errorf("Exec after Shutdown = %q, want %q", err, console.CMD_REFUSED)
+			}
+		})
+	}
+}
+
+// expiredContext is done already, WaitIdle returns an error with it only
+// while a command is running.
+func expiredContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+func TestTelnetShutdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		notice  string
+		command string
+		wantErr error
+	}{
+		{"default notice", "", "", nil},
+		{"custom notice", "maintenance", "", nil},
+		{"busy session", "maintenance", "sleep 10s", context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []console.TelnetConsoleOption{}
+			want := "*** Server is shutting down, bye ***"
+			if tt.notice != "" {
+				opts = append(opts, console.WithOptionTelnetShutdownNotice(tt.notice))
+				want = tt.notice
+			}
+			sessions := make(chan *console.Console, 1)
+			server, addr := startTelnet(t, func(c *console.Console) {
+				c.AddConsoleCommand(sleepCommand)
+				sessions <- c
+			}, opts...)
+
+			cl := dialTelnet(t, addr)
+			cl.expectPrompt()
+			session := <-sessions
+			if tt.command != "" {
+				cl.send(tt.command + "\r\n")
+				waitFor(t, "command start", func() bool {
+					return session.WaitIdle(expiredContext()) != nil
+				})
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+			if err := server.Shutdown(ctx); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Shutdown = %v, want %v", err, tt.wantErr)
+			}
+			cl.expect(want + "\n")
+			cl.expectClosed()
+
+			if conn, err := net.DialTimeout("tcp", addr, testTimeout); err == nil {
+				conn.Close()
+				t.Error("new connection accepted after Shutdown")
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package console
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
@@ -24,6 +25,9 @@ type SSHConsole struct {
 	keyPassPhrase        string
 	callbackOnNewConsole OnNewConsole
 	timeout              time.Duration
+	shutdownNotice       string
+	prompt               string
+	closing              bool
 }
 
 type SSHConsoleOption func(console *SSHConsole)
@@ -40,6 +44,19 @@ func WithOptionConsoleTimeout(timeout time.Duration) SSHConsoleOption {
 	}
 }
 
+func WithOptionShutdownNotice(notice string) SSHConsoleOption {
+	return func(console *SSHConsole) {
+		console.shutdownNotice = notice
+	}
+}
+
+// WithOptionSSHPrompt sets the prompt template of the consoles, see WithOptionPrompt.
+func WithOptionSSHPrompt(template string) SSHConsoleOption {
+	return func(console *SSHConsole) {
+		console.prompt = template
+	}
+}
+
 func (c *SSHConsole) AddCallbackOnNewConsole(cb OnNewConsole) {
 	c.callbackOnNewConsole = cb
 
@@ -52,11 +69,12 @@ func NewSSHConsoleWithPassword(
 ) (*SSHConsole, error) {
 
 	console := &SSHConsole{
-		mu:            &sync.RWMutex{},
-		listener:      nil,
-		consoles:      nil,
-		connections:   make(connMap),
-		keyPassPhrase: "",
+		mu:             &sync.RWMutex{},
+		listener:       nil,
+		consoles:       nil,
+		connections:    make(connMap),
+		keyPassPhrase:  "",
+		shutdownNotice: defaultShutdownNotice,
 	}
 
 	for _, opt := range opts {
@@ -109,11 +127,12 @@ func NewSSHConsoleWithCertificates(
 ) (*SSHConsole, error) {
 
 	console := &SSHConsole{
-		mu:            &sync.RWMutex{},
-		listener:      nil,
-		consoles:      nil,
-		connections:   make(connMap),
-		keyPassPhrase: "",
+		mu:             &sync.RWMutex{},
+		listener:       nil,
+		consoles:       nil,
+		connections:    make(connMap),
+		keyPassPhrase:  "",
+		shutdownNotice: defaultShutdownNotice,
 	}
 
 	for _, opt := range opts {
@@ -183,12 +202,19 @@ func (c *SSHConsole) Start(host string, port int, maxConnections int) error {
 	}
 
 	c.mu.Lock()
+	if c.closing {
+		c.mu.Unlock()
+		return listener.Close()
+	}
 	c.listener = listener
 	c.mu.Unlock()
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			if c.isClosing() {
+				return nil
+			}
 			return err
 		}
 
@@ -233,31 +259,89 @@ func (c *SSHConsole) Start(host string, port int, maxConnections int) error {
 	}
 }
 
-func (c *SSHConsole) Stop() error {
+func (c *SSHConsole) isClosing() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.closing
+}
+
+// stopAccepting closes the listener and returns the consoles still alive.
+func (c *SSHConsole) stopAccepting() ([]*Console, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	for _, console := range c.consoles {
-		console.Stop()
+	c.closing = true
+	consoles := append([]*Console(nil), c.consoles...)
+
+	if c.listener == nil {
+		return consoles, nil
 	}
+	err := c.listener.Close()
+	c.listener = nil
+	return consoles, err
+}
+
+func (c *SSHConsole) closeConnections() []error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
+	var errs []error
 	for conn, channels := range c.connections {
 		for _, channel := range channels {
-			if err := channel.Close(); err != nil {
-				return err
+			if channel == nil {
+				continue
+			}
+			if err := channel.Close(); err != nil && !errors.Is(err, io.EOF) {
+				errs = append(errs, err)
 			}
 		}
-		if err := conn.Close(); err != nil {
-			return err
+		if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
 		}
 	}
-	c.connections = nil
+	c.connections = make(connMap)
+	c.consoles = nil
 
-	if err := c.listener.Close(); err != nil {
-		return err
+	return errs
+}
+
+// Stop closes the listener and every session immediately.
+func (c *SSHConsole) Stop() error {
+	consoles, err := c.stopAccepting()
+	errs := []error{err}
+
+	for _, console := range consoles {
+		console.Stop()
 	}
+	errs = append(errs, c.closeConnections()...)
 
-	return nil
+	return errors.Join(errs...)
+}
+
+// Shutdown stops accepting connections, sends the shutdown notice to the live
+// sessions and waits for their commands to complete until ctx expires, then
+// closes every connection.
+func (c *SSHConsole) Shutdown(ctx context.Context) error {
+	consoles, err := c.stopAccepting()
+	errs := []error{err}
+
+	errs = append(errs, shutdownConsoles(ctx, consoles, c.shutdownNotice))
+	errs = append(errs, c.closeConnections()...)
+
+	return errors.Join(errs...)
+}
+
+func (c *SSHConsole) removeConsole(console *Console) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for idx, cl := range c.consoles {
+		if cl == console {
+			c.consoles = append(c.consoles[:idx], c.consoles[idx+1:]...)
+			break
+		}
+	}
 }
 
 func (c *SSHConsole) closeChannel(conn *ssh.ServerConn, channel ssh.Channel) error {
@@ -304,7 +388,7 @@ func (c *SSHConsole) handleChanReq(conn *ssh.ServerConn, req ssh.NewChannel) err
 		}
 	}
 
-	ch, _, err := req.Accept()
+	ch, requests, err := req.Accept()
 	if err != nil {
 		return err
 	}
@@ -324,7 +408,12 @@ func (c *SSHConsole) handleChanReq(conn *ssh.ServerConn, req ssh.NewChannel) err
 	}
 
 	console := NewConsole(consoleIO)
+	go c.handleSessionRequests(console, requests)
+	if c.prompt != "" {
+		console.SetPrompt(c.prompt)
+	}
 	console.AddCallbackOnClose(func() {
+		c.removeConsole(console)
 		err := c.closeChannel(conn, ch)
 		if err != nil {
 			log.Println("Failed to close console channel, already closed?")
@@ -347,3 +436,49 @@ func (c *SSHConsole) handleChanReq(conn *ssh.ServerConn, req ssh.NewChannel) err
 
 	return nil
 }
+
+type sshPtyRequest struct {
+	Term   string
+	Width  uint32
+	Height uint32
+	PxW    uint32
+	PxH    uint32
+	Modes  string
+}
+
+type sshWindowChange struct {
+	Width  uint32
+	Height uint32
+	PxW    uint32
+	PxH    uint32
+}
+
+// handleSessionRequests gets the terminal type and size from pty-req and
+// window-change, the other requests but shell are refused.
+func (c *SSHConsole) handleSessionRequests(console *Console, requests <-chan *ssh.Request) {
+	for req := range requests {
+		ok := false
+		switch req.Type {
+		case "pty-req":
+			var pty sshPtyRequest
+			if err := ssh.Unmarshal(req.Payload, &pty); err == nil {
+				console.SetTerminalType(pty.Term)
+				if pty.Width > 0 && pty.Height > 0 {
+					console.SetSize(int(pty.Width), int(pty.Height))
+				}
+				ok = true
+			}
+		case "window-change":
+			var win sshWindowChange
+			if err := ssh.Unmarshal(req.Payload, &win); err == nil && win.Width > 0 && win.Height > 0 {
+				console.SetSize(int(win.Width), int(win.Height))
+				ok = true
+			}
+		case "shell":
+			ok = true
+		}
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package console_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"golang.org/x/crypto/ssh"
+)
+
+// writeHostKey writes a new ed25519 host key in dir.
+func writeHostKey(t *testing.T, dir string) string {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "host_key")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// freePort returns a local port nobody listens on, for the servers that do
+// not take a listener.
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// startSSH serves an ssh console with the password login of user "test".
+func startSSH(t *testing.T, setup func(c *console.Console), opts ...console.SSHConsoleOption) (*console.SSHConsole, string) {
+	t.Helper()
+
+	server, err := console.NewSSHConsoleWithPassword(writeHostKey(t, t.TempDir()),
+		map[string]string{"test": "secret"}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if setup != nil {
+		server.AddCallbackOnNewConsole(setup)
+	}
+	port := freePort(t)
+	serveInBackground(t, func() error { return server.Start("127.0.0.1", port, 4) }, server.Stop)
+
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+	waitFor(t, "ssh listener", func() bool {
+		conn, err := net.Dial("tcp4", addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	})
+	return server, addr
+}
+
+type sshClient struct {
+	*testClient
+	ch ssh.Channel
+}
+
+// dialSSH opens a shell session, with a pty of the given size if width is
+// not 0.
+func dialSSH(t *testing.T, addr string, width int, height int) *sshClient {
+	t.Helper()
+
+	client, err := ssh.Dial("tcp4", addr, &ssh.ClientConfig{
+		User:            "test",
+		Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         testTimeout,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	ch, requests, err := client.OpenChannel("session", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ssh.DiscardRequests(requests)
+
+	if width != 0 {
+		pty := struct {
+			Term          string
+			Width, Height uint32
+			PxW, PxH      uint32
+			Modes         string
+		}{"xterm", uint32(width), uint32(height), 0, 0, ""}
+		if ok, err := ch.SendRequest("pty-req", true, ssh.Marshal(&pty)); err != nil || !ok {
+			t.Fatalf("pty-req: %v %v", ok, err)
+		}
+	}
+	if ok, err := ch.SendRequest("shell", true, nil); err != nil || !ok {
+		t.Fatalf("shell: %v %v", ok, err)
+	}
+	return &sshClient{testClient: newTestClient(t, ch), ch: ch}
+}
+
+// resize sends the new size of the terminal.
+func (cl *sshClient) resize(width int, height int) {
+	cl.t.Helper()
+
+	win := struct {
+		Width, Height uint32
+		PxW, PxH      uint32
+	}{uint32(width), uint32(height), 0, 0}
+	if _, err := cl.ch.SendRequest("window-change", false, ssh.Marshal(&win)); err != nil {
+		cl.t.Fatalf("window-change: %s", err)
+	}
+}
+
+func TestSSHShutdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []console.SSHConsoleOption
+		want    string
+		clients int
+	}{
+		{"default notice", nil, "*** Server is shutting down, bye ***", 1},
+		{"custom notice", []console.SSHConsoleOption{console.WithOptionShutdownNotice("maintenance")}, "maintenance", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, addr := startSSH(t, nil, tt.opts...)
+
+			var clients []*sshClient
+			for i := 0; i < tt.clients; i++ {
+				cl := dialSSH(t, addr, 0, 0)
+				cl.expectPrompt()
+				clients = append(clients, cl)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := server.Shutdown(ctx); err != nil {
+				t.Errorf("Shutdown = %v", err)
+			}
+			for _, cl := range clients {
+				cl.expect(tt.want + "\n")
+				cl.expectClosed()
+			}
+		})
+	}
+}
@@ -1,16 +1,22 @@
 package console
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	log "github.com/sirupsen/logrus"
 	terminal "golang.org/x/term"
 	"io"
 	"os"
 	"os/signal"
+	"strings"
 )
 
 type StdOutputConsole struct {
 	*Console
 	oldstate *terminal.State
 	chexit   chan os.Signal
+	result   chan error
 }
 
 func (c *StdOutputConsole) onExit() {
@@ -19,15 +25,36 @@ func (c *StdOutputConsole) onExit() {
 	os.Exit(0)
 }
 
+// crlfStripper drops the carriage returns of the terminal when the output is
+// redirected to a file or a pipe.
+type crlfStripper struct {
+	w io.Writer
+}
+
+func (s crlfStripper) Write(b []byte) (int, error) {
+	if _, err := s.w.Write(bytes.ReplaceAll(b, []byte("\r"), nil)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
 func NewStdOutputConsole() *StdOutputConsole {
 
+	var stdout io.Writer = os.Stdout
+	var opts []ConsoleOption
+	if !terminal.IsTerminal(1) {
+		stdout = crlfStripper{os.Stdout}
+		opts = append(opts, WithOptionColor(false), WithOptionInteractive(false), WithOptionOutputFormat(FormatJSON))
+	}
+
 	screen := struct {
 		io.ReadCloser
 		io.Writer
 		Flusher
-	}{os.Stdin, os.Stdout, nil}
+	}{os.Stdin, stdout, nil}
 
-	c := StdOutputConsole{Console: NewConsole(screen)}
+	c := StdOutputConsole{Console: NewConsole(screen, opts...), result: make(chan error, 1)}
+	c.SetTerminalType(os.Getenv("TERM"))
 
 	c.AddCallbackOnClose(c.onExit)
 	c.chexit = make(chan os.Signal, 1)
@@ -47,9 +74,16 @@ func NewStdOutputConsole() *StdOutputConsole {
 //	}()
 //}
 
+// Start runs the console on the terminal. When stdin is not a terminal the
+// commands are read from it as a script (the first line is the password if
+// the login is enabled) and the outcome is sent on ScriptResult.
 func (c *StdOutputConsole) Start() bool {
 
-	if !terminal.IsTerminal(0) || !terminal.IsTerminal(1) {
+	if !terminal.IsTerminal(0) {
+		go c.runNonInteractive()
+		return true
+	}
+	if !terminal.IsTerminal(1) {
 		return false
 	}
 	var err error
@@ -64,3 +98,34 @@ func (c *StdOutputConsole) Start() bool {
 	//select {}
 	return c.Console.Start()
 }
+
+// ScriptResult returns the channel receiving the outcome of the script read
+// from stdin: nil, or the error of the login or of the first failing command.
+// It is up to the application to exit, e.g. with status 1 on error.
+func (c *StdOutputConsole) ScriptResult() <-chan error {
+	return c.result
+}
+
+func (c *StdOutputConsole) runNonInteractive() {
+	err := c.runScriptFromStdin()
+	c.stop(false)
+	c.result <- err
+}
+
+func (c *StdOutputConsole) runScriptFromStdin() error {
+
+	r := bufio.NewReader(os.Stdin)
+	if c.IsLoginEnabled() && !c.IsUserLogged() {
+		pwd, _ := r.ReadString('\n')
+		if !c.handleLogin(strings.TrimRight(pwd, "\r\n")) {
+			c.PrintError("Login failed")
+			return errors.New("login failed")
+		}
+	}
+
+	if err := c.RunScript(r); err != nil {
+		log.Debugf("Script failed: %s", err)
+		return err
+	}
+	return nil
+}
@@ -1,12 +1,11 @@
 package console
 
 import (
-	"bufio"
-	"fmt"
+	"context"
+	"errors"
 	log "github.com/sirupsen/logrus"
 	"io"
 	"net"
-	"os"
 	"strconv"
 	"sync"
 	"time"
@@ -19,46 +18,118 @@ type telnetClient struct {
 }
 
 type TelnetConsole struct {
+	*listenerServer
 	mu                   *sync.RWMutex
 	clients              []telnetClient
+	host                 string
 	port                 int
-	maxclient            int
+	network              string
 	callbackOnNewConsole OnNewConsole
 	timeout              time.Duration
+	shutdownNotice       string
+	prompt               string
+	authenticator        telnetAuthenticator
 }
 
-func (c *TelnetConsole) socketServer(port int) {
+// telnetAuthenticator identifies the user of a connection before its console
+// is created, an empty username leaves the password login in place.
+type telnetAuthenticator func(conn net.Conn) (username string, level User, err error)
 
-	listen, err := net.Listen("tcp4", ":"+strconv.Itoa(port))
+type TelnetConsoleOption func(console *TelnetConsole)
 
-	if err != nil {
-		log.Fatalf("Socket listen port %d failed,%s", port, err)
-		os.Exit(1)
+func WithOptionTelnetHost(host string) TelnetConsoleOption {
+	return func(console *TelnetConsole) {
+		console.host = host
 	}
+}
 
-	defer listen.Close()
+func WithOptionTelnetPort(port int) TelnetConsoleOption {
+	return func(console *TelnetConsole) {
+		console.port = port
+	}
+}
 
-	//log.Printf("Begin listen port: %d\r\n", port)
+// WithOptionTelnetNetwork selects "tcp4", "tcp6" or "tcp" (dual-stack, the
+// default).
+func WithOptionTelnetNetwork(network string) TelnetConsoleOption {
+	return func(console *TelnetConsole) {
+		console.network = network
+	}
+}
 
-	for {
-		conn, err := listen.Accept()
-		if err != nil {
-			log.Fatalln(err)
-			continue
-		}
+// WithOptionTelnetKeepAlive sets the TCP keepalive period of the accepted
+// connections, a negative value disables keepalive.
+func WithOptionTelnetKeepAlive(period time.Duration) TelnetConsoleOption {
+	return func(console *TelnetConsole) {
+		console.keepAlive = period
+	}
+}
 
-		if len(c.clients) > c.maxclient {
-			conn.Close()
-			fmt.Printf("MAX clients reached! %d/%d", c.clients, c.maxclient)
-			fmt.Println()
-			continue
-		}
-		go c.handler(conn)
+// WithOptionTelnetListener serves on an already opened listener, host, port
+// and network are ignored.
+func WithOptionTelnetListener(listener net.Listener) TelnetConsoleOption {
+	return func(console *TelnetConsole) {
+		console.listener = listener
+	}
+}
+
+// WithOptionTelnetMaxClients limits the sessions served at the same time,
+// UnlimitedClients (the default) removes the limit.
+func WithOptionTelnetMaxClients(maxclient int) TelnetConsoleOption {
+	return func(console *TelnetConsole) {
+		console.maxclient = maxclient
+	}
+}
+
+func WithOptionTelnetMaxClientsPerIP(maxclient int) TelnetConsoleOption {
+	return func(console *TelnetConsole) {
+		console.maxclientPerIP = maxclient
+	}
+}
+
+// WithOptionTelnetRejectMessage sets the message written to the connections
+// rejected by the client limits, empty to close them silently.
+func WithOptionTelnetRejectMessage(msg string) TelnetConsoleOption {
+	return func(console *TelnetConsole) {
+		console.rejectMessage = msg
+	}
+}
+
+func WithOptionTelnetTimeout(timeout time.Duration) TelnetConsoleOption {
+	return func(console *TelnetConsole) {
+		console.timeout = timeout
+	}
+}
+
+func WithOptionTelnetShutdownNotice(notice string) TelnetConsoleOption {
+	return func(console *TelnetConsole) {
+		console.shutdownNotice = notice
+	}
+}
+
+// WithOptionTelnetPrompt sets the prompt template of the consoles, see WithOptionPrompt.
+func WithOptionTelnetPrompt(template string) TelnetConsoleOption {
+	return func(console *TelnetConsole) {
+		console.prompt = template
+	}
+}
+
+// Start listens and serves the telnet clients, it blocks until the console is
+// shut down or the listener fails.
+func (c *TelnetConsole) Start() error {
+
+	listener, err := c.openListener(c.network, net.JoinHostPort(c.host, strconv.Itoa(c.port)))
+	if err != nil {
+		return err
 	}
 
+	return c.serve(listener, c.handler)
 }
 
 func (c *TelnetConsole) oncClose(uuid string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	for _, cl := range c.clients {
 		if uuid == cl.uuid {
 			cl.quit <- true
@@ -79,27 +150,77 @@ func (c *TelnetConsole) SetTimeout(timeout time.Duration) {
 	c.timeout = timeout
 }
 
-func (c *TelnetConsole) handler(conn net.Conn) {
+func (c *TelnetConsole) SetShutdownNotice(notice string) {
+	c.shutdownNotice = notice
+}
+
+// stopAccepting closes the listener and returns the consoles still alive.
+func (c *TelnetConsole) stopAccepting() ([]*Console, error) {
+	err := c.closeListener()
 
-	var (
-		r = bufio.NewReader(conn)
-		w = bufio.NewWriter(conn)
-	)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	consoles := make([]*Console, 0, len(c.clients))
+	for _, cl := range c.clients {
+		consoles = append(consoles, cl.console)
+	}
+	return consoles, err
+}
 
-	rc := struct {
-		io.Reader
-		io.Closer
-	}{
-		r, conn,
+// Stop closes the listener and every session immediately.
+func (c *TelnetConsole) Stop() error {
+	consoles, err := c.stopAccepting()
+	for _, console := range consoles {
+		console.Stop()
+	}
+	return err
+}
+
+// Shutdown stops accepting connections, sends the shutdown notice to the live
+// sessions and waits for their commands to complete until ctx expires, then
+// closes every connection.
+func (c *TelnetConsole) Shutdown(ctx context.Context) error {
+	consoles, err := c.stopAccepting()
+	return errors.Join(err, shutdownConsoles(ctx, consoles, c.shutdownNotice))
+}
+
+func (c *TelnetConsole) handler(conn net.Conn) {
+
+	var username string
+	var level User
+	if c.authenticator != nil {
+		var err error
+		username, level, err = c.authenticator(conn)
+		if err != nil {
+			log.Warnf("Telnet connection from %s rejected: %s", conn.RemoteAddr(), err)
+			conn.Close()
+			return
+		}
 	}
 
+	proto := newTelnetProtocol(conn)
+
 	io := struct {
 		io.ReadCloser
 		io.Writer
 		Flusher
-	}{rc, w, w}
+	}{proto, proto, proto}
 
 	console := NewConsole(io)
+	if c.prompt != "" {
+		console.SetPrompt(c.prompt)
+	}
+	proto.onResize = func(width, height int) {
+		console.SetSize(width, height)
+	}
+	proto.onTerminalType = console.SetTerminalType
+	if err := proto.negotiate(); err != nil {
+		log.Warnf("Telnet negotiation failed: %s", err)
+	}
+	if username != "" {
+		console.Authenticate(username, level)
+	}
 	uuid := console.uuid
 	quit := make(chan bool)
 	client := telnetClient{console: console, uuid: uuid, quit: quit}
@@ -134,9 +255,35 @@ func (c *TelnetConsole) handler(conn net.Conn) {
 
 }
 
-func NewTelnetConsole(port int, maxclient int) *TelnetConsole {
-	c := TelnetConsole{mu: &sync.RWMutex{}, port: port, maxclient: maxclient}
+func newTelnetConsole(opts ...TelnetConsoleOption) *TelnetConsole {
+	c := TelnetConsole{listenerServer: newListenerServer("Telnet"), mu: &sync.RWMutex{}, network: "tcp",
+		shutdownNotice: defaultShutdownNotice}
 	c.callbackOnNewConsole = nil
-	go c.socketServer(port)
+
+	for _, opt := range opts {
+		opt(&c)
+	}
+
 	return &c
 }
+
+// NewTelnetConsoleWithOptions creates a telnet console that starts serving
+// only when Start is called.
+func NewTelnetConsoleWithOptions(opts ...TelnetConsoleOption) *TelnetConsole {
+	return newTelnetConsole(opts...)
+}
+
+// NewTelnetConsole listens on all the IPv4 interfaces and starts serving right
+// away, listen errors are only logged.
+//
+// Deprecated: use NewTelnetConsoleWithOptions and Start.
+func NewTelnetConsole(port int, maxclient int) *TelnetConsole {
+	c := newTelnetConsole(WithOptionTelnetPort(port), WithOptionTelnetMaxClients(maxclient),
+		WithOptionTelnetNetwork("tcp4"))
+	go func() {
+		if err := c.Start(); err != nil {
+			log.Errorf("Telnet console on port %d failed: %s", port, err)
+		}
+	}()
+	return c
+}
@@ -0,0 +1,499 @@
+package console_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+)
+
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	telnetOptEcho  = 1
+	telnetOptSGA   = 3
+	telnetOptTType = 24
+	telnetOptNAWS  = 31
+)
+
+// telnetFilter removes the telnet commands from the output of the server and
+// records them.
+type telnetFilter struct {
+	state    int
+	command  []byte
+	commands [][]byte
+}
+
+const (
+	filterData = iota
+	filterIAC
+	filterOption
+	filterSB
+	filterSBIAC
+)
+
+func (f *telnetFilter) filter(b []byte) []byte {
+	var data []byte
+	for _, c := range b {
+		switch f.state {
+		case filterData:
+			if c == telnetIAC {
+				f.state = filterIAC
+				f.command = []byte{c}
+				continue
+			}
+			data = append(data, c)
+		case filterIAC:
+			switch c {
+			case telnetIAC:
+				data = append(data, c)
+				f.state = filterData
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				f.command = append(f.command, c)
+				f.state = filterOption
+			case telnetSB:
+				f.command = append(f.command, c)
+				f.state = filterSB
+			default:
+				f.commands = append(f.commands, append(f.command, c))
+				f.state = filterData
+			}
+		case filterOption:
+			f.commands = append(f.commands, append(f.command, c))
+			f.state = filterData
+		case filterSB:
+			f.command = append(f.command, c)
+			if c == telnetIAC {
+				f.state = filterSBIAC
+			}
+		case filterSBIAC:
+			f.command = append(f.command, c)
+			if c == telnetSE {
+				f.commands = append(f.commands, f.command)
+				f.state = filterData
+			} else {
+				f.state = filterSB
+			}
+		}
+	}
+	return data
+}
+
+// startTelnet serves a telnet console on a random local port, setup is called
+// on each new console.
+func startTelnet(t *testing.T, setup func(c *console.Console), opts ...console.TelnetConsoleOption) (*console.TelnetConsole, string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := console.NewTelnetConsoleWithOptions(append(opts, console.WithOptionTelnetListener(listener))...)
+	if setup != nil {
+		server.AddCallbackOnNewConsole(setup)
+	}
+	serveInBackground(t, server.Start, server.Stop)
+	return server, listener.Addr().String()
+}
+
+// telnetClient is a testClient that records the telnet commands sent by the
+// server instead of showing them in the output.
+type telnetClient struct {
+	*testClient
+	f *telnetFilter
+}
+
+func dialTelnet(t *testing.T, addr string) *telnetClient {
+	t.Helper()
+
+	cl := &telnetClient{testClient: dialTestClient(t, "tcp", addr), f: &telnetFilter{}}
+	cl.mu.Lock()
+	cl.filter = cl.f.filter
+	cl.mu.Unlock()
+	return cl
+}
+
+// commands returns the telnet commands received so far.
+func (cl *telnetClient) commands() [][]byte {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	return append([][]byte(nil), cl.f.commands...)
+}
+
+// expectCommand waits for the telnet command cmd from the server.
+func (cl *telnetClient) expectCommand(cmd ...byte) {
+	cl.t.Helper()
+
+	waitFor(cl.t, fmt.Sprintf("telnet command %v", cmd), func() bool {
+		for _, got := range cl.commands() {
+			if bytes.Equal(got, cmd) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func TestTelnetNegotiation(t *testing.T) {
+	_, addr := startTelnet(t, nil)
+
+	cl := dialTelnet(t, addr)
+	cl.expectPrompt()
+
+	want := [][]byte{
+		{telnetIAC, telnetWILL, telnetOptEcho},
+		{telnetIAC, telnetWILL, telnetOptSGA},
+		{telnetIAC, telnetDO, telnetOptSGA},
+		{telnetIAC, telnetDO, telnetOptNAWS},
+		{telnetIAC, telnetDO, telnetOptTType},
+	}
+	got := cl.commands()
+	if len(got) < len(want) {
+		t.Fatalf("negotiation = %v, want %v", got, want)
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Errorf("negotiation[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestTelnetOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		send     []byte
+		reply    []byte
+		width    int
+		height   int
+		termType string
+	}{
+		{
+			name:   "window size",
+			send:   []byte{telnetIAC, telnetWILL, telnetOptNAWS, telnetIAC, telnetSB, telnetOptNAWS, 0, 120, 0, 40, telnetIAC, telnetSE},
+			width:  120,
+			height: 40,
+		},
+		{
+			name:   "window size with escaped IAC",
+			send:   []byte{telnetIAC, telnetSB, telnetOptNAWS, 0, 255, 255, 0, 50, telnetIAC, telnetSE},
+			width:  255,
+			height: 50,
+		},
+		{
+			name:     "terminal type",
+			send:     []byte{telnetIAC, telnetWILL, telnetOptTType},
+			reply:    []byte{telnetIAC, telnetSB, telnetOptTType, 1, telnetIAC, telnetSE},
+			termType: "xterm-256color",
+		},
+		{
+			name:  "unsupported local option",
+			send:  []byte{telnetIAC, telnetDO, 99},
+			reply: []byte{telnetIAC, telnetWONT, 99},
+		},
+		{
+			name:  "unsupported remote option",
+			send:  []byte{telnetIAC, telnetWILL, 99},
+			reply: []byte{telnetIAC, telnetDONT, 99},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := make(chan *console.Console, 1)
+			_, addr := startTelnet(t, func(c *console.Console) {
+				sessions <- c
+			})
+			cl := dialTelnet(t, addr)
+			session := <-sessions
+			cl.expectPrompt()
+
+			cl.send(string(tt.send))
+			if tt.reply != nil {
+				cl.expectCommand(tt.reply...)
+			}
+			if tt.termType != "" {
+				cl.send(string([]byte{telnetIAC, telnetSB, telnetOptTType, 0}) + tt.termType +
+					string([]byte{telnetIAC, telnetSE}))
+				waitFor(t, "terminal type", func() bool {
+					return session.GetTerminalType() == tt.termType
+				})
+			}
+			if tt.width != 0 {
+				waitFor(t, "window size", func() bool {
+					width, height := session.GetSize()
+					return width == tt.width && height == tt.height
+				})
+			}
+		})
+	}
+}
+
+func TestTelnetInput(t *testing.T) {
+	tests := []struct {
+		name string
+		send string
+		want string
+	}{
+		{"CR LF", "echo one\r\n", "one\n"},
+		{"CR NUL", "echo two\r\x00", "two\n"},
+		{"negotiation inside a line", "echo th\xff\xfb\x03ree\r\n", "three\n"},
+	}
+	_, addr := startTelnet(t, func(c *console.Console) {
+		c.AddConsoleCommand(echoCommand)
+	})
+	cl := dialTelnet(t, addr)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl.expectPrompt()
+			cl.send(tt.send)
+			cl.expect("\n")
+			if got := cl.wait("output", func(pending string) int {
+				return strings.Index(pending, "> ")
+			}); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// the line typed is echoed before the command runs, not when it returns
+func TestTelnetEchoBeforeCommand(t *testing.T) {
+	_, addr := startTelnet(t, func(c *console.Console) {
+		c.AddConsoleCommand(sleepCommand)
+	})
+	cl := dialTelnet(t, addr)
+	cl.expectPrompt()
+	cl.send("sleep 10s\r\n")
+	cl.expect("sleep 10s\n")
+}
+
+func TestTelnetStart(t *testing.T) {
+	busy, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	tests := []struct {
+		name    string
+		opts    []console.TelnetConsoleOption
+		wantErr bool
+	}{
+		{"port in use", []console.TelnetConsoleOption{console.WithOptionTelnetHost("127.0.0.1"),
+			console.WithOptionTelnetPort(busy.Addr().(*net.TCPAddr).Port)}, true},
+		{"bad host", []console.TelnetConsoleOption{console.WithOptionTelnetHost("no.such.host.invalid")}, true},
+		{"ipv4 loopback", []console.TelnetConsoleOption{console.WithOptionTelnetHost("127.0.0.1"),
+			console.WithOptionTelnetNetwork("tcp4")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := console.NewTelnetConsoleWithOptions(tt.opts...)
+			if server.Addr() != nil {
+				t.Fatal("listening before Start")
+			}
+			if tt.wantErr {
+				done := make(chan error, 1)
+				go func() { done <- server.Start() }()
+				select {
+				case err := <-done:
+					if err == nil {
+						t.Error("Start succeeded")
+					}
+				case <-time.After(testTimeout):
+					server.Stop()
+					t.Fatal("Start did not fail")
+				}
+				return
+			}
+
+			serveInBackground(t, server.Start, server.Stop)
+			waitFor(t, "listener", func() bool { return server.Addr() != nil })
+			addr := server.Addr().(*net.TCPAddr)
+			if !addr.IP.IsLoopback() || addr.Port == 0 {
+				t.Errorf("Addr = %s", addr)
+			}
+			dialTelnet(t, addr.String()).expectPrompt()
+		})
+	}
+}
+
+// TestTelnetConsoleSettings sets the console options of the sessions built by
+// the transport from its OnNewConsole callback.
+func TestTelnetConsoleSettings(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "script.txt")
+	if err := os.WriteFile(script, []byte("echo sourced\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	guestEcho := console.NewConsoleCommand("echo", echo, "print the arguments")
+	guestEcho.SetUserLevel(console.Guest)
+	guestAsk := console.NewConsoleCommand("ask", func(c *console.Console, command *console.ConsoleCommand, args []string) console.CommandError {
+		if _, err := c.Ask("Name?", ""); err != nil {
+			return console.CommandError(err.Error())
+		}
+		return console.N0_ERR
+	}, "ask a name")
+	guestAsk.SetUserLevel(console.Guest)
+
+	_, addr := startTelnet(t, func(c *console.Console) {
+		c.AddConsoleCommand(guestEcho)
+		c.AddConsoleCommand(guestAsk)
+		c.Authenticate("alice", console.Guest)
+		c.SetRedirectDirs(console.Guest, dir)
+		c.SetAliasStore(console.NewFileAliasStore(filepath.Join(dir, "aliases")))
+		c.SetSourceLevel(console.Guest)
+		c.SetInputTimeout(50 * time.Millisecond)
+	})
+	cl := dialTelnet(t, addr)
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"echo hello > out.txt", ""},
+		{"alias hi echo alias", ""},
+		{"hi", "alias\n"},
+		{"source " + script, "sourced\n"},
+	}
+	for _, tt := range tests {
+		if got := cl.run(tt.line); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	cl.expectPrompt()
+	cl.send("ask\r\n")
+	cl.expect("Name? ")
+	cl.expect(context.DeadlineExceeded.Error())
+
+	if data, err := os.ReadFile(filepath.Join(dir, "out.txt")); err != nil || string(data) != "hello\n" {
+		t.Errorf("out.txt = %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "aliases", "alice.aliases")); err != nil {
+		t.Error(err)
+	}
+}
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "too many open files" }
+func (temporaryError) Timeout() bool   { return false }
+func (temporaryError) Temporary() bool { return true }
+
+// flakyListener fails the first accepts with a temporary error.
+type flakyListener struct {
+	net.Listener
+	failures int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.failures > 0 {
+		l.failures--
+		return nil, temporaryError{}
+	}
+	return l.Listener.Accept()
+}
+
+func TestTelnetAcceptTemporaryError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := console.NewTelnetConsoleWithOptions(
+		console.WithOptionTelnetListener(&flakyListener{Listener: listener, failures: 3}))
+	serveInBackground(t, server.Start, server.Stop)
+
+	dialTelnet(t, listener.Addr().String()).expectPrompt()
+}
+
+func TestTelnetMaxClients(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		accepted int
+	}{
+		{"unlimited", console.UnlimitedClients, 4},
+		{"zero accepts one client", 0, 1},
+		{"one", 1, 1},
+		{"three", 3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, addr := startTelnet(t, nil, console.WithOptionTelnetMaxClients(tt.limit))
+
+			for i := 0; i < tt.accepted; i++ {
+				dialTelnet(t, addr).expectPrompt()
+			}
+			if got := server.GetClientsCount(); got != tt.accepted {
+				t.Errorf("GetClientsCount = %d, want %d", got, tt.accepted)
+			}
+			if tt.limit == console.UnlimitedClients {
+				return
+			}
+			cl := dialTelnet(t, addr)
+			if out := cl.expectClosed(); !strings.Contains(out, "Too many connections") {
+				t.Errorf("client over the limit got %q", out)
+			}
+		})
+	}
+}
+
+func TestTelnetReject(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []console.TelnetConsoleOption
+		wantOutput string
+		wantReason console.RejectReason
+	}{
+		{"default message", []console.TelnetConsoleOption{console.WithOptionTelnetMaxClients(1)},
+			"Too many connections, try again later\n", console.REJECT_MAX_CLIENTS},
+		{"custom message", []console.TelnetConsoleOption{console.WithOptionTelnetMaxClients(1),
+			console.WithOptionTelnetRejectMessage("busy\r\n")}, "busy\n", console.REJECT_MAX_CLIENTS},
+		{"silent", []console.TelnetConsoleOption{console.WithOptionTelnetMaxClients(1),
+			console.WithOptionTelnetRejectMessage("")}, "", console.REJECT_MAX_CLIENTS},
+		{"per ip", []console.TelnetConsoleOption{console.WithOptionTelnetMaxClientsPerIP(1)},
+			"Too many connections, try again later\n", console.REJECT_MAX_CLIENTS_PER_IP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, addr := startTelnet(t, nil, tt.opts...)
+			reasons := make(chan console.RejectReason, 1)
+			server.AddCallbackOnReject(func(remote net.Addr, reason console.RejectReason) {
+				reasons <- reason
+			})
+
+			first := dialTelnet(t, addr)
+			first.expectPrompt()
+
+			if out := dialTelnet(t, addr).expectClosed(); out != tt.wantOutput {
+				t.Errorf("rejected client got %q, want %q", out, tt.wantOutput)
+			}
+			select {
+			case reason := <-reasons:
+				if reason != tt.wantReason {
+					t.Errorf("reason = %q, want %q", reason, tt.wantReason)
+				}
+			case <-time.After(testTimeout):
+				t.Error("reject callback not called")
+			}
+
+			// the slot is released when the first client leaves
+			first.conn.Close()
+			waitFor(t, "slot release", func() bool { return server.GetClientsCount() == 0 })
+			dialTelnet(t, addr).expectPrompt()
+		})
+	}
+}
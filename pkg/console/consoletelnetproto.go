@@ -0,0 +1,322 @@
+package console
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"sync"
+)
+
+// telnet commands, RFC 854
+const (
+	telnetSE   byte = 240
+	telnetNOP  byte = 241
+	telnetAYT  byte = 246
+	telnetGA   byte = 249
+	telnetSB   byte = 250
+	telnetWILL byte = 251
+	telnetWONT byte = 252
+	telnetDO   byte = 253
+	telnetDONT byte = 254
+	telnetIAC  byte = 255
+)
+
+// telnet options
+const (
+	telnetOptEcho  byte = 1  // RFC 857
+	telnetOptSGA   byte = 3  // RFC 858
+	telnetOptTType byte = 24 // RFC 1091
+	telnetOptNAWS  byte = 31 // RFC 1073
+)
+
+// TERMINAL-TYPE subnegotiation commands
+const (
+	telnetTTypeIs   byte = 0
+	telnetTTypeSend byte = 1
+)
+
+const telnetMaxSubnegotiation = 256
+
+type telnetState int
+
+const (
+	telnetStateData telnetState = iota
+	telnetStateIAC
+	telnetStateOption
+	telnetStateSB
+	telnetStateSBIAC
+	telnetStateCR
+)
+
+type telnetOptionState int
+
+const (
+	telnetOptionOff telnetOptionState = iota
+	telnetOptionRequested
+	telnetOptionOn
+)
+
+type OnTelnetResize func(width, height int)
+type OnTelnetTerminalType func(termType string)
+
+// telnetProtocol sits between the socket and the console: it strips and answers
+// the IAC sequences coming from the client, escapes IAC bytes going out and
+// flushes the pending output before blocking on a read, so echo and prompts are
+// sent as soon as the terminal waits for input.
+type telnetProtocol struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+
+	state   telnetState
+	command byte
+	sb      []byte
+
+	local  map[byte]telnetOptionState
+	remote map[byte]telnetOptionState
+
+	onResize       OnTelnetResize
+	onTerminalType OnTelnetTerminalType
+}
+
+func newTelnetProtocol(conn net.Conn) *telnetProtocol {
+	return &telnetProtocol{
+		conn:   conn,
+		r:      bufio.NewReader(conn),
+		w:      bufio.NewWriter(conn),
+		local:  make(map[byte]telnetOptionState),
+		remote: make(map[byte]telnetOptionState),
+	}
+}
+
+func (t *telnetProtocol) supportsLocal(opt byte) bool {
+	return opt == telnetOptEcho || opt == telnetOptSGA
+}
+
+func (t *telnetProtocol) supportsRemote(opt byte) bool {
+	return opt == telnetOptSGA || opt == telnetOptNAWS || opt == telnetOptTType
+}
+
+// negotiate asks the client to let the server echo, to suppress go-ahead and to
+// report its window size and terminal type.
+func (t *telnetProtocol) negotiate() error {
+	for _, opt := range []byte{telnetOptEcho, telnetOptSGA} {
+		t.local[opt] = telnetOptionRequested
+		t.sendCommand(telnetWILL, opt)
+	}
+	for _, opt := range []byte{telnetOptSGA, telnetOptNAWS, telnetOptTType} {
+		t.remote[opt] = telnetOptionRequested
+		t.sendCommand(telnetDO, opt)
+	}
+	return t.Flush()
+}
+
+func (t *telnetProtocol) sendCommand(cmd byte, opt byte) {
+	t.writeRaw([]byte{telnetIAC, cmd, opt})
+}
+
+func (t *telnetProtocol) writeRaw(b []byte) {
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+
+	t.w.Write(b)
+}
+
+func (t *telnetProtocol) Write(b []byte) (int, error) {
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+
+	for _, c := range b {
+		if c == telnetIAC {
+			if err := t.w.WriteByte(telnetIAC); err != nil {
+				return 0, err
+			}
+		}
+		if err := t.w.WriteByte(c); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (t *telnetProtocol) Flush() error {
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+
+	return t.w.Flush()
+}
+
+func (t *telnetProtocol) Close() error {
+	return t.conn.Close()
+}
+
+func (t *telnetProtocol) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	n := 0
+	for n == 0 {
+		if t.r.Buffered() == 0 {
+			if err := t.Flush(); err != nil {
+				return 0, err
+			}
+		}
+		c, err := t.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		for {
+			if out, ok := t.parse(c); ok {
+				b[n] = out
+				n++
+			}
+			if n == len(b) || t.r.Buffered() == 0 {
+				break
+			}
+			c, _ = t.r.ReadByte()
+		}
+	}
+	return n, nil
+}
+
+// parse runs the protocol state machine, it returns the data byte to hand over
+// to the terminal, if any.
+func (t *telnetProtocol) parse(c byte) (byte, bool) {
+	switch t.state {
+	case telnetStateData:
+		if c == telnetIAC {
+			t.state = telnetStateIAC
+			return 0, false
+		}
+		if c == '\r' {
+			t.state = telnetStateCR
+		}
+		return c, true
+
+	case telnetStateCR:
+		// CR is sent as CR NUL or CR LF, the terminal only needs the CR
+		t.state = telnetStateData
+		if c == 0 || c == '\n' {
+			return 0, false
+		}
+		return t.parse(c)
+
+	case telnetStateIAC:
+		switch c {
+		case telnetIAC:
+			t.state = telnetStateData
+			return c, true
+		case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+			t.command = c
+			t.state = telnetStateOption
+		case telnetSB:
+			t.sb = t.sb[:0]
+			t.state = telnetStateSB
+		case telnetAYT:
+			t.writeRaw([]byte("\r\n[Yes]\r\n"))
+			t.state = telnetStateData
+		default:
+			// NOP, GA, DM, BRK and the editing commands are ignored
+			t.state = telnetStateData
+		}
+		return 0, false
+
+	case telnetStateOption:
+		t.handleOption(t.command, c)
+		t.state = telnetStateData
+		return 0, false
+
+	case telnetStateSB:
+		if c == telnetIAC {
+			t.state = telnetStateSBIAC
+		} else if len(t.sb) < telnetMaxSubnegotiation {
+			t.sb = append(t.sb, c)
+		}
+		return 0, false
+
+	case telnetStateSBIAC:
+		switch c {
+		case telnetSE:
+			t.handleSubnegotiation(t.sb)
+			t.state = telnetStateData
+		case telnetIAC:
+			if len(t.sb) < telnetMaxSubnegotiation {
+				t.sb = append(t.sb, c)
+			}
+			t.state = telnetStateSB
+		default:
+			// malformed subnegotiation, drop it
+			t.state = telnetStateData
+		}
+		return 0, false
+	}
+
+	return 0, false
+}
+
+// handleOption answers a WILL/WONT/DO/DONT, acknowledging only real state
+// changes so the two ends never loop.
+func (t *telnetProtocol) handleOption(cmd byte, opt byte) {
+	switch cmd {
+	case telnetDO:
+		if !t.supportsLocal(opt) {
+			t.sendCommand(telnetWONT, opt)
+		} else if t.local[opt] != telnetOptionOn {
+			if t.local[opt] == telnetOptionOff {
+				t.sendCommand(telnetWILL, opt)
+			}
+			t.local[opt] = telnetOptionOn
+		}
+	case telnetDONT:
+		if t.local[opt] == telnetOptionOn {
+			t.sendCommand(telnetWONT, opt)
+		}
+		t.local[opt] = telnetOptionOff
+	case telnetWILL:
+		if !t.supportsRemote(opt) {
+			t.sendCommand(telnetDONT, opt)
+			return
+		}
+		if t.remote[opt] == telnetOptionOn {
+			return
+		}
+		if t.remote[opt] == telnetOptionOff {
+			t.sendCommand(telnetDO, opt)
+		}
+		t.remote[opt] = telnetOptionOn
+		if opt == telnetOptTType {
+			t.writeRaw([]byte{telnetIAC, telnetSB, telnetOptTType, telnetTTypeSend, telnetIAC, telnetSE})
+		}
+	case telnetWONT:
+		if t.remote[opt] == telnetOptionOn {
+			t.sendCommand(telnetDONT, opt)
+		}
+		t.remote[opt] = telnetOptionOff
+	}
+}
+
+func (t *telnetProtocol) handleSubnegotiation(sb []byte) {
+	if len(sb) == 0 {
+		return
+	}
+	switch sb[0] {
+	case telnetOptNAWS:
+		if len(sb) != 5 {
+			return
+		}
+		width := int(binary.BigEndian.Uint16(sb[1:3]))
+		height := int(binary.BigEndian.Uint16(sb[3:5]))
+		if t.onResize != nil && width > 0 && height > 0 {
+			t.onResize(width, height)
+		}
+	case telnetOptTType:
+		if len(sb) < 2 || sb[1] != telnetTTypeIs {
+			return
+		}
+		if t.onTerminalType != nil {
+			t.onTerminalType(string(sb[2:]))
+		}
+	}
+}
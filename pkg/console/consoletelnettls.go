@@ -0,0 +1,154 @@
+package console
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+const defaultTLSHandshakeTimeout = 10 * time.Second
+
+// TLSIdentityMapper maps the certificate presented by the client to the user
+// of the console, returning an error rejects the connection.
+type TLSIdentityMapper func(cert *x509.Certificate) (username string, level User, err error)
+
+type TelnetTLSConsole struct {
+	*TelnetConsole
+	tlsConfig        *tls.Config
+	identityMapper   TLSIdentityMapper
+	handshakeTimeout time.Duration
+	clientCAFile     string
+	clientAuth       tls.ClientAuthType
+}
+
+type TelnetTLSOption func(console *TelnetTLSConsole)
+
+func WithOptionTLSMinVersion(version uint16) TelnetTLSOption {
+	return func(console *TelnetTLSConsole) {
+		console.tlsConfig.MinVersion = version
+	}
+}
+
+// WithOptionTLSClientCA enables mutual TLS, client certificates are verified
+// against the CAs in caFile. When required is false clients without a
+// certificate are accepted and fall back to the password login.
+func WithOptionTLSClientCA(caFile string, required bool) TelnetTLSOption {
+	return func(console *TelnetTLSConsole) {
+		console.clientCAFile = caFile
+		if required {
+			console.clientAuth = tls.RequireAndVerifyClientCert
+		} else {
+			console.clientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+}
+
+func WithOptionTLSIdentityMapper(mapper TLSIdentityMapper) TelnetTLSOption {
+	return func(console *TelnetTLSConsole) {
+		console.identityMapper = mapper
+	}
+}
+
+// WithOptionTLSUserLevels maps the common name of the client certificate to a
+// user level, certificates with an unknown common name are rejected.
+func WithOptionTLSUserLevels(levels map[string]User) TelnetTLSOption {
+	return func(console *TelnetTLSConsole) {
+		console.identityMapper = func(cert *x509.Certificate) (string, User, error) {
+			level, ok := levels[cert.Subject.CommonName]
+			if !ok {
+				return "", Guest, fmt.Errorf("unknown certificate subject %q", cert.Subject.CommonName)
+			}
+			return cert.Subject.CommonName, level, nil
+		}
+	}
+}
+
+// WithOptionTLSTelnetOptions applies the options of the underlying telnet
+// console, e.g. bind address and keepalive.
+func WithOptionTLSTelnetOptions(opts ...TelnetConsoleOption) TelnetTLSOption {
+	return func(console *TelnetTLSConsole) {
+		for _, opt := range opts {
+			opt(console.TelnetConsole)
+		}
+	}
+}
+
+func WithOptionTLSHandshakeTimeout(timeout time.Duration) TelnetTLSOption {
+	return func(console *TelnetTLSConsole) {
+		console.handshakeTimeout = timeout
+	}
+}
+
+func defaultTLSIdentityMapper(cert *x509.Certificate) (string, User, error) {
+	return cert.Subject.CommonName, Guest, nil
+}
+
+// NewTelnetTLSConsole creates a telnet console over TLS, it starts serving only
+// when Start is called.
+func NewTelnetTLSConsole(port int, maxclient int, certFile string, keyFile string, opts ...TelnetTLSOption) (*TelnetTLSConsole, error) {
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &TelnetTLSConsole{
+		TelnetConsole:    newTelnetConsole(WithOptionTelnetPort(port), WithOptionTelnetMaxClients(maxclient)),
+		tlsConfig:        &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12},
+		identityMapper:   defaultTLSIdentityMapper,
+		handshakeTimeout: defaultTLSHandshakeTimeout,
+		clientAuth:       tls.NoClientCert,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.clientCAFile != "" {
+		caBytes, err := os.ReadFile(c.clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, fmt.Errorf("no certificate found in %s", c.clientCAFile)
+		}
+		c.tlsConfig.ClientCAs = pool
+	}
+	c.tlsConfig.ClientAuth = c.clientAuth
+
+	c.wrapListener = func(l net.Listener) net.Listener {
+		return tls.NewListener(l, c.tlsConfig)
+	}
+	c.authenticator = c.authenticate
+
+	return c, nil
+}
+
+// authenticate completes the handshake and maps the verified client
+// certificate, if any, to the console user.
+func (c *TelnetTLSConsole) authenticate(conn net.Conn) (string, User, error) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return "", Guest, errors.New("not a tls connection")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.handshakeTimeout)
+	defer cancel()
+
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return "", Guest, err
+	}
+
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return "", Guest, nil
+	}
+
+	return c.identityMapper(state.PeerCertificates[0])
+}
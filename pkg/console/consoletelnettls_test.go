@@ -0,0 +1,247 @@
+package console_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+)
+
+// testCA issues the certificates of the tls tests.
+type testCA struct {
+	t    *testing.T
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	file string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	ca := &testCA{t: t}
+	ca.cert, ca.key = ca.issue(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test ca"},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	})
+	ca.pool = x509.NewCertPool()
+	ca.pool.AddCert(ca.cert)
+	ca.file = filepath.Join(t.TempDir(), "ca.pem")
+	writePEM(t, ca.file, "CERTIFICATE", ca.cert.Raw)
+	return ca
+}
+
+// issue signs template with the ca, or self-signs it when the ca has no
+// certificate yet.
+func (ca *testCA) issue(template *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey) {
+	ca.t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	parent, signer := template, key
+	if ca.cert != nil {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	return cert, key
+}
+
+// serverFiles writes a certificate for 127.0.0.1 and its key.
+func (ca *testCA) serverFiles() (certFile string, keyFile string) {
+	ca.t.Helper()
+
+	cert, key := ca.issue(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	dir := ca.t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+	writePEM(ca.t, certFile, "CERTIFICATE", cert.Raw)
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		ca.t.Fatal(err)
+	}
+	writePEM(ca.t, keyFile, "EC PRIVATE KEY", der)
+	return certFile, keyFile
+}
+
+func (ca *testCA) clientCertificate(commonName string) tls.Certificate {
+	ca.t.Helper()
+
+	cert, key := ca.issue(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	return tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key, Leaf: cert}
+}
+
+func writePEM(t *testing.T, path string, blockType string, der []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTelnetTLS(t *testing.T) {
+	tests := []struct {
+		name       string
+		required   bool
+		clientCert string
+		levels     map[string]console.User
+		rejected   bool
+		wantUser   string
+		wantLevel  console.User
+	}{
+		{name: "no client certificate, password login"},
+		{name: "optional certificate", clientCert: "admin", levels: map[string]console.User{"admin": console.Root},
+			wantUser: "admin", wantLevel: console.Root},
+		{name: "certificate not mapped", clientCert: "guest", levels: map[string]console.User{"admin": console.Root},
+			rejected: true},
+		{name: "required certificate missing", required: true, rejected: true},
+		{name: "required certificate", required: true, clientCert: "operator",
+			wantUser: "operator", wantLevel: console.Guest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ca := newTestCA(t)
+			certFile, keyFile := ca.serverFiles()
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := []console.TelnetTLSOption{
+				console.WithOptionTLSClientCA(ca.file, tt.required),
+				console.WithOptionTLSTelnetOptions(console.WithOptionTelnetListener(listener),
+					console.WithOptionTelnetKeepAlive(time.Minute)),
+			}
+			if tt.levels != nil {
+				opts = append(opts, console.WithOptionTLSUserLevels(tt.levels))
+			}
+			server, err := console.NewTelnetTLSConsole(0, console.UnlimitedClients, certFile, keyFile, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sessions := make(chan *console.Console, 1)
+			server.AddCallbackOnNewConsole(func(c *console.Console) {
+				c.EnableLogin("secret")
+				sessions <- c
+			})
+			serveInBackground(t, server.Start, server.Stop)
+
+			config := &tls.Config{RootCAs: ca.pool, ServerName: "127.0.0.1"}
+			if tt.clientCert != "" {
+				config.Certificates = []tls.Certificate{ca.clientCertificate(tt.clientCert)}
+			}
+			conn, err := tls.Dial("tcp", listener.Addr().String(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cl := &telnetClient{testClient: newTestClient(t, conn), f: &telnetFilter{}}
+			cl.mu.Lock()
+			cl.filter = cl.f.filter
+			cl.mu.Unlock()
+
+			if tt.rejected {
+				if out := cl.expectClosed(); out != "" {
+					t.Errorf("rejected connection got %q", out)
+				}
+				return
+			}
+			session := <-sessions
+			if tt.wantUser == "" {
+				cl.expect("Password?")
+				return
+			}
+			cl.expectPrompt()
+			if session.GetUsername() != tt.wantUser || session.GetUserLevel() != tt.wantLevel {
+				t.Errorf("user = %s/%s, want %s/%s", session.GetUsername(), session.GetUserLevel(),
+					tt.wantUser, tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestTelnetTLSRejectSilentClient(t *testing.T) {
+	ca := newTestCA(t)
+	certFile, keyFile := ca.serverFiles()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := console.NewTelnetTLSConsole(0, 1, certFile, keyFile,
+		console.WithOptionTLSTelnetOptions(console.WithOptionTelnetListener(listener)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rejected := make(chan struct{}, 2)
+	server.AddCallbackOnReject(func(remote net.Addr, reason console.RejectReason) {
+		rejected <- struct{}{}
+	})
+	serveInBackground(t, server.Start, server.Stop)
+
+	config := &tls.Config{RootCAs: ca.pool, ServerName: "127.0.0.1"}
+	first, err := tls.Dial("tcp", listener.Addr().String(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newTestClient(t, first).expectPrompt()
+
+	// a client saying nothing, its rejection waits for the handshake
+	silent, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	// the next client is rejected right away
+	start := time.Now()
+	conn, err := tls.Dial("tcp", listener.Addr().String(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := newTestClient(t, conn).expectClosed(); out != "Too many connections, try again later\n" {
+		t.Errorf("rejected client got %q", out)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("rejection took %s", elapsed)
+	}
+
+	// the silent client is dropped once the deadline expires
+	for i := 0; i < 2; i++ {
+		select {
+		case <-rejected:
+		case <-time.After(testTimeout):
+			t.Fatal("reject callback not called")
+		}
+	}
+}
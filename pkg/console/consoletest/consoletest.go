@@ -0,0 +1,246 @@
+// Package consoletest runs console sessions in memory to unit test the
+// command handlers, without opening a telnet port:
+//
+//	s := consoletest.NewSession(t, func(c *console.Console) {
+//		c.AddConsoleCommand(myCommand)
+//	})
+//	s.Login("secret")
+//	out := s.Run("mycommand arg")
+//	s.AssertGolden("testdata/mycommand.golden")
+package consoletest
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+)
+
+// DefaultTimeout is how long the Expect functions wait for the output.
+var DefaultTimeout = 2 * time.Second
+
+// UpdateGoldenEnv is the environment variable that makes AssertGolden rewrite
+// the golden files instead of comparing them.
+const UpdateGoldenEnv = "CONSOLETEST_UPDATE"
+
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// DefaultPrompt matches the default prompt of the consoles, with the suffix
+// of the active command context if any.
+var DefaultPrompt = regexp.MustCompile(`(?m)^(\([^\n)]*\))?> `)
+
+// Normalize removes the carriage returns and the ANSI escape sequences, so
+// that the transcripts compare as plain text.
+func Normalize(s string) string {
+	s = ansiEscape.ReplaceAllString(s, "")
+	return strings.ReplaceAll(s, "\r", "")
+}
+
+// Session is a console started on a Pipe. The Expect functions consume the
+// output: each one searches from where the previous match ended.
+type Session struct {
+	Console *console.Console
+	Pipe    *Pipe
+	Timeout time.Duration
+	// Prompt matches the prompt at the beginning of a line, it must be set
+	// for the consoles with a custom prompt template.
+	Prompt *regexp.Regexp
+	tb     testing.TB
+	pos    int
+}
+
+// NewSession creates and starts a console, setup is called before the start to
+// add the commands, enable the login and so on. The console is stopped when
+// the test ends.
+func NewSession(tb testing.TB, setup func(c *console.Console), opts ...console.ConsoleOption) *Session {
+	tb.Helper()
+
+	pipe := NewPipe()
+	c := console.NewConsole(pipe.IO(), opts...)
+	if setup != nil {
+		setup(c)
+	}
+
+	s := &Session{Console: c, Pipe: pipe, Timeout: DefaultTimeout, Prompt: DefaultPrompt, tb: tb}
+	tb.Cleanup(s.Close)
+	c.Start()
+	return s
+}
+
+// Close stops the console and waits for its task to exit.
+func (s *Session) Close() {
+	s.Console.Stop()
+	select {
+	case <-s.Console.Done():
+	case <-time.After(s.Timeout):
+		s.tb.Errorf("console %s did not stop", s.Console.GetUUID())
+	}
+}
+
+// Send types line followed by enter.
+func (s *Session) Send(line string) {
+	s.tb.Helper()
+	s.SendRaw(line + "\r")
+}
+
+// SendRaw types data as is, e.g. control characters or escape sequences.
+func (s *Session) SendRaw(data string) {
+	s.tb.Helper()
+	if err := s.Pipe.Input(data); err != nil {
+		s.tb.Fatalf("send %q: %s", data, err)
+	}
+}
+
+// Transcript returns the whole normalized output of the session.
+func (s *Session) Transcript() string {
+	out, _, _ := s.Pipe.Output()
+	return Normalize(out)
+}
+
+// wait returns the normalized output not consumed yet once match finds
+// something in it, match returns the end of what it matched.
+func (s *Session) wait(what string, match func(pending string) int) string {
+	s.tb.Helper()
+
+	deadline := time.NewTimer(s.Timeout)
+	defer deadline.Stop()
+
+	for {
+		out, changed, closed := s.Pipe.Output()
+		pending := Normalize(out)[s.pos:]
+		if end := match(pending); end >= 0 {
+			s.pos += end
+			return pending[:end]
+		}
+		if closed {
+			s.tb.Fatalf("console closed while waiting for %s, pending output:\n%s", what, pending)
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			s.tb.Fatalf("timeout waiting for %s, pending output:\n%s", what, pending)
+		}
+	}
+}
+
+// Expect waits for substr in the output and returns the output up to the end
+// of it.
+func (s *Session) Expect(substr string) string {
+	s.tb.Helper()
+
+	return s.wait(strings.TrimSpace(substr), func(pending string) int {
+		if idx := strings.Index(pending, substr); idx >= 0 {
+			return idx + len(substr)
+		}
+		return -1
+	})
+}
+
+// ExpectRegexp waits for a match of expr in the output and returns the
+// submatches.
+func (s *Session) ExpectRegexp(expr string) []string {
+	s.tb.Helper()
+
+	re := regexp.MustCompile(expr)
+	var submatches []string
+	s.wait("/"+expr+"/", func(pending string) int {
+		loc := re.FindStringSubmatchIndex(pending)
+		if loc == nil {
+			return -1
+		}
+		submatches = nil
+		for i := 0; i < len(loc); i += 2 {
+			if loc[i] < 0 {
+				submatches = append(submatches, "")
+				continue
+			}
+			submatches = append(submatches, pending[loc[i]:loc[i+1]])
+		}
+		return loc[1]
+	})
+	return submatches
+}
+
+// ExpectPrompt waits for the prompt at the beginning of a line.
+func (s *Session) ExpectPrompt() {
+	s.tb.Helper()
+
+	s.wait("prompt", func(pending string) int {
+		if loc := s.Prompt.FindStringIndex(pending); loc != nil {
+			return loc[1]
+		}
+		return -1
+	})
+}
+
+// ExpectError waits for the message of err, as printed after a failed command.
+func (s *Session) ExpectError(err console.CommandError) {
+	s.tb.Helper()
+	s.Expect(string(err) + "\n")
+}
+
+// Login answers the password request of a console with the login enabled.
+func (s *Session) Login(password string) {
+	s.tb.Helper()
+
+	s.Expect("Password?")
+	s.Send(password)
+	s.Expect("Authenticated\n")
+}
+
+// Run sends a command line after the prompt and returns its output, up to the
+// next prompt.
+func (s *Session) Run(line string) string {
+	s.tb.Helper()
+
+	s.ExpectPrompt()
+	s.Send(line)
+	s.Expect(line + "\n")
+
+	var output string
+	s.wait("prompt after "+line, func(pending string) int {
+		loc := s.Prompt.FindStringIndex(pending)
+		if loc == nil {
+			return -1
+		}
+		output = pending[:loc[0]]
+		// the prompt is left for the next Run
+		return loc[0]
+	})
+	return output
+}
+
+// AssertGolden compares the transcript of the session with the golden file
+// at path, setting CONSOLETEST_UPDATE=1 writes the file instead.
+func (s *Session) AssertGolden(path string) {
+	s.tb.Helper()
+	AssertGolden(s.tb, path, s.Transcript())
+}
+
+// AssertGolden compares got with the content of the golden file at path,
+// setting CONSOLETEST_UPDATE=1 writes the file instead.
+func AssertGolden(tb testing.TB, path string, got string) {
+	tb.Helper()
+
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			tb.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		tb.Fatalf("golden file: %s (run with %s=1 to create it)", err, UpdateGoldenEnv)
+	}
+	if string(want) != got {
+		tb.Errorf("transcript differs from %s\n--- want\n%s\n--- got\n%s", path, want, got)
+	}
+}
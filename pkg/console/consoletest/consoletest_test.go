@@ -0,0 +1,156 @@
+package consoletest_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"github.com/freedreamer82/go-console/pkg/console/consoletest"
+)
+
+func echo(c *console.Console) {
+	c.AddConsoleCommand(console.NewConsoleCommand("echo", func(c *console.Console, command *console.ConsoleCommand, args []string) console.CommandError {
+		for _, arg := range args {
+			c.Print(arg)
+		}
+		return console.N0_ERR
+	}, "print the arguments"))
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{"line\r\n", "line\n"},
+		{"\x1b[31mred\x1b[0m", "red"},
+		{"\x1b[2K\rcleared", "cleared"},
+		{"\x1b[?25lhidden\x1b[?25h", "hidden"},
+	}
+	for _, tt := range tests {
+		if got := consoletest.Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultPrompt(t *testing.T) {
+	tests := []struct {
+		in    string
+		match bool
+	}{
+		{"> ", true},
+		{"output\n> ", true},
+		{"(config)> ", true},
+		{"(config-if)> ", true},
+		{"a > b", false},
+		{"(open> ", false},
+	}
+	for _, tt := range tests {
+		if got := consoletest.DefaultPrompt.MatchString(tt.in); got != tt.match {
+			t.Errorf("DefaultPrompt.MatchString(%q) = %v, want %v", tt.in, got, tt.match)
+		}
+	}
+}
+
+func TestSessionRun(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"echo", ""},
+		{"echo one", "one\n"},
+		{"echo one two", "one\ntwo\n"},
+	}
+	s := consoletest.NewSession(t, echo)
+	for _, tt := range tests {
+		if got := s.Run(tt.line); got != tt.want {
+			t.Errorf("Run(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestSessionExpectError(t *testing.T) {
+	s := consoletest.NewSession(t, nil)
+	s.ExpectPrompt()
+	s.Send("nosuchcommand")
+	s.ExpectError(console.CMD_NOT_FOUND)
+}
+
+func TestSessionLogin(t *testing.T) {
+	s := consoletest.NewSession(t, func(c *console.Console) {
+		echo(c)
+		c.EnableLogin("secret")
+	})
+	s.Login("secret")
+	if got := s.Run("echo logged"); got != "logged\n" {
+		t.Errorf("Run after login = %q", got)
+	}
+	if !s.Console.IsUserLogged() {
+		t.Error("user not logged after Login")
+	}
+}
+
+func TestSessionExpectRegexp(t *testing.T) {
+	s := consoletest.NewSession(t, echo)
+	s.ExpectPrompt()
+	s.Send("echo id-42")
+	got := s.ExpectRegexp(`id-(\d+)`)
+	if len(got) != 2 || got[1] != "42" {
+		t.Errorf("ExpectRegexp submatches = %q", got)
+	}
+}
+
+func TestSessionClose(t *testing.T) {
+	s := consoletest.NewSession(t, nil)
+	s.ExpectPrompt()
+	s.Close()
+	if _, _, closed := s.Pipe.Output(); !closed {
+		t.Error("pipe still open after Close")
+	}
+}
+
+func TestAssertGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "echo.golden")
+
+	t.Setenv(consoletest.UpdateGoldenEnv, "1")
+	consoletest.AssertGolden(t, path, "transcript\n")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "transcript\n" {
+		t.Errorf("golden file = %q", data)
+	}
+
+	t.Setenv(consoletest.UpdateGoldenEnv, "")
+	consoletest.AssertGolden(t, path, "transcript\n")
+}
+
+func TestPipe(t *testing.T) {
+	p := consoletest.NewPipe()
+	if err := p.Input("typed"); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	n, err := p.Read(buf)
+	if err != nil || string(buf[:n]) != "typed" {
+		t.Errorf("Read = %q, %v", buf[:n], err)
+	}
+
+	p.Write([]byte("written"))
+	out, _, closed := p.Output()
+	if out != "written" || closed {
+		t.Errorf("Output = %q, closed %v", out, closed)
+	}
+
+	p.Close()
+	if _, err := p.Read(buf); err == nil {
+		t.Error("Read after Close succeeded")
+	}
+	if err := p.Input("late"); err == nil {
+		t.Error("Input after Close succeeded")
+	}
+}
@@ -0,0 +1,92 @@
+package consoletest
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+)
+
+// Pipe is an in-memory transport for a console: what the test sends is read by
+// the console, what the console writes is kept in a transcript.
+type Pipe struct {
+	mu      sync.Mutex
+	in      bytes.Buffer
+	inReady *sync.Cond
+	out     bytes.Buffer
+	changed chan struct{}
+	closed  bool
+}
+
+func NewPipe() *Pipe {
+	p := &Pipe{changed: make(chan struct{})}
+	p.inReady = sync.NewCond(&p.mu)
+	return p
+}
+
+// IO returns the transport to pass to console.NewConsole.
+func (p *Pipe) IO() console.ConsoleI {
+	return console.ConsoleI{ReadCloser: p, Writer: p}
+}
+
+func (p *Pipe) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for p.in.Len() == 0 && !p.closed {
+		p.inReady.Wait()
+	}
+	if p.closed {
+		return 0, io.EOF
+	}
+	return p.in.Read(b)
+}
+
+func (p *Pipe) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n, err := p.out.Write(b)
+	p.notify()
+	return n, err
+}
+
+func (p *Pipe) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.closed {
+		p.closed = true
+		p.notify()
+		p.inReady.Broadcast()
+	}
+	return nil
+}
+
+// notify wakes up the waiters of the output, called with the lock held.
+func (p *Pipe) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// Input queues data for the console as if it were typed.
+func (p *Pipe) Input(data string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return io.ErrClosedPipe
+	}
+	p.in.WriteString(data)
+	p.inReady.Broadcast()
+	return nil
+}
+
+// Output returns the raw transcript and a channel closed on the next write.
+func (p *Pipe) Output() (string, <-chan struct{}, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.out.String(), p.changed, p.closed
+}
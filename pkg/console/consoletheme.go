@@ -0,0 +1,154 @@
+package console
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiCyan    = "\x1b[36m"
+	ansiBoldRed = "\x1b[1;31m"
+)
+
+// Theme holds the ANSI SGR sequences used to color the console output, an
+// empty style leaves the text plain.
+type Theme struct {
+	Prompt  string
+	Error   string
+	Warning string
+	Success string
+	Heading string
+	Notice  string
+}
+
+var DefaultTheme = Theme{
+	Prompt:  ansiBold + ansiGreen,
+	Error:   ansiBoldRed,
+	Warning: ansiYellow,
+	Success: ansiGreen,
+	Heading: ansiBold + ansiCyan,
+	Notice:  ansiCyan,
+}
+
+type colorMode int
+
+const (
+	colorOff colorMode = iota
+	colorAuto
+	colorOn
+)
+
+func WithOptionTheme(theme Theme) ConsoleOption {
+	return func(console *Console) {
+		console.theme = theme
+	}
+}
+
+// WithOptionColor enables the colors, they are off by default. Once enabled
+// they are still left out on the dumb terminals and on the sessions read by a
+// program, see WithOptionInteractive.
+func WithOptionColor(enabled bool) ConsoleOption {
+	return func(console *Console) {
+		console.colorMode = colorOff
+		if enabled {
+			console.colorMode = colorAuto
+		}
+	}
+}
+
+func (c *Console) SetTheme(theme Theme) {
+	c.mu.Lock()
+	c.theme = theme
+	c.mu.Unlock()
+
+	c.updatePrompt()
+}
+
+// SetColor enables or disables the colors as WithOptionColor.
+func (c *Console) SetColor(enabled bool) {
+	mode := colorOff
+	if enabled {
+		mode = colorAuto
+	}
+	c.setColorMode(mode)
+}
+
+func (c *Console) setColorMode(mode colorMode) {
+	c.mu.Lock()
+	c.colorMode = mode
+	c.mu.Unlock()
+
+	c.updatePrompt()
+}
+
+// IsColorEnabled tells if the session gets colors.
+func (c *Console) IsColorEnabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.colorEnabled()
+}
+
+// colorEnabled is called with the lock held.
+func (c *Console) colorEnabled() bool {
+	switch c.colorMode {
+	case colorOn:
+		return true
+	case colorOff:
+		return false
+	}
+	return !c.nonInteractive && !strings.EqualFold(c.termType, "dumb")
+}
+
+// styled wraps text in style when the colors are enabled and the output is
+// going to the terminal, captured output (pipes, redirections) stays plain.
+func (c *Console) styled(style func(t Theme) string, text string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := style(c.theme)
+	if s == "" || !c.colorEnabled() || len(c.captures) > 0 {
+		return text
+	}
+	return s + text + ansiReset
+}
+
+func (c *Console) PrintError(a ...interface{}) (n int, err error) {
+	return c.Print(c.styled(func(t Theme) string { return t.Error }, fmt.Sprint(a...)))
+}
+
+func (c *Console) PrintWarning(a ...interface{}) (n int, err error) {
+	return c.Print(c.styled(func(t Theme) string { return t.Warning }, fmt.Sprint(a...)))
+}
+
+func (c *Console) PrintSuccess(a ...interface{}) (n int, err error) {
+	return c.Print(c.styled(func(t Theme) string { return t.Success }, fmt.Sprint(a...)))
+}
+
+func (c *Console) PrintHeading(a ...interface{}) (n int, err error) {
+	return c.Print(c.styled(func(t Theme) string { return t.Heading }, fmt.Sprint(a...)))
+}
+
+func (c *Console) cmdColor(console *Console, command *ConsoleCommand, args []string) CommandError {
+	switch {
+	case len(args) == 0:
+		if c.IsColorEnabled() {
+			c.Print("color on")
+		} else {
+			c.Print("color off")
+		}
+	case len(args) == 1 && args[0] == "on":
+		// asked by the user, even on a terminal that looks dumb
+		c.setColorMode(colorOn)
+	case len(args) == 1 && args[0] == "off":
+		c.setColorMode(colorOff)
+	default:
+		return BAD_FORMAT
+	}
+	return N0_ERR
+}
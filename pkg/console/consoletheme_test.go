@@ -0,0 +1,155 @@
+package console_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"github.com/freedreamer82/go-console/pkg/console/consoletest"
+)
+
+// styledCommand prints its arguments with every style of the theme.
+var styledCommand = console.NewConsoleCommand("styled", func(c *console.Console, command *console.ConsoleCommand, args []string) console.CommandError {
+	text := strings.Join(args, " ")
+	c.PrintError(text)
+	c.PrintWarning(text)
+	c.PrintSuccess(text)
+	c.PrintHeading(text)
+	return console.N0_ERR
+}, "print the arguments in every style")
+
+func TestColorEnabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []console.ConsoleOption
+		termType string
+		lines    []string
+		want     bool
+	}{
+		{name: "off by default", want: false},
+		{name: "enabled", opts: []console.ConsoleOption{console.WithOptionColor(true)}, want: true},
+		{name: "disabled", opts: []console.ConsoleOption{console.WithOptionColor(true), console.WithOptionColor(false)}, want: false},
+		{name: "non interactive", opts: []console.ConsoleOption{console.WithOptionColor(true), console.WithOptionInteractive(false)},
+			want: false},
+		{name: "dumb terminal", opts: []console.ConsoleOption{console.WithOptionColor(true)}, termType: "dumb", want: false},
+		{name: "dumb is case insensitive", opts: []console.ConsoleOption{console.WithOptionColor(true)}, termType: "DUMB", want: false},
+		{name: "other terminal", opts: []console.ConsoleOption{console.WithOptionColor(true)}, termType: "xterm", want: true},
+		{name: "color on", lines: []string{"color on"}, want: true},
+		{name: "color on a dumb terminal", opts: []console.ConsoleOption{console.WithOptionColor(true)}, termType: "dumb",
+			lines: []string{"color on"}, want: true},
+		{name: "color on non interactive", opts: []console.ConsoleOption{console.WithOptionInteractive(false)},
+			lines: []string{"color on"}, want: true},
+		{name: "color off", opts: []console.ConsoleOption{console.WithOptionColor(true)}, lines: []string{"color off"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := console.NewConsole(consoletest.NewPipe().IO(), tt.opts...)
+			if tt.termType != "" {
+				c.SetTerminalType(tt.termType)
+			}
+			for _, line := range tt.lines {
+				if err := c.Exec(line); err != console.N0_ERR {
+					t.Fatalf("%s: %s", line, err)
+				}
+			}
+			if got := c.IsColorEnabled(); got != tt.want {
+				t.Errorf("IsColorEnabled = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColorBuiltin(t *testing.T) {
+	s := consoletest.NewSession(t, nil)
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"color", "color off\n"},
+		{"color on", ""},
+		{"color", "color on\n"},
+		{"color off", ""},
+		{"color", "color off\n"},
+		{"color blue", string(console.BAD_FORMAT) + "\n"},
+		{"color on off", string(console.BAD_FORMAT) + "\n"},
+	}
+	for _, tt := range tests {
+		if got := s.Run(tt.line); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestStyledOutput(t *testing.T) {
+	custom := console.Theme{Error: "\x1b[35m", Heading: "\x1b[4m"}
+
+	tests := []struct {
+		name string
+		opts []console.ConsoleOption
+		line string
+		want string
+	}{
+		{name: "plain by default", line: "styled x", want: "x\nx\nx\nx\n"},
+		{name: "default theme", opts: []console.ConsoleOption{console.WithOptionColor(true)}, line: "styled x",
+			want: "\x1b[1;31mx\x1b[0m\n\x1b[33mx\x1b[0m\n\x1b[32mx\x1b[0m\n\x1b[1m\x1b[36mx\x1b[0m\n"},
+		{name: "custom theme", opts: []console.ConsoleOption{console.WithOptionColor(true), console.WithOptionTheme(custom)},
+			line: "styled x", want: "\x1b[35mx\x1b[0m\nx\nx\n\x1b[4mx\x1b[0m\n"},
+		{name: "non interactive", opts: []console.ConsoleOption{console.WithOptionColor(true), console.WithOptionInteractive(false)},
+			line: "styled x", want: "x\nx\nx\nx\n"},
+		{name: "pipes stay plain", opts: []console.ConsoleOption{console.WithOptionColor(true)}, line: "styled x | head -n 2",
+			want: "x\nx\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipe := consoletest.NewPipe()
+			c := console.NewConsole(pipe.IO(), tt.opts...)
+			c.AddConsoleCommand(styledCommand)
+
+			if err := c.Exec(tt.line); err != console.N0_ERR {
+				t.Fatalf("%s: %s", tt.line, err)
+			}
+			if got, _, _ := pipe.Output(); strings.ReplaceAll(got, "\r", "") != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColorRedirect(t *testing.T) {
+	c := console.NewConsole(consoletest.NewPipe().IO(), console.WithOptionColor(true))
+	c.AddConsoleCommand(styledCommand)
+
+	if err := c.Exec("styled x > @out"); err != console.N0_ERR {
+		t.Fatal(err)
+	}
+	if text, _ := c.GetBuffer("out"); text != "x\nx\nx\nx\n" {
+		t.Errorf("buffer = %q", text)
+	}
+}
+
+func TestColoredSession(t *testing.T) {
+	s := consoletest.NewSession(t, nil, console.WithOptionColor(true))
+	s.Run("nosuch")
+	s.Run("help")
+
+	transcript, _, _ := s.Pipe.Output()
+	for _, want := range []string{
+		"\x1b[1m\x1b[32m>\x1b[0m ",
+		"\x1b[1;31m" + string(console.CMD_NOT_FOUND) + "\x1b[0m",
+		"\x1b[1m\x1b[36m######",
+	} {
+		if !strings.Contains(transcript, want) {
+			t.Errorf("transcript %q does not contain %q", transcript, want)
+		}
+	}
+
+	// the prompt goes back to plain once the colors are off
+	s.Run("color off")
+	s.Run("nosuch")
+	transcript, _, _ = s.Pipe.Output()
+	last := transcript[strings.LastIndex(transcript, "color off"):]
+	if strings.Contains(last, "\x1b[1;31m") || strings.Contains(last, "\x1b[32m") {
+		t.Errorf("colors after color off: %q", last)
+	}
+}
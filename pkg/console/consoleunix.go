@@ -0,0 +1,361 @@
+package console
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultUnixSocketFileMode os.FileMode = 0660
+
+var errPeerCredentialsUnsupported = errors.New("peer credentials not supported on this platform")
+
+// PeerCredentials identifies the process on the other side of a unix socket.
+type PeerCredentials struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+// UnixCredentialsMapper maps the credentials of the connecting process to the
+// user of the console, returning an error rejects the connection.
+type UnixCredentialsMapper func(cred PeerCredentials) (username string, level User, err error)
+
+type UnixSessionMode int
+
+const (
+	// UnixSessionInteractive runs a console session until the client leaves.
+	UnixSessionInteractive UnixSessionMode = iota
+	// UnixSessionOneShot reads a single command line, writes its output and
+	// closes the connection.
+	UnixSessionOneShot
+)
+
+type UnixSocketConsole struct {
+	*listenerServer
+	mu                   *sync.RWMutex
+	consoles             []*Console
+	path                 string
+	fileMode             os.FileMode
+	uid                  int
+	gid                  int
+	mode                 UnixSessionMode
+	credentialsMapper    UnixCredentialsMapper
+	callbackOnNewConsole OnNewConsole
+	timeout              time.Duration
+	shutdownNotice       string
+	prompt               string
+}
+
+type UnixSocketConsoleOption func(console *UnixSocketConsole)
+
+func WithOptionUnixSocketFileMode(mode os.FileMode) UnixSocketConsoleOption {
+	return func(console *UnixSocketConsole) {
+		console.fileMode = mode
+	}
+}
+
+// WithOptionUnixSocketOwner changes the owner of the socket file, -1 leaves
+// the uid or gid unchanged.
+func WithOptionUnixSocketOwner(uid int, gid int) UnixSocketConsoleOption {
+	return func(console *UnixSocketConsole) {
+		console.uid = uid
+		console.gid = gid
+	}
+}
+
+func WithOptionUnixSocketSessionMode(mode UnixSessionMode) UnixSocketConsoleOption {
+	return func(console *UnixSocketConsole) {
+		console.mode = mode
+	}
+}
+
+func WithOptionUnixSocketMaxClients(maxclient int) UnixSocketConsoleOption {
+	return func(console *UnixSocketConsole) {
+		console.maxclient = maxclient
+	}
+}
+
+func WithOptionUnixSocketCredentialsMapper(mapper UnixCredentialsMapper) UnixSocketConsoleOption {
+	return func(console *UnixSocketConsole) {
+		console.credentialsMapper = mapper
+	}
+}
+
+// WithOptionUnixSocketUserLevels maps the UID of the connecting process to a
+// user level, unknown UIDs are rejected.
+func WithOptionUnixSocketUserLevels(levels map[uint32]User) UnixSocketConsoleOption {
+	return func(console *UnixSocketConsole) {
+		console.credentialsMapper = func(cred PeerCredentials) (string, User, error) {
+			level, ok := levels[cred.UID]
+			if !ok {
+				return "", Guest, fmt.Errorf("uid %d not allowed", cred.UID)
+			}
+			return usernameFromUID(cred.UID), level, nil
+		}
+	}
+}
+
+func WithOptionUnixSocketTimeout(timeout time.Duration) UnixSocketConsoleOption {
+	return func(console *UnixSocketConsole) {
+		console.timeout = timeout
+	}
+}
+
+func WithOptionUnixSocketShutdownNotice(notice string) UnixSocketConsoleOption {
+	return func(console *UnixSocketConsole) {
+		console.shutdownNotice = notice
+	}
+}
+
+// WithOptionUnixSocketPrompt sets the prompt template of the consoles, see WithOptionPrompt.
+func WithOptionUnixSocketPrompt(template string) UnixSocketConsoleOption {
+	return func(console *UnixSocketConsole) {
+		console.prompt = template
+	}
+}
+
+func usernameFromUID(uid uint32) string {
+	id := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(id); err == nil {
+		return u.Username
+	}
+	return id
+}
+
+// defaultUnixCredentialsMapper gives Root to uid 0 and Guest to everybody else.
+func defaultUnixCredentialsMapper(cred PeerCredentials) (string, User, error) {
+	level := Guest
+	if cred.UID == 0 {
+		level = Root
+	}
+	return usernameFromUID(cred.UID), level, nil
+}
+
+// NewUnixSocketConsole creates a console listening on the unix socket path, it
+// starts serving only when Start is called.
+func NewUnixSocketConsole(path string, opts ...UnixSocketConsoleOption) *UnixSocketConsole {
+	c := &UnixSocketConsole{
+		listenerServer:    newListenerServer("Unix socket"),
+		mu:                &sync.RWMutex{},
+		path:              path,
+		fileMode:          defaultUnixSocketFileMode,
+		uid:               -1,
+		gid:               -1,
+		mode:              UnixSessionInteractive,
+		credentialsMapper: defaultUnixCredentialsMapper,
+		shutdownNotice:    defaultShutdownNotice,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func (c *UnixSocketConsole) AddCallbackOnNewConsole(cb OnNewConsole) {
+	c.callbackOnNewConsole = cb
+}
+
+func (c *UnixSocketConsole) RemoveCallbackOnNewConsole() {
+	c.callbackOnNewConsole = nil
+}
+
+// Start creates the socket file and serves the clients, it blocks until the
+// console is shut down or the listener fails.
+func (c *UnixSocketConsole) Start() error {
+
+	if err := removeStaleSocket(c.path); err != nil {
+		return err
+	}
+
+	listener, err := listenUnixSocket(c.path, c.fileMode, c.uid, c.gid)
+	if err != nil {
+		return err
+	}
+
+	return c.serve(listener, c.handler)
+}
+
+// removeStaleSocket removes the socket left by a previous run, which would make
+// listen fail. A socket still accepting connections belongs to a live server
+// and is left alone.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another server", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// stopAccepting closes the listener and returns the consoles still alive.
+func (c *UnixSocketConsole) stopAccepting() ([]*Console, error) {
+	err := c.closeListener()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return append([]*Console(nil), c.consoles...), err
+}
+
+// Stop removes the socket and closes every session immediately.
+func (c *UnixSocketConsole) Stop() error {
+	consoles, err := c.stopAccepting()
+	for _, console := range consoles {
+		console.Stop()
+	}
+	return err
+}
+
+// Shutdown stops accepting connections, sends the shutdown notice to the live
+// sessions and waits for their commands to complete until ctx expires, then
+// closes every connection.
+func (c *UnixSocketConsole) Shutdown(ctx context.Context) error {
+	consoles, err := c.stopAccepting()
+	return errors.Join(err, shutdownConsoles(ctx, consoles, c.shutdownNotice))
+}
+
+func (c *UnixSocketConsole) addConsole(console *Console) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.consoles = append(c.consoles, console)
+}
+
+func (c *UnixSocketConsole) removeConsole(console *Console) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for idx, cl := range c.consoles {
+		if cl == console {
+			c.consoles = append(c.consoles[:idx], c.consoles[idx+1:]...)
+			break
+		}
+	}
+}
+
+func (c *UnixSocketConsole) handler(conn net.Conn) {
+
+	username, level, authenticated := "", Guest, false
+	cred, err := peerCredentials(conn)
+	switch {
+	case errors.Is(err, errPeerCredentialsUnsupported):
+		// fall back to the password login
+	case err != nil:
+		log.Warnf("Unix socket peer credentials failed: %s", err)
+		conn.Close()
+		return
+	default:
+		username, level, err = c.credentialsMapper(cred)
+		if err != nil {
+			log.Warnf("Unix socket connection from pid %d rejected: %s", cred.PID, err)
+			conn.Close()
+			return
+		}
+		authenticated = true
+	}
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	fr := &flushingReader{r: r}
+
+	consoleIO := struct {
+		io.ReadCloser
+		io.Writer
+		Flusher
+	}{
+		struct {
+			io.Reader
+			io.Closer
+		}{fr, conn},
+		w,
+		w,
+	}
+
+	var opts []ConsoleOption
+	if c.mode == UnixSessionOneShot {
+		opts = append(opts, WithOptionColor(false), WithOptionInteractive(false))
+	}
+	console := NewConsole(consoleIO, opts...)
+	if c.prompt != "" {
+		console.SetPrompt(c.prompt)
+	}
+	fr.flush = console.flush
+	if authenticated {
+		console.Authenticate(username, level)
+	}
+
+	if c.callbackOnNewConsole != nil {
+		c.callbackOnNewConsole(console)
+	}
+
+	c.addConsole(console)
+	defer c.removeConsole(console)
+
+	if c.mode == UnixSessionOneShot {
+		c.oneShot(console, r)
+		return
+	}
+
+	console.SetTimeout(c.timeout)
+	console.Start()
+	<-console.Done()
+}
+
+// flushingReader sends the pending output before blocking on a read, so the
+// echo and the prompt reach the client as soon as the console waits for input.
+type flushingReader struct {
+	r     *bufio.Reader
+	flush func()
+}
+
+func (fr *flushingReader) Read(b []byte) (int, error) {
+	if fr.r.Buffered() == 0 {
+		fr.flush()
+	}
+	return fr.r.Read(b)
+}
+
+// oneShot runs the first command line sent by the client and closes.
+func (c *UnixSocketConsole) oneShot(console *Console, r *bufio.Reader) {
+	defer console.stop(false)
+
+	line, err := r.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return
+	}
+
+	if console.IsLoginEnabled() && !console.IsUserLogged() {
+		console.PrintError("Login required")
+		return
+	}
+
+	if e := console.Exec(line); e != N0_ERR {
+		console.PrintError(e)
+	}
+}
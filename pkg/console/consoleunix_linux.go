@@ -0,0 +1,89 @@
+package console
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// listenUnixSocket binds the socket in a private directory next to path and
+// links it at path once mode and the owner are applied, so that it is never
+// reachable with the permissions of the process umask. The umask is left
+// alone, it is shared by the whole process.
+func listenUnixSocket(path string, mode os.FileMode, uid int, gid int) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".console-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "sock")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	listener.SetUnlinkOnClose(false)
+
+	err = os.Chmod(tmp, mode)
+	if err == nil && (uid != -1 || gid != -1) {
+		err = os.Chown(tmp, uid, gid)
+	}
+	// a link, unlike a rename, never replaces an existing file
+	if err == nil {
+		if err = os.Link(tmp, path); errors.Is(err, os.ErrExist) {
+			err = &net.OpError{Op: "listen", Net: "unix", Addr: &net.UnixAddr{Name: path, Net: "unix"},
+				Err: os.NewSyscallError("bind", unix.EADDRINUSE)}
+		}
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return &unixSocketListener{Listener: listener, path: path}, nil
+}
+
+// unixSocketListener removes the socket at path when it is closed.
+type unixSocketListener struct {
+	net.Listener
+	path      string
+	closeOnce sync.Once
+}
+
+func (l *unixSocketListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: l.path, Net: "unix"}
+}
+
+func (l *unixSocketListener) Close() error {
+	err := l.Listener.Close()
+	l.closeOnce.Do(func() { os.Remove(l.path) })
+	return err
+}
+
+func peerCredentials(conn net.Conn) (PeerCredentials, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return PeerCredentials{}, errors.New("not a unix socket connection")
+	}
+
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return PeerCredentials{}, err
+	}
+
+	var ucred *unix.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		ucred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return PeerCredentials{}, err
+	}
+	if credErr != nil {
+		return PeerCredentials{}, credErr
+	}
+
+	return PeerCredentials{PID: ucred.Pid, UID: ucred.Uid, GID: ucred.Gid}, nil
+}
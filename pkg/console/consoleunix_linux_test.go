@@ -0,0 +1,94 @@
+package console_test
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+)
+
+func TestUnixSocketPeerCredentials(t *testing.T) {
+	uid := uint32(os.Getuid())
+	defaultLevel := console.Guest
+	if uid == 0 {
+		defaultLevel = console.Root
+	}
+
+	tests := []struct {
+		name      string
+		opts      []console.UnixSocketConsoleOption
+		rejected  bool
+		wantLevel console.User
+	}{
+		{"default mapper", nil, false, defaultLevel},
+		{"uid allowed", []console.UnixSocketConsoleOption{
+			console.WithOptionUnixSocketUserLevels(map[uint32]console.User{uid: console.Root})}, false, console.Root},
+		{"uid not allowed", []console.UnixSocketConsoleOption{
+			console.WithOptionUnixSocketUserLevels(map[uint32]console.User{uid + 1: console.Root})}, true, 0},
+		{"custom mapper", []console.UnixSocketConsoleOption{
+			console.WithOptionUnixSocketCredentialsMapper(func(cred console.PeerCredentials) (string, console.User, error) {
+				if cred.PID != int32(os.Getpid()) {
+					t.Errorf("pid = %d, want %d", cred.PID, os.Getpid())
+				}
+				return "operator", console.Guest, nil
+			})}, false, console.Guest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := make(chan *console.Console, 1)
+			path := socketPath(t)
+			startUnix(t, path, func(c *console.Console) {
+				c.EnableLogin("secret")
+				sessions <- c
+			}, tt.opts...)
+
+			cl := dialTestClient(t, "unix", path)
+			if tt.rejected {
+				if out := cl.expectClosed(); out != "" {
+					t.Errorf("rejected client got %q", out)
+				}
+				return
+			}
+			session := <-sessions
+			cl.expectPrompt()
+			if !session.IsUserLogged() || session.GetUserLevel() != tt.wantLevel {
+				t.Errorf("logged %v level %s, want %s", session.IsUserLogged(), session.GetUserLevel(), tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestUnixSocketCreation(t *testing.T) {
+	old := syscall.Umask(0022)
+	defer syscall.Umask(old)
+
+	path := socketPath(t)
+	server := console.NewUnixSocketConsole(path, console.WithOptionUnixSocketFileMode(0600))
+	done := make(chan error, 1)
+	go func() { done <- server.Start() }()
+	waitFor(t, "unix listener", func() bool { return server.Addr() != nil })
+
+	if umask := syscall.Umask(0022); umask != 0022 {
+		t.Errorf("umask changed to %o", umask)
+	}
+	if addr := server.Addr().String(); addr != path {
+		t.Errorf("Addr = %s, want %s", addr, path)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != filepath.Base(path) {
+		t.Errorf("socket dir entries %v", entries)
+	}
+
+	server.Stop()
+	if err := <-done; err != nil {
+		t.Errorf("Start = %s", err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Errorf("socket left after Stop: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !linux
+
+package console
+
+import (
+	"net"
+	"os"
+)
+
+func listenUnixSocket(path string, mode os.FileMode, uid int, gid int) (net.Listener, error) {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Chmod(path, mode)
+	if err == nil && (uid != -1 || gid != -1) {
+		err = os.Chown(path, uid, gid)
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func peerCredentials(conn net.Conn) (PeerCredentials, error) {
+	return PeerCredentials{}, errPeerCredentialsUnsupported
+}
@@ -0,0 +1,173 @@
+package console_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+)
+
+// socketPath returns a path for a socket in a new directory, short enough for
+// the limit of the socket addresses.
+func socketPath(t *testing.T) string {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "console")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "console.sock")
+}
+
+func startUnix(t *testing.T, path string, setup func(c *console.Console), opts ...console.UnixSocketConsoleOption) *console.UnixSocketConsole {
+	t.Helper()
+
+	server := console.NewUnixSocketConsole(path, opts...)
+	if setup != nil {
+		server.AddCallbackOnNewConsole(setup)
+	}
+	serveInBackground(t, server.Start, server.Stop)
+	waitFor(t, "unix listener", func() bool { return server.Addr() != nil })
+	return server
+}
+
+func TestUnixSocketFileMode(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []console.UnixSocketConsoleOption
+		want os.FileMode
+	}{
+		{"default", nil, 0660},
+		{"owner only", []console.UnixSocketConsoleOption{console.WithOptionUnixSocketFileMode(0600)}, 0600},
+		{"world", []console.UnixSocketConsoleOption{console.WithOptionUnixSocketFileMode(0666)}, 0666},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := socketPath(t)
+			startUnix(t, path, nil, tt.opts...)
+
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != tt.want {
+				t.Errorf("mode = %s, want socket %s", fi.Mode(), tt.want)
+			}
+		})
+	}
+}
+
+func TestUnixSocketExistingPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, path string)
+		wantErr string
+	}{
+		{"no file", func(t *testing.T, path string) {}, ""},
+		{"stale socket", func(t *testing.T, path string) {
+			l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			l.SetUnlinkOnClose(false)
+			l.Close()
+		}, ""},
+		{"live socket", func(t *testing.T, path string) {
+			l, err := net.Listen("unix", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { l.Close() })
+		}, "in use by another server"},
+		{"regular file", func(t *testing.T, path string) {
+			if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}, "address already in use"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := socketPath(t)
+			tt.prepare(t, path)
+
+			if tt.wantErr == "" {
+				startUnix(t, path, nil)
+				return
+			}
+			server := console.NewUnixSocketConsole(path)
+			err := server.Start()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Start = %v, want %q", err, tt.wantErr)
+			}
+			if _, err := os.Lstat(path); err != nil {
+				t.Errorf("existing file removed: %s", err)
+			}
+		})
+	}
+}
+
+func TestUnixSocketOneShot(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       string
+		closeWrite bool
+		want       string
+	}{
+		{"command", "echo one two\n", false, "one\ntwo\n"},
+		{"without newline", "echo one", true, "one\n"},
+		{"unknown command", "nosuch\n", false, string(console.CMD_NOT_FOUND) + "\n"},
+		{"empty line", "\n", false, ""},
+		{"nothing sent", "", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := socketPath(t)
+			startUnix(t, path, func(c *console.Console) {
+				c.AddConsoleCommand(echoCommand)
+			}, console.WithOptionUnixSocketSessionMode(console.UnixSessionOneShot))
+
+			cl := dialTestClient(t, "unix", path)
+			cl.send(tt.line)
+			if tt.closeWrite {
+				cl.conn.(*net.UnixConn).CloseWrite()
+			}
+			if got := cl.expectClosed(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnixSocketInteractive(t *testing.T) {
+	path := socketPath(t)
+	startUnix(t, path, func(c *console.Console) {
+		c.AddConsoleCommand(echoCommand)
+	})
+
+	cl := dialTestClient(t, "unix", path)
+	if got := cl.run("echo one"); got != "one\n" {
+		t.Errorf("output = %q", got)
+	}
+}
+
+func TestUnixSocketShutdown(t *testing.T) {
+	path := socketPath(t)
+	server := startUnix(t, path, nil, console.WithOptionUnixSocketShutdownNotice("bye"))
+
+	cl := dialTestClient(t, "unix", path)
+	cl.expectPrompt()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown = %v", err)
+	}
+	cl.expect("bye\n")
+	cl.expectClosed()
+}
@@ -0,0 +1,431 @@
+package console
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed webconsole.html
+var webConsolePage string
+
+const defaultWebSocketPagePath = "/"
+const defaultWebSocketPath = "/ws"
+const webSocketReadLimit = 64 * 1024
+const webSocketWriteTimeout = 10 * time.Second
+const webSocketReadHeaderTimeout = 10 * time.Second
+
+// webSocketMessage is sent by the browser: "input" carries the keystrokes,
+// "resize" the size of the terminal.
+type webSocketMessage struct {
+	Type string `json:"type"`
+	Data string `json:"data,omitempty"`
+	Cols int    `json:"cols,omitempty"`
+	Rows int    `json:"rows,omitempty"`
+}
+
+type WebSocketConsole struct {
+	mu                   *sync.RWMutex
+	consoles             []*Console
+	pagePath             string
+	wsPath               string
+	allowedOrigins       []string
+	auth                 httpAuth
+	upgrader             websocket.Upgrader
+	server               *http.Server
+	maxConnections       int
+	callbackOnNewConsole OnNewConsole
+	timeout              time.Duration
+	shutdownNotice       string
+	prompt               string
+	closing              bool
+}
+
+type WebSocketConsoleOption func(console *WebSocketConsole)
+
+// WithOptionWebSocketPaths sets where the terminal page and the websocket
+// endpoint are served, an empty pagePath disables the page.
+func WithOptionWebSocketPaths(pagePath string, wsPath string) WebSocketConsoleOption {
+	return func(console *WebSocketConsole) {
+		console.pagePath = pagePath
+		console.wsPath = wsPath
+	}
+}
+
+// WithOptionWebSocketAllowedOrigins accepts the websocket upgrades coming from
+// the listed origins (e.g. "https://noc.example.com"), by default only the
+// same origin is accepted.
+func WithOptionWebSocketAllowedOrigins(origins ...string) WebSocketConsoleOption {
+	return func(console *WebSocketConsole) {
+		console.allowedOrigins = origins
+	}
+}
+
+// WithOptionWebSocketBasicAuth protects the page and the websocket with http
+// basic auth, users are Root unless WithOptionWebSocketUserLevels says
+// otherwise.
+func WithOptionWebSocketBasicAuth(userToPassword map[string]string) WebSocketConsoleOption {
+	return func(console *WebSocketConsole) {
+		console.auth.basicUsers = userToPassword
+	}
+}
+
+func WithOptionWebSocketUserLevels(levels map[string]User) WebSocketConsoleOption {
+	return func(console *WebSocketConsole) {
+		console.auth.basicLevels = levels
+	}
+}
+
+// WithOptionWebSocketTokens protects the websocket with tokens, sent as bearer
+// token or as token query parameter.
+func WithOptionWebSocketTokens(tokens map[string]User) WebSocketConsoleOption {
+	return func(console *WebSocketConsole) {
+		console.auth.tokens = tokens
+	}
+}
+
+func WithOptionWebSocketMaxConnections(maxConnections int) WebSocketConsoleOption {
+	return func(console *WebSocketConsole) {
+		console.maxConnections = maxConnections
+	}
+}
+
+func WithOptionWebSocketTimeout(timeout time.Duration) WebSocketConsoleOption {
+	return func(console *WebSocketConsole) {
+		console.timeout = timeout
+	}
+}
+
+func WithOptionWebSocketShutdownNotice(notice string) WebSocketConsoleOption {
+	return func(console *WebSocketConsole) {
+		console.shutdownNotice = notice
+	}
+}
+
+// WithOptionWebSocketPrompt sets the prompt template of the consoles, see WithOptionPrompt.
+func WithOptionWebSocketPrompt(template string) WebSocketConsoleOption {
+	return func(console *WebSocketConsole) {
+		console.prompt = template
+	}
+}
+
+// NewWebSocketConsole creates the console, it is an http.Handler that can be
+// mounted on any mux or served on its own with Start.
+func NewWebSocketConsole(opts ...WebSocketConsoleOption) *WebSocketConsole {
+	c := &WebSocketConsole{
+		mu:             &sync.RWMutex{},
+		pagePath:       defaultWebSocketPagePath,
+		wsPath:         defaultWebSocketPath,
+		shutdownNotice: defaultShutdownNotice,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.upgrader = websocket.Upgrader{CheckOrigin: c.checkOrigin}
+
+	return c
+}
+
+func (c *WebSocketConsole) AddCallbackOnNewConsole(cb OnNewConsole) {
+	c.callbackOnNewConsole = cb
+}
+
+func (c *WebSocketConsole) RemoveCallbackOnNewConsole() {
+	c.callbackOnNewConsole = nil
+}
+
+func (c *WebSocketConsole) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// not a browser
+		return true
+	}
+	if len(c.allowedOrigins) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	for _, allowed := range c.allowedOrigins {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *WebSocketConsole) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == c.wsPath:
+		c.serveWebSocket(w, r)
+	case c.pagePath != "" && r.URL.Path == c.pagePath:
+		c.servePage(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (c *WebSocketConsole) servePage(w http.ResponseWriter, r *http.Request) {
+	if len(c.auth.basicUsers) > 0 {
+		if _, _, ok := c.auth.authenticate(r, false); !ok {
+			c.auth.requestCredentials(w)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, strings.Replace(webConsolePage, "{{WS_PATH}}", c.wsPath, 1))
+}
+
+func (c *WebSocketConsole) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+
+	username, level, authenticated := "", Guest, false
+	if c.auth.enabled() {
+		username, level, authenticated = c.auth.authenticate(r, true)
+		if !authenticated {
+			c.auth.requestCredentials(w)
+			return
+		}
+	}
+
+	c.mu.Lock()
+	if c.closing {
+		c.mu.Unlock()
+		http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	if c.maxConnections > 0 && len(c.consoles) >= c.maxConnections {
+		c.mu.Unlock()
+		log.Warn("Max number of websocket connections reached")
+		http.Error(w, "Too many connections", http.StatusServiceUnavailable)
+		return
+	}
+	// reserve the slot before the upgrade, it is released on close
+	c.consoles = append(c.consoles, nil)
+	c.mu.Unlock()
+
+	ws, err := c.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		c.removeConsole(nil)
+		log.Warnf("Websocket upgrade from %s failed: %s", r.RemoteAddr, err)
+		return
+	}
+	ws.SetReadLimit(webSocketReadLimit)
+
+	conn := newWebSocketConn(ws)
+	consoleIO := struct {
+		io.ReadCloser
+		io.Writer
+		Flusher
+	}{conn, conn, conn}
+
+	console := NewConsole(consoleIO)
+	if c.prompt != "" {
+		console.SetPrompt(c.prompt)
+	}
+	conn.onResize = func(cols, rows int) {
+		console.SetSize(cols, rows)
+	}
+	if authenticated {
+		console.Authenticate(username, level)
+	}
+
+	c.mu.Lock()
+	for idx, cl := range c.consoles {
+		if cl == nil {
+			c.consoles[idx] = console
+			break
+		}
+	}
+	c.mu.Unlock()
+
+	if c.callbackOnNewConsole != nil {
+		c.callbackOnNewConsole(console)
+	}
+
+	// the console task ends on EOF when the browser leaves, the websocket
+	// and the hijacked connection are closed with it
+	console.AddCallbackOnClose(func() {
+		c.removeConsole(console)
+		conn.Close()
+	})
+	console.SetTimeout(c.timeout)
+
+	go conn.readLoop()
+	console.Start()
+
+	log.Infof("Websocket console from %s opened", r.RemoteAddr)
+}
+
+func (c *WebSocketConsole) removeConsole(console *Console) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for idx, cl := range c.consoles {
+		if cl == console {
+			c.consoles = append(c.consoles[:idx], c.consoles[idx+1:]...)
+			break
+		}
+	}
+}
+
+// Start serves the page and the websocket on addr, it blocks until the console
+// is shut down or the server fails.
+func (c *WebSocketConsole) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.closing {
+		c.mu.Unlock()
+		return listener.Close()
+	}
+	c.server = &http.Server{Handler: c, ReadHeaderTimeout: webSocketReadHeaderTimeout}
+	server := c.server
+	c.mu.Unlock()
+
+	err = server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (c *WebSocketConsole) stopAccepting(ctx context.Context) ([]*Console, error) {
+	c.mu.Lock()
+	c.closing = true
+	server := c.server
+	consoles := make([]*Console, 0, len(c.consoles))
+	for _, cl := range c.consoles {
+		if cl != nil {
+			consoles = append(consoles, cl)
+		}
+	}
+	c.mu.Unlock()
+
+	if server == nil {
+		return consoles, nil
+	}
+	// the websockets are hijacked connections, they are not tracked by the
+	// http server
+	return consoles, server.Shutdown(ctx)
+}
+
+// Stop closes the server and every session immediately.
+func (c *WebSocketConsole) Stop() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	consoles, err := c.stopAccepting(ctx)
+	for _, console := range consoles {
+		console.Stop()
+	}
+	if errors.Is(err, context.Canceled) {
+		err = nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections, sends the shutdown notice to the live
+// sessions and waits for their commands to complete until ctx expires, then
+// closes every connection.
+func (c *WebSocketConsole) Shutdown(ctx context.Context) error {
+	consoles, err := c.stopAccepting(ctx)
+	return errors.Join(err, shutdownConsoles(ctx, consoles, c.shutdownNotice))
+}
+
+// webSocketConn adapts a websocket to the console: the output is buffered
+// and sent as a binary frame on flush, the input frames are decoded by
+// readLoop and handed over to Read through a pipe.
+type webSocketConn struct {
+	ws       *websocket.Conn
+	wmu      sync.Mutex
+	out      bytes.Buffer
+	pr       *io.PipeReader
+	pw       *io.PipeWriter
+	onResize func(cols, rows int)
+}
+
+func newWebSocketConn(ws *websocket.Conn) *webSocketConn {
+	pr, pw := io.Pipe()
+	return &webSocketConn{ws: ws, pr: pr, pw: pw}
+}
+
+func (conn *webSocketConn) readLoop() {
+	for {
+		_, data, err := conn.ws.ReadMessage()
+		if err != nil {
+			conn.pw.CloseWithError(io.EOF)
+			return
+		}
+
+		var msg webSocketMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			log.Debugf("Websocket bad message: %s", err)
+			continue
+		}
+
+		switch msg.Type {
+		case "input":
+			if _, err := conn.pw.Write([]byte(msg.Data)); err != nil {
+				return
+			}
+		case "resize":
+			if conn.onResize != nil && msg.Cols > 0 && msg.Rows > 0 {
+				conn.onResize(msg.Cols, msg.Rows)
+			}
+		}
+	}
+}
+
+func (conn *webSocketConn) Read(b []byte) (int, error) {
+	// the terminal is about to wait for input, send echo and prompt
+	if err := conn.Flush(); err != nil {
+		return 0, err
+	}
+	return conn.pr.Read(b)
+}
+
+func (conn *webSocketConn) Write(b []byte) (int, error) {
+	conn.wmu.Lock()
+	defer conn.wmu.Unlock()
+
+	return conn.out.Write(b)
+}
+
+func (conn *webSocketConn) Flush() error {
+	conn.wmu.Lock()
+	defer conn.wmu.Unlock()
+
+	if conn.out.Len() == 0 {
+		return nil
+	}
+	conn.ws.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+	err := conn.ws.WriteMessage(websocket.BinaryMessage, conn.out.Bytes())
+	conn.out.Reset()
+	return err
+}
+
+func (conn *webSocketConn) Close() error {
+	conn.Flush()
+
+	conn.wmu.Lock()
+	conn.ws.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	conn.wmu.Unlock()
+
+	conn.pr.Close()
+	return conn.ws.Close()
+}
@@ -0,0 +1,218 @@
+package console_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/freedreamer82/go-console/pkg/console"
+	"github.com/gorilla/websocket"
+)
+
+// webSocketClient plays the browser terminal: Write sends input messages,
+// Read returns the output frames.
+type webSocketClient struct {
+	ws      *websocket.Conn
+	pending []byte
+}
+
+func (c *webSocketClient) Read(b []byte) (int, error) {
+	for len(c.pending) == 0 {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return 0, io.EOF
+		}
+		c.pending = data
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *webSocketClient) Write(b []byte) (int, error) {
+	return len(b), c.ws.WriteJSON(map[string]string{"type": "input", "data": string(b)})
+}
+
+func (c *webSocketClient) Close() error {
+	return c.ws.Close()
+}
+
+func startWebSocket(t *testing.T, setup func(c *console.Console), opts ...console.WebSocketConsoleOption) (*console.WebSocketConsole, *httptest.Server) {
+	t.Helper()
+
+	wsConsole := console.NewWebSocketConsole(opts...)
+	if setup != nil {
+		wsConsole.AddCallbackOnNewConsole(setup)
+	}
+	server := httptest.NewServer(wsConsole)
+	t.Cleanup(func() {
+		wsConsole.Stop()
+		server.Close()
+	})
+	return wsConsole, server
+}
+
+func dialWebSocket(server *httptest.Server, path string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	return websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+path, header)
+}
+
+func newWebSocketTestClient(t *testing.T, server *httptest.Server) *testClient {
+	t.Helper()
+
+	ws, _, err := dialWebSocket(server, "/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newTestClient(t, &webSocketClient{ws: ws})
+}
+
+func TestWebSocketPage(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []console.WebSocketConsoleOption
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"default page", nil, "/", http.StatusOK, `"/ws"`},
+		{"custom paths", []console.WebSocketConsoleOption{console.WithOptionWebSocketPaths("/term", "/term/ws")},
+			"/term", http.StatusOK, `"/term/ws"`},
+		{"page disabled", []console.WebSocketConsoleOption{console.WithOptionWebSocketPaths("", "/ws")},
+			"/", http.StatusNotFound, ""},
+		{"unknown path", nil, "/nosuch", http.StatusNotFound, ""},
+		{"basic auth", []console.WebSocketConsoleOption{
+			console.WithOptionWebSocketBasicAuth(map[string]string{"admin": "secret"})},
+			"/", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, server := startWebSocket(t, nil, tt.opts...)
+
+			resp, err := http.Get(server.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tt.wantStatus || !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("GET %s = %d, body contains %q: %v", tt.path, resp.StatusCode, tt.wantBody,
+					strings.Contains(string(body), tt.wantBody))
+			}
+		})
+	}
+}
+
+func TestWebSocketUpgrade(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []console.WebSocketConsoleOption
+		path       string
+		header     http.Header
+		wantStatus int
+		logged     bool
+		wantLevel  console.User
+	}{
+		{name: "no auth", path: "/ws"},
+		{name: "basic auth", opts: []console.WebSocketConsoleOption{
+			console.WithOptionWebSocketBasicAuth(map[string]string{"admin": "secret"}),
+			console.WithOptionWebSocketUserLevels(map[string]console.User{"admin": console.Guest})},
+			path: "/ws", header: http.Header{"Authorization": {"Basic YWRtaW46c2VjcmV0"}}, logged: true, wantLevel: console.Guest},
+		{name: "wrong password", opts: []console.WebSocketConsoleOption{
+			console.WithOptionWebSocketBasicAuth(map[string]string{"admin": "other"})},
+			path: "/ws", header: http.Header{"Authorization": {"Basic YWRtaW46c2VjcmV0"}}, wantStatus: http.StatusUnauthorized},
+		{name: "token query", opts: []console.WebSocketConsoleOption{
+			console.WithOptionWebSocketTokens(map[string]console.User{"tok": console.Root})},
+			path: "/ws?token=tok", logged: true, wantLevel: console.Root},
+		{name: "bearer token", opts: []console.WebSocketConsoleOption{
+			console.WithOptionWebSocketTokens(map[string]console.User{"tok": console.Root})},
+			path: "/ws", header: http.Header{"Authorization": {"Bearer tok"}}, logged: true, wantLevel: console.Root},
+		{name: "missing token", opts: []console.WebSocketConsoleOption{
+			console.WithOptionWebSocketTokens(map[string]console.User{"tok": console.Root})},
+			path: "/ws", wantStatus: http.StatusUnauthorized},
+		{name: "foreign origin", path: "/ws", header: http.Header{"Origin": {"http://evil.example.com"}},
+			wantStatus: http.StatusForbidden},
+		{name: "allowed origin", opts: []console.WebSocketConsoleOption{
+			console.WithOptionWebSocketAllowedOrigins("http://noc.example.com")},
+			path: "/ws", header: http.Header{"Origin": {"http://noc.example.com"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions := make(chan *console.Console, 1)
+			_, server := startWebSocket(t, func(c *console.Console) {
+				sessions <- c
+			}, tt.opts...)
+
+			ws, resp, err := dialWebSocket(server, tt.path, tt.header)
+			if tt.wantStatus != 0 {
+				if err == nil {
+					ws.Close()
+					t.Fatal("upgrade accepted")
+				}
+				if resp == nil || resp.StatusCode != tt.wantStatus {
+					t.Fatalf("upgrade = %v, want status %d", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			cl := newTestClient(t, &webSocketClient{ws: ws})
+			session := <-sessions
+			cl.expectPrompt()
+			if tt.logged && (!session.IsUserLogged() || session.GetUserLevel() != tt.wantLevel) {
+				t.Errorf("logged %v level %s, want %s", session.IsUserLogged(), session.GetUserLevel(), tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestWebSocketSession(t *testing.T) {
+	sessions := make(chan *console.Console, 1)
+	_, server := startWebSocket(t, func(c *console.Console) {
+		c.AddConsoleCommand(echoCommand)
+		sessions <- c
+	})
+	ws, _, err := dialWebSocket(server, "/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := newTestClient(t, &webSocketClient{ws: ws})
+	session := <-sessions
+
+	if got := cl.run("echo one two"); got != "one\ntwo\n" {
+		t.Errorf("output = %q", got)
+	}
+
+	msg, _ := json.Marshal(map[string]interface{}{"type": "resize", "cols": 132, "rows": 43})
+	if err := ws.WriteMessage(websocket.TextMessage, msg); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "resize", func() bool {
+		width, height := session.GetSize()
+		return width == 132 && height == 43
+	})
+}
+
+// a client leaving releases its connection slot
+func TestWebSocketDisconnect(t *testing.T) {
+	_, server := startWebSocket(t, nil, console.WithOptionWebSocketMaxConnections(1))
+
+	first := newWebSocketTestClient(t, server)
+	first.expectPrompt()
+
+	_, resp, err := dialWebSocket(server, "/ws", nil)
+	if err == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("second connection = %v, want status 503", err)
+	}
+
+	first.conn.Close()
+	var ws *websocket.Conn
+	waitFor(t, "slot release", func() bool {
+		ws, _, err = dialWebSocket(server, "/ws", nil)
+		return err == nil
+	})
+	newTestClient(t, &webSocketClient{ws: ws}).expectPrompt()
+}
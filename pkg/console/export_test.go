@@ -0,0 +1,34 @@
+package console
+
+import (
+	"io"
+	"time"
+)
+
+// SetConfirmUnit shortens the minute of commit confirmed for the time of a
+// test, it returns the function restoring it.
+func SetConfirmUnit(unit time.Duration) func() {
+	previous := confirmUnit
+	confirmUnit = unit
+	return func() { confirmUnit = previous }
+}
+
+// NewMqttConnection returns the stream of an mqtt client session, send
+// delivers a message as received from the broker.
+func NewMqttConnection() (conn io.ReadWriteCloser, send func(data string)) {
+	out := make(chan outMessage)
+	go func() {
+		for range out {
+		}
+	}()
+	c := newMqttConsoleConnection("client", &out)
+	return c, func(data string) { c.send([]byte(data), "cmd") }
+}
+
+// SetBroadcastTimeout shortens the wait of Broadcast for the time of a test,
+// it returns the function restoring it.
+func SetBroadcastTimeout(timeout time.Duration) func() {
+	previous := broadcastTimeout
+	broadcastTimeout = timeout
+	return func() { broadcastTimeout = previous }
+}